@@ -0,0 +1,312 @@
+package ceffu
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AddressBookEntry is a deposit address and the wallet it belongs to
+type AddressBookEntry struct {
+	Address        string `json:"address"`
+	Memo           string `json:"memo,omitempty"`
+	WalletID       int64  `json:"walletId"`
+	ParentWalletID int64  `json:"parentWalletId,omitempty"` // 0 for top level wallets
+	CoinSymbol     string `json:"coinSymbol"`
+	Network        string `json:"network"`
+}
+
+type addressKey struct {
+	address string
+	memo    string
+}
+
+// normalizeAddress lower cases hex addresses, which are case insensitive, and keeps everything else as is
+func normalizeAddress(address string) string {
+	if strings.HasPrefix(address, "0x") || strings.HasPrefix(address, "0X") {
+		return strings.ToLower(address)
+	}
+	return address
+}
+
+// AddressBook indexes the deposit addresses of all wallets and sub wallets, so incoming
+// deposits can be mapped from toAddress and memo back to the receiving wallet.
+// It is safe for concurrent use.
+type AddressBook struct {
+	client   *Client
+	networks []CoinNetwork
+	mu       sync.RWMutex
+	entries  map[addressKey][]AddressBookEntry
+	// synced holds wallets whose addresses have been fetched, mapped to their parent wallet id
+	synced map[int64]int64
+}
+
+// NewAddressBook creates an empty address book for the given coins and networks, call Sync to fill it
+func NewAddressBook(client *Client, networks []CoinNetwork) *AddressBook {
+	return &AddressBook{
+		client:   client,
+		networks: networks,
+		entries:  map[addressKey][]AddressBookEntry{},
+		synced:   map[int64]int64{},
+	}
+}
+
+// Sync fetches the addresses of every wallet and sub wallet, replacing the current index
+func (b *AddressBook) Sync() error {
+	fresh := NewAddressBook(b.client, b.networks)
+	err := fresh.Refresh()
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = fresh.entries
+	b.synced = fresh.synced
+	return nil
+}
+
+// Refresh only fetches addresses of wallets and sub wallets not in the index yet
+func (b *AddressBook) Refresh() error {
+	wallets, err := b.client.listAllWallets()
+	if err != nil {
+		return err
+	}
+	for _, wallet := range wallets {
+		if !b.isSynced(wallet.WalletID) {
+			for _, network := range b.networks {
+				resp, err := b.client.GetDepositAddress(network.CoinSymbol, network.Network, NewWalletID(wallet.WalletID))
+				if err != nil {
+					return err
+				}
+				if skippableAddressCode(resp.Code) {
+					continue
+				}
+				if err = checkCode(resp.Code, resp.Message); err != nil {
+					return err
+				}
+				b.add(AddressBookEntry{
+					Address:    resp.Data.WalletAddress,
+					Memo:       resp.Data.Memo,
+					WalletID:   wallet.WalletID,
+					CoinSymbol: network.CoinSymbol,
+					Network:    network.Network,
+				})
+			}
+			b.markSynced(wallet.WalletID, 0)
+		}
+
+		subWallets, err := b.client.listAllSubWallets(wallet.WalletID)
+		if isAPIError(err, ErrorWalletTypeNotSupported, ErrorWalletRelationship) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var missing []int64
+		for _, subWalletId := range subWallets {
+			if !b.isSynced(subWalletId) {
+				missing = append(missing, subWalletId)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		if wallet.WalletType == int(WalletTypeIntPrime) && len(missing) > 25 {
+			// Paging through all sub wallet addresses is cheaper than one call per sub wallet
+			err = b.syncAllSubWallets(wallet.WalletID, missing)
+		} else {
+			err = b.syncSubWallets(wallet.WalletID, missing)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *AddressBook) syncSubWallets(parentWalletId int64, subWallets []int64) error {
+	for _, subWalletId := range subWallets {
+		for _, network := range b.networks {
+			resp, err := b.client.GetSubWalletDepositAddress(NewWalletID(subWalletId), network.CoinSymbol, network.Network)
+			if err != nil {
+				return err
+			}
+			if skippableAddressCode(resp.Code) {
+				continue
+			}
+			if err = checkCode(resp.Code, resp.Message); err != nil {
+				return err
+			}
+			b.add(AddressBookEntry{
+				Address:        resp.Data.WalletAddress,
+				Memo:           resp.Data.Memo,
+				WalletID:       subWalletId,
+				ParentWalletID: parentWalletId,
+				CoinSymbol:     network.CoinSymbol,
+				Network:        network.Network,
+			})
+		}
+		b.markSynced(subWalletId, parentWalletId)
+	}
+	return nil
+}
+
+// syncAllSubWallets pages through the addresses of all sub wallets of parentWalletId.
+// subWallets are marked synced even if they have no address, so Refresh does not fetch them again.
+func (b *AddressBook) syncAllSubWallets(parentWalletId int64, subWallets []int64) error {
+	seen := map[int64]bool{}
+	for _, subWalletId := range subWallets {
+		seen[subWalletId] = true
+	}
+	for _, network := range b.networks {
+		err := forEachPage(func(pageNo int) (int, error) {
+			resp, err := b.client.GetAllSubWalletDepositAddress(NewWalletID(parentWalletId), network.CoinSymbol, network.Network, 25, pageNo)
+			if err != nil {
+				return 0, err
+			}
+			if skippableAddressCode(resp.Code) {
+				return 0, nil
+			}
+			if err = checkCode(resp.Code, resp.Message); err != nil {
+				return 0, err
+			}
+			for _, address := range resp.Data.Data {
+				seen[address.WalletID] = true
+				b.add(AddressBookEntry{
+					Address:        address.WalletAddress,
+					Memo:           address.Memo,
+					WalletID:       address.WalletID,
+					ParentWalletID: parentWalletId,
+					CoinSymbol:     network.CoinSymbol,
+					Network:        network.Network,
+				})
+			}
+			return resp.Data.TotalPage, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for subWalletId := range seen {
+		b.markSynced(subWalletId, parentWalletId)
+	}
+	return nil
+}
+
+// skippableAddressCode reports codes which mean a wallet has no address for a coin network
+func skippableAddressCode(code string) bool {
+	return code == ErrorAddressNotActivated || code == ErrorWalletTypeNotSupported
+}
+
+func (b *AddressBook) isSynced(walletId int64) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.synced[walletId]
+	return ok
+}
+
+func (b *AddressBook) markSynced(walletId int64, parentWalletId int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.synced[walletId] = parentWalletId
+}
+
+func (b *AddressBook) add(entry AddressBookEntry) {
+	if entry.Address == "" {
+		return
+	}
+	key := addressKey{address: normalizeAddress(entry.Address), memo: entry.Memo}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, existing := range b.entries[key] {
+		// One address is usually shared by several coins on the same network
+		if existing.WalletID == entry.WalletID && existing.CoinSymbol == entry.CoinSymbol && existing.Network == entry.Network {
+			b.entries[key][i] = entry
+			return
+		}
+	}
+	b.entries[key] = append(b.entries[key], entry)
+}
+
+// Resolve returns every entry for a deposit address and memo. Pass an empty memo for
+// networks without memos. Hex addresses are matched case insensitive.
+// Entries differ by coin and network only, they all belong to the same wallet.
+func (b *AddressBook) Resolve(address string, memo string) ([]AddressBookEntry, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	entries, ok := b.entries[addressKey{address: normalizeAddress(address), memo: memo}]
+	if !ok {
+		return nil, false
+	}
+	return append([]AddressBookEntry(nil), entries...), true
+}
+
+// ResolveCoin returns the entry for a deposit of coinSymbol on network to address and memo
+func (b *AddressBook) ResolveCoin(address string, memo string, coinSymbol string, network string) (*AddressBookEntry, bool) {
+	entries, _ := b.Resolve(address, memo)
+	for i := range entries {
+		if entries[i].CoinSymbol == coinSymbol && entries[i].Network == network {
+			return &entries[i], true
+		}
+	}
+	return nil, false
+}
+
+// Entries returns all entries sorted by wallet id, coin and network
+func (b *AddressBook) Entries() []AddressBookEntry {
+	b.mu.RLock()
+	var entries []AddressBookEntry
+	for _, list := range b.entries {
+		entries = append(entries, list...)
+	}
+	b.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].WalletID != entries[j].WalletID {
+			return entries[i].WalletID < entries[j].WalletID
+		}
+		if entries[i].CoinSymbol != entries[j].CoinSymbol {
+			return entries[i].CoinSymbol < entries[j].CoinSymbol
+		}
+		return entries[i].Network < entries[j].Network
+	})
+	return entries
+}
+
+type addressBookFile struct {
+	Entries []AddressBookEntry `json:"entries"`
+	Synced  map[int64]int64    `json:"synced"`
+}
+
+// Save writes the index as json, so it can be loaded with Load instead of a full Sync after restart
+func (b *AddressBook) Save(w io.Writer) error {
+	entries := b.Entries()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return json.NewEncoder(w).Encode(&addressBookFile{
+		Entries: entries,
+		Synced:  b.synced,
+	})
+}
+
+// Load replaces the index with one written by Save
+func (b *AddressBook) Load(r io.Reader) error {
+	file := &addressBookFile{}
+	err := json.NewDecoder(r).Decode(file)
+	if err != nil {
+		return err
+	}
+	loaded := NewAddressBook(b.client, b.networks)
+	for _, entry := range file.Entries {
+		loaded.add(entry)
+	}
+	if file.Synced != nil {
+		loaded.synced = file.Synced
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = loaded.entries
+	b.synced = loaded.synced
+	return nil
+}
@@ -0,0 +1,96 @@
+package ceffu
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAddressBook(t *testing.T) {
+	subWallets := `[2]`
+	subAddressCalls := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/wallet/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"walletId":1,"walletType":20}],"totalPage":1}}`))
+		case "/open-api/v1/wallet/deposit/address":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"walletAddress":"0xABCdef"}}`))
+		case "/open-api/v1/subwallet/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":` + subWallets + `,"totalPage":1}}`))
+		case "/open-api/v1/subwallet/deposit/address":
+			subAddressCalls++
+			id := r.URL.Query().Get("walletId")
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"walletAddress":"shared","memo":"m` + id + `"}}`))
+		}
+	})
+	book := NewAddressBook(cl, []CoinNetwork{{"XRP", "XRP"}})
+	if err := book.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := book.ResolveCoin("0xabcDEF", "", "XRP", "XRP")
+	if !ok || entry.WalletID != 1 {
+		t.Fatalf("parent address not resolved: %+v", entry)
+	}
+	entry, ok = book.ResolveCoin("shared", "m2", "XRP", "XRP")
+	if !ok || entry.WalletID != 2 || entry.ParentWalletID != 1 {
+		t.Fatalf("sub wallet address not resolved: %+v", entry)
+	}
+
+	// Refresh only looks up the new sub wallet
+	subWallets = `[2,3]`
+	if err := book.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if subAddressCalls != 2 {
+		t.Fatalf("expected incremental refresh, got %d sub wallet lookups", subAddressCalls)
+	}
+	if _, ok = book.Resolve("shared", "m3"); !ok {
+		t.Fatal("new sub wallet not resolved")
+	}
+
+	var buf bytes.Buffer
+	if err := book.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewAddressBook(cl, []CoinNetwork{{"XRP", "XRP"}})
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Entries()) != 3 {
+		t.Fatalf("unexpected loaded entries %+v", loaded.Entries())
+	}
+}
+
+func TestAddressBookMarksEmptySubWalletsSynced(t *testing.T) {
+	allAddressCalls := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/wallet/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"walletId":1,"walletType":20}],"totalPage":1}}`))
+		case "/open-api/v1/wallet/deposit/address":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"walletAddress":"parent"}}`))
+		case "/open-api/v1/subwallet/list":
+			ids := make([]string, 30)
+			for i := range ids {
+				ids[i] = strconv.Itoa(100 + i)
+			}
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[` + strings.Join(ids, ",") + `],"totalPage":1}}`))
+		case "/open-api/v1/subwallet/deposit/address":
+			allAddressCalls++
+			// Only one of the sub wallets has an address
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"walletId":100,"walletAddress":"sub"}],"totalPage":1}}`))
+		}
+	})
+	book := NewAddressBook(cl, []CoinNetwork{{"USDT", "ETH"}})
+	if err := book.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := book.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if allAddressCalls != 1 {
+		t.Fatalf("sub wallets without address fetched again, %d calls", allAddressCalls)
+	}
+}
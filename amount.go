@@ -0,0 +1,30 @@
+package ceffu
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// parseAmount parses a decimal amount string as returned by Ceffu, empty strings are zero
+func parseAmount(amount string) (*big.Rat, error) {
+	if amount == "" {
+		return new(big.Rat), nil
+	}
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	return r, nil
+}
+
+// formatAmount formats r as a plain decimal string without trailing zeros
+func formatAmount(r *big.Rat) string {
+	s := r.FloatString(18)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
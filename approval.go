@@ -0,0 +1,448 @@
+package ceffu
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrIntentNotFound     = errors.New("withdrawal intent not found")
+	ErrIntentTampered     = errors.New("withdrawal intent digest mismatch, intent has been tampered with")
+	ErrIntentExecuted     = errors.New("withdrawal intent has already been executed")
+	ErrIntentExpired      = errors.New("withdrawal intent has expired")
+	ErrQuorumNotReached   = errors.New("withdrawal intent has not reached approval quorum")
+	ErrUnknownApprover    = errors.New("approver is not registered")
+	ErrInvalidApproval    = errors.New("approval signature is invalid")
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+)
+
+// WithdrawalIntent describes a withdrawal which is held back until enough approvers signed it.
+// All fields are covered by Digest, so changing any of them invalidates existing approvals.
+type WithdrawalIntent struct {
+	ID                string   `json:"id"`
+	Amount            string   `json:"amount"`
+	CoinSymbol        string   `json:"coinSymbol"`
+	Network           string   `json:"network"`
+	WithdrawalAddress string   `json:"withdrawalAddress"`
+	Memo              string   `json:"memo"`
+	WalletID          WalletID `json:"walletId"`
+	RequestId         int64    `json:"requestId"`
+	CreatedAt         int64    `json:"createdAt"`           // unix timestamp in milliseconds
+	ExpiresAt         int64    `json:"expiresAt,omitempty"` // unix timestamp in milliseconds, default CreatedAt plus DefaultIntentTTL
+}
+
+// DefaultIntentTTL is how long an intent may be approved and executed if Propose is given no ExpiresAt
+const DefaultIntentTTL = 24 * time.Hour
+
+// Expired reports whether the intent can no longer be approved or executed
+func (i *WithdrawalIntent) Expired() bool {
+	expiresAt := i.ExpiresAt
+	if expiresAt == 0 {
+		expiresAt = time.UnixMilli(i.CreatedAt).Add(DefaultIntentTTL).UnixMilli()
+	}
+	return time.Now().UnixMilli() >= expiresAt
+}
+
+// Digest returns the sha512 digest of the canonical json encoding of the intent.
+// This is the message approvers sign.
+func (i *WithdrawalIntent) Digest() []byte {
+	// Struct fields are always encoded in declaration order, so the encoding is stable
+	encoded, _ := json.Marshal(i)
+	hash := sha512.Sum512(encoded)
+	return hash[:]
+}
+
+// Approval is a signature from a single approver over an intent digest.
+type Approval struct {
+	ApproverID string `json:"approverId"`
+	Signature  string `json:"signature"` // base64 encoded
+	ApprovedAt int64  `json:"approvedAt"`
+}
+
+// ApprovalRecord is the state of an intent as kept in an ApprovalStore.
+type ApprovalRecord struct {
+	Intent    WithdrawalIntent `json:"intent"`
+	Digest    string           `json:"digest"` // hex encoded digest taken when the intent was proposed
+	Approvals []Approval       `json:"approvals"`
+	Executed  bool             `json:"executed"`
+	SentAt    int64            `json:"sentAt,omitempty"` // unix milliseconds of the first withdrawal attempt
+	Result    *WithdrawalResp  `json:"result,omitempty"`
+}
+
+// ApprovalStore persists approval records. Implementations must be safe for concurrent use.
+// Load returns ErrIntentNotFound if the id is unknown.
+type ApprovalStore interface {
+	Save(record *ApprovalRecord) error
+	Load(id string) (*ApprovalRecord, error)
+}
+
+// MemoryApprovalStore keeps approval records in memory.
+type MemoryApprovalStore struct {
+	mu      sync.Mutex
+	records map[string][]byte
+}
+
+func NewMemoryApprovalStore() *MemoryApprovalStore {
+	return &MemoryApprovalStore{records: map[string][]byte{}}
+}
+
+func (s *MemoryApprovalStore) Save(record *ApprovalRecord) error {
+	// Store encoded copy so callers can't modify stored records by accident
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.Intent.ID] = encoded
+	return nil
+}
+
+func (s *MemoryApprovalStore) Load(id string) (*ApprovalRecord, error) {
+	s.mu.Lock()
+	encoded, ok := s.records[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	record := &ApprovalRecord{}
+	err := json.Unmarshal(encoded, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// FileApprovalStore keeps every approval record as a json file in a directory.
+type FileApprovalStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewFileApprovalStore(dir string) (*FileApprovalStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileApprovalStore{dir: dir}, nil
+}
+
+func (s *FileApprovalStore) path(id string) string {
+	// Intent ids are hex strings, but never trust them as path components
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
+
+func (s *FileApprovalStore) Save(record *ApprovalRecord) error {
+	encoded, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Write to temp file first, so a crash never leaves a half written record
+	tmp := s.path(record.Intent.ID) + ".tmp"
+	err = os.WriteFile(tmp, encoded, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(record.Intent.ID))
+}
+
+func (s *FileApprovalStore) Load(id string) (*ApprovalRecord, error) {
+	s.mu.Lock()
+	encoded, err := os.ReadFile(s.path(id))
+	s.mu.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrIntentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	record := &ApprovalRecord{}
+	err = json.Unmarshal(encoded, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Approver is a person (or system) allowed to approve withdrawal intents.
+// PublicKey must be *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+type Approver struct {
+	ID        string
+	PublicKey crypto.PublicKey
+}
+
+// ApprovalWorkflow collects approvals for withdrawal intents and only calls Withdrawal
+// once Quorum distinct registered approvers signed the intent.
+type ApprovalWorkflow struct {
+	client    *Client
+	store     ApprovalStore
+	quorum    int
+	approvers map[string]crypto.PublicKey
+	mu        sync.Mutex
+}
+
+// NewApprovalWorkflow creates a workflow executing withdrawals with client.
+// store: required, where intents and approvals are persisted
+// quorum: required, number of distinct approvals needed, must not exceed the number of approvers
+// approvers: required, approvers allowed to sign intents
+func NewApprovalWorkflow(client *Client, store ApprovalStore, quorum int, approvers ...Approver) (*ApprovalWorkflow, error) {
+	if client == nil || store == nil {
+		return nil, errors.New("client and store are required")
+	}
+	if quorum < 1 || quorum > len(approvers) {
+		return nil, fmt.Errorf("quorum must be between 1 and %d", len(approvers))
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, approver := range approvers {
+		switch approver.PublicKey.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, fmt.Errorf("approver %s: %w", approver.ID, ErrUnsupportedKeyType)
+		}
+		if _, ok := keys[approver.ID]; ok {
+			return nil, fmt.Errorf("duplicate approver %s", approver.ID)
+		}
+		keys[approver.ID] = approver.PublicKey
+	}
+	return &ApprovalWorkflow{
+		client:    client,
+		store:     store,
+		quorum:    quorum,
+		approvers: keys,
+	}, nil
+}
+
+// Propose stores a new withdrawal intent and returns it with ID, RequestId, CreatedAt and ExpiresAt filled.
+// RequestId is kept if already set, so a retried execution never withdraws twice.
+// ExpiresAt is kept if set, otherwise the intent expires after DefaultIntentTTL.
+func (w *ApprovalWorkflow) Propose(intent WithdrawalIntent) (*WithdrawalIntent, error) {
+	if intent.Amount == "" || intent.CoinSymbol == "" || intent.Network == "" || intent.WithdrawalAddress == "" || intent.WalletID == "" {
+		return nil, errors.New("amount, coinSymbol, network, withdrawalAddress and walletId are required")
+	}
+	// Approvers sign the wallet id, never an alias which could be repointed later
+	walletId, err := w.client.Directory().Resolve(intent.WalletID)
+	if err != nil {
+		return nil, err
+	}
+	intent.WalletID = NewWalletID(walletId)
+	idBytes := make([]byte, 16)
+	_, err = rand.Read(idBytes)
+	if err != nil {
+		return nil, err
+	}
+	intent.ID = hex.EncodeToString(idBytes)
+	if intent.RequestId == 0 {
+		intent.RequestId = GetReqId()
+	}
+	now := time.Now()
+	intent.CreatedAt = now.UnixMilli()
+	if intent.ExpiresAt == 0 {
+		intent.ExpiresAt = now.Add(DefaultIntentTTL).UnixMilli()
+	}
+	if intent.ExpiresAt <= intent.CreatedAt {
+		return nil, errors.New("expiresAt must be in the future")
+	}
+	err = w.store.Save(&ApprovalRecord{
+		Intent: intent,
+		Digest: hex.EncodeToString(intent.Digest()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// Get returns the stored record of an intent.
+func (w *ApprovalWorkflow) Get(id string) (*ApprovalRecord, error) {
+	return w.store.Load(id)
+}
+
+// Approve adds the signature of approverId to an intent.
+// signature is the base64 encoded output of SignWithdrawalIntent.
+// It returns the number of valid approvals collected so far.
+func (w *ApprovalWorkflow) Approve(id string, approverId string, signature string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	record, err := w.loadVerified(id)
+	if err != nil {
+		return 0, err
+	}
+	if record.Executed {
+		return 0, ErrIntentExecuted
+	}
+	if record.Intent.Expired() {
+		return 0, ErrIntentExpired
+	}
+	key, ok := w.approvers[approverId]
+	if !ok {
+		return 0, ErrUnknownApprover
+	}
+	err = verifyIntentSignature(key, record.Intent.Digest(), signature)
+	if err != nil {
+		return 0, err
+	}
+	approvals := record.Approvals[:0]
+	for _, approval := range record.Approvals {
+		// A new signature from the same approver replaces the old one
+		if approval.ApproverID != approverId {
+			approvals = append(approvals, approval)
+		}
+	}
+	record.Approvals = append(approvals, Approval{
+		ApproverID: approverId,
+		Signature:  signature,
+		ApprovedAt: time.Now().UnixMilli(),
+	})
+	err = w.store.Save(record)
+	if err != nil {
+		return 0, err
+	}
+	return w.countValid(record), nil
+}
+
+// Execute sends the withdrawal once the intent collected enough valid approvals.
+// Every stored approval is verified again against the current intent, so edits in the store are detected.
+// If Ceffu rejects the requestId as duplicate (ErrorDuplicateReqID), the withdrawal of an earlier attempt
+// is fetched with GetWithdrawalDetailByRequestId and the intent is marked executed.
+// Expired intents are not sent anymore, only an earlier attempt is looked up.
+func (w *ApprovalWorkflow) Execute(id string) (*WithdrawalResp, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	record, err := w.loadVerified(id)
+	if err != nil {
+		return nil, err
+	}
+	if record.Executed {
+		return record.Result, ErrIntentExecuted
+	}
+	if w.countValid(record) < w.quorum {
+		return nil, ErrQuorumNotReached
+	}
+	intent := record.Intent
+	var resp *WithdrawalResp
+	if intent.Expired() {
+		if record.SentAt == 0 {
+			return nil, ErrIntentExpired
+		}
+		resp, err = w.client.recoverWithdrawal(intent.RequestId)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			return nil, ErrIntentExpired
+		}
+	} else {
+		if record.SentAt == 0 {
+			// Remember the attempt before sending, its response may be lost
+			record.SentAt = time.Now().UnixMilli()
+			if err = w.store.Save(record); err != nil {
+				return nil, err
+			}
+		}
+		resp, err = w.client.Withdrawal(intent.Amount, intent.CoinSymbol, intent.Memo, intent.Network, intent.WalletID, intent.WithdrawalAddress, intent.RequestId)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Code == ErrorDuplicateReqID {
+			original, err := w.client.recoverWithdrawal(intent.RequestId)
+			if err != nil {
+				return nil, err
+			}
+			if original != nil {
+				resp = original
+			}
+		}
+	}
+	record.Result = resp
+	record.Executed = resp.Code == CodeSuccess
+	err = w.store.Save(record)
+	if err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+func (w *ApprovalWorkflow) loadVerified(id string) (*ApprovalRecord, error) {
+	record, err := w.store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	if record.Intent.ID != id || hex.EncodeToString(record.Intent.Digest()) != record.Digest {
+		return nil, ErrIntentTampered
+	}
+	return record, nil
+}
+
+func (w *ApprovalWorkflow) countValid(record *ApprovalRecord) int {
+	digest := record.Intent.Digest()
+	seen := map[string]bool{}
+	for _, approval := range record.Approvals {
+		key, ok := w.approvers[approval.ApproverID]
+		if !ok || seen[approval.ApproverID] {
+			continue
+		}
+		if verifyIntentSignature(key, digest, approval.Signature) == nil {
+			seen[approval.ApproverID] = true
+		}
+	}
+	return len(seen)
+}
+
+// SignWithdrawalIntent signs the intent digest with an approver's private key.
+// signer must be an *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey.
+// The result is base64 encoded and can be passed to ApprovalWorkflow.Approve.
+func SignWithdrawalIntent(signer crypto.Signer, intent *WithdrawalIntent) (string, error) {
+	digest := intent.Digest()
+	var sign []byte
+	var err error
+	switch signer.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		sign, err = signer.Sign(rand.Reader, digest, crypto.SHA512)
+	case ed25519.PrivateKey:
+		// ed25519 signs the message itself instead of a prehashed digest
+		sign, err = signer.Sign(rand.Reader, digest, crypto.Hash(0))
+	default:
+		return "", ErrUnsupportedKeyType
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sign), nil
+}
+
+func verifyIntentSignature(key crypto.PublicKey, digest []byte, signature string) error {
+	sign, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidApproval
+	}
+	valid := false
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(k, crypto.SHA512, digest, sign) == nil
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(k, digest, sign)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, digest, sign)
+	default:
+		return ErrUnsupportedKeyType
+	}
+	if !valid {
+		return ErrInvalidApproval
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package ceffu
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestApprovalWorkflow(t *testing.T) {
+	withdrawals := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		withdrawals++
+		_, _ = w.Write([]byte(`{"code":"000000","message":"success","data":{"orderViewId":"1","status":10}}`))
+	})
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, strangerKey, _ := ed25519.GenerateKey(rand.Reader)
+	store := NewMemoryApprovalStore()
+	workflow, err := NewApprovalWorkflow(cl, store, 2,
+		Approver{ID: "alice", PublicKey: edKey.Public()},
+		Approver{ID: "bob", PublicKey: &ecKey.PublicKey},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intent, err := workflow.Propose(WithdrawalIntent{
+		Amount:            "100",
+		CoinSymbol:        "USDT",
+		Network:           "ETH",
+		WithdrawalAddress: "0xd3BdD5B82B4a75cb2081405C35B9DDd6875fdC03",
+		WalletID:          "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceSign, _ := SignWithdrawalIntent(edKey, intent)
+	bobSign, _ := SignWithdrawalIntent(ecKey, intent)
+	strangerSign, _ := SignWithdrawalIntent(strangerKey, intent)
+
+	if _, err = workflow.Approve(intent.ID, "bob", strangerSign); !errors.Is(err, ErrInvalidApproval) {
+		t.Fatalf("expected invalid approval, got %v", err)
+	}
+	if n, err := workflow.Approve(intent.ID, "alice", aliceSign); err != nil || n != 1 {
+		t.Fatalf("alice approval: %d %v", n, err)
+	}
+	// Same approver twice must not reach quorum
+	if n, _ := workflow.Approve(intent.ID, "alice", aliceSign); n != 1 {
+		t.Fatalf("duplicate approval counted: %d", n)
+	}
+	if _, err = workflow.Execute(intent.ID); !errors.Is(err, ErrQuorumNotReached) {
+		t.Fatalf("expected quorum not reached, got %v", err)
+	}
+	if n, err := workflow.Approve(intent.ID, "bob", bobSign); err != nil || n != 2 {
+		t.Fatalf("bob approval: %d %v", n, err)
+	}
+
+	// Tamper with the stored amount
+	record, _ := store.Load(intent.ID)
+	record.Intent.Amount = "100000"
+	_ = store.Save(record)
+	if _, err = workflow.Execute(intent.ID); !errors.Is(err, ErrIntentTampered) {
+		t.Fatalf("expected tampered intent, got %v", err)
+	}
+	// Tampering with the digest as well is caught by the signatures
+	record.Digest = hexDigest(&record.Intent)
+	_ = store.Save(record)
+	if _, err = workflow.Execute(intent.ID); !errors.Is(err, ErrQuorumNotReached) {
+		t.Fatalf("expected quorum not reached on tampered intent, got %v", err)
+	}
+	if withdrawals != 0 {
+		t.Fatalf("withdrawal sent for tampered intent")
+	}
+
+	record.Intent = *intent
+	record.Digest = hexDigest(intent)
+	_ = store.Save(record)
+	resp, err := workflow.Execute(intent.ID)
+	if err != nil || resp.Code != CodeSuccess {
+		t.Fatalf("execute: %+v %v", resp, err)
+	}
+	if _, err = workflow.Execute(intent.ID); !errors.Is(err, ErrIntentExecuted) {
+		t.Fatalf("expected executed intent, got %v", err)
+	}
+	if withdrawals != 1 {
+		t.Fatalf("expected exactly one withdrawal, got %d", withdrawals)
+	}
+}
+
+func hexDigest(intent *WithdrawalIntent) string {
+	return hex.EncodeToString(intent.Digest())
+}
+
+func TestApprovalWorkflowDuplicateAndExpiry(t *testing.T) {
+	withdrawals, details := 0, 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			details++
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"orderViewId":"original","status":30,"transferType":10}}`))
+			return
+		}
+		withdrawals++
+		// The first attempt reached Ceffu but its response was lost
+		_, _ = w.Write([]byte(`{"code":"G20015","message":"duplicate request id"}`))
+	})
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	store := NewMemoryApprovalStore()
+	workflow, err := NewApprovalWorkflow(cl, store, 1, Approver{ID: "alice", PublicKey: key.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	propose := func() *WithdrawalIntent {
+		intent, err := workflow.Propose(WithdrawalIntent{Amount: "1", CoinSymbol: "USDT", Network: "ETH", WithdrawalAddress: "0x0", WalletID: "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, _ := SignWithdrawalIntent(key, intent)
+		if _, err = workflow.Approve(intent.ID, "alice", signature); err != nil {
+			t.Fatal(err)
+		}
+		return intent
+	}
+
+	intent := propose()
+	resp, err := workflow.Execute(intent.ID)
+	if err != nil || resp.Code != CodeSuccess || resp.Data.OrderViewID != "original" || resp.Data.Status != WithdrawStatusSuccess {
+		t.Fatalf("duplicate not recovered: %+v %v", resp, err)
+	}
+	if record, _ := store.Load(intent.ID); !record.Executed {
+		t.Fatal("recovered intent not marked executed")
+	}
+
+	// Expired intents are not sent, unless an earlier attempt has to be settled
+	expire := func(id string) *ApprovalRecord {
+		record, _ := store.Load(id)
+		record.Intent.ExpiresAt = record.Intent.CreatedAt
+		record.Digest = hexDigest(&record.Intent)
+		signature, _ := SignWithdrawalIntent(key, &record.Intent)
+		record.Approvals[0].Signature = signature
+		return record
+	}
+	stale := propose()
+	_ = store.Save(expire(stale.ID))
+	if _, err = workflow.Execute(stale.ID); !errors.Is(err, ErrIntentExpired) {
+		t.Fatalf("expected expired intent, got %v", err)
+	}
+	if _, err = workflow.Approve(stale.ID, "alice", ""); !errors.Is(err, ErrIntentExpired) {
+		t.Fatalf("expected expired intent, got %v", err)
+	}
+	sent := propose()
+	record := expire(sent.ID)
+	record.SentAt = record.Intent.CreatedAt
+	_ = store.Save(record)
+	if resp, err = workflow.Execute(sent.ID); err != nil || resp.Data.OrderViewID != "original" {
+		t.Fatalf("earlier attempt not settled: %+v %v", resp, err)
+	}
+	if withdrawals != 1 || details != 2 {
+		t.Fatalf("unexpected calls: %d withdrawals, %d details", withdrawals, details)
+	}
+}
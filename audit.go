@@ -0,0 +1,254 @@
+package ceffu
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry is a single signed request sent to Ceffu.
+// PrevHash and Hash chain entries together, so edited or removed entries can be detected.
+type AuditEntry struct {
+	Seq          uint64 `json:"seq"`
+	Time         int64  `json:"time"` // unix timestamp in milliseconds
+	Method       string `json:"method"`
+	Endpoint     string `json:"endpoint"`
+	Payload      string `json:"payload"` // json body or query string exactly as signed
+	Signature    string `json:"signature"`
+	RequestId    string `json:"requestId,omitempty"`
+	HttpStatus   int    `json:"httpStatus"`
+	ResponseCode string `json:"responseCode,omitempty"`
+	LatencyMs    int64  `json:"latencyMs"`
+	Error        string `json:"error,omitempty"`
+	PrevHash     string `json:"prevHash"`
+	Hash         string `json:"hash"`
+}
+
+// AuditSink receives every signed request made by the client.
+// Seq, PrevHash and Hash are left for the sink to fill.
+type AuditSink interface {
+	Record(entry *AuditEntry) error
+}
+
+// WithAuditSink records every signed request into sink
+func WithAuditSink(sink AuditSink) Option {
+	return func(c *Client) {
+		c.audit = sink
+	}
+}
+
+func (c *Client) recordAudit(signed *signedRequest, start time.Time, status int, body []byte, err error) {
+	entry := &AuditEntry{
+		Time:       start.UnixMilli(),
+		Method:     signed.Method,
+		Endpoint:   signed.Endpoint,
+		Payload:    signed.Payload,
+		Signature:  signed.Signature,
+		RequestId:  signed.RequestId,
+		HttpStatus: status,
+		LatencyMs:  time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	entry.ResponseCode = responseCode(body)
+	// The request has been sent already, so failing the call would be misleading
+	if auditErr := c.audit.Record(entry); auditErr != nil {
+		c.Logf("ceffu: failed to record audit entry for %s: %s", signed.Endpoint, auditErr)
+	}
+}
+
+// auditHash computes the chained hash of an entry, covering every field except Hash itself
+func auditHash(entry *AuditEntry) string {
+	unhashed := *entry
+	unhashed.Hash = ""
+	encoded, _ := json.Marshal(&unhashed)
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:])
+}
+
+// FileAuditLog is an append only, hash chained audit log stored as json lines.
+type FileAuditLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	seq      uint64
+	lastHash string
+}
+
+// OpenFileAuditLog opens or creates the audit log at path.
+// An existing log is verified first and new entries continue its chain.
+// A torn last entry, left by a crash while it was written, is cut off: Record never reported it as written.
+// Any other broken entry fails with an *AuditLogError.
+func OpenFileAuditLog(path string) (*FileAuditLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	head, count, err := repairAuditLog(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &FileAuditLog{
+		file:     file,
+		seq:      count,
+		lastHash: head,
+	}, nil
+}
+
+// Record appends entry to the log and syncs it to disk
+func (l *FileAuditLog) Record(entry *AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	entry.Seq = l.seq
+	entry.PrevHash = l.lastHash
+	entry.Hash = auditHash(entry)
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		l.seq--
+		return err
+	}
+	_, err = l.file.Write(append(encoded, '\n'))
+	if err != nil {
+		l.seq--
+		return err
+	}
+	l.lastHash = entry.Hash
+	return l.file.Sync()
+}
+
+// Head returns the hash of the last entry. Keep it somewhere safe to detect truncation of the log.
+func (l *FileAuditLog) Head() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastHash
+}
+
+func (l *FileAuditLog) Close() error {
+	return l.file.Close()
+}
+
+// repairAuditLog verifies the log in file and cuts off a torn last entry.
+// A last entry missing only its line break gets one, so the next entry starts on a new line.
+func repairAuditLog(file *os.File) (head string, count uint64, err error) {
+	head, count, end, err := verifyAuditEntries(file, nil)
+	var logErr *AuditLogError
+	if errors.As(err, &logErr) && logErr.Torn {
+		if err = file.Truncate(end); err != nil {
+			return "", 0, err
+		}
+	} else if err != nil {
+		return "", 0, err
+	}
+	if end > 0 {
+		last := make([]byte, 1)
+		if _, err = file.ReadAt(last, end-1); err != nil {
+			return "", 0, err
+		}
+		if last[0] != '\n' {
+			if _, err = file.Write([]byte{'\n'}); err != nil {
+				return "", 0, err
+			}
+		}
+	}
+	return head, count, nil
+}
+
+// AuditLogError describes the first broken entry found by VerifyAuditLog.
+// Torn is set when only the last line is incomplete, as left by a crash during Record,
+// rather than an entry that has been edited. OpenFileAuditLog removes such a line.
+type AuditLogError struct {
+	Line   int
+	Reason string
+	Torn   bool
+}
+
+func (e *AuditLogError) Error() string {
+	return fmt.Sprintf("audit log broken at line %d: %s", e.Line, e.Reason)
+}
+
+// VerifyAuditLog checks the hash chain of an audit log.
+// It returns the head hash and number of entries, or an *AuditLogError for the first edited,
+// inserted or deleted entry. Removing entries from the end can only be detected by comparing
+// the returned head with one recorded earlier, see VerifyAuditLogFile.
+func VerifyAuditLog(r io.Reader) (head string, count uint64, err error) {
+	head, count, _, err = verifyAuditEntries(r, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	return head, count, nil
+}
+
+// VerifyAuditLogFile verifies the audit log at path.
+// expectedHead is optional, if set the log must still contain the entry with this hash.
+func VerifyAuditLogFile(path string, expectedHead string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	found := expectedHead == ""
+	_, count, _, err := verifyAuditEntries(file, func(entry *AuditEntry) {
+		if entry.Hash == expectedHead {
+			found = true
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return count, errors.New("audit log does not contain expected head, entries have been removed")
+	}
+	return count, nil
+}
+
+// verifyAuditEntries checks the entries read from r. end is the offset right after the last valid entry,
+// it is returned along with an *AuditLogError marked Torn so the torn line can be cut off.
+func verifyAuditEntries(r io.Reader, visit func(entry *AuditEntry)) (head string, count uint64, end int64, err error) {
+	reader := bufio.NewReader(r)
+	line := 0
+	for {
+		read, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return "", 0, 0, readErr
+		}
+		if len(read) == 0 {
+			return head, count, end, nil
+		}
+		line++
+		entry := &AuditEntry{}
+		err = json.Unmarshal(bytes.TrimSuffix(read, []byte{'\n'}), entry)
+		if err != nil {
+			if readErr == io.EOF {
+				// Entries are written with their line break in one write, an unterminated
+				// malformed last line is a write interrupted by a crash
+				return head, count, end, &AuditLogError{Line: line, Reason: "torn entry: " + err.Error(), Torn: true}
+			}
+			return "", 0, 0, &AuditLogError{Line: line, Reason: "malformed entry: " + err.Error()}
+		}
+		if entry.Seq != count+1 {
+			return "", 0, 0, &AuditLogError{Line: line, Reason: fmt.Sprintf("expected seq %d, got %d", count+1, entry.Seq)}
+		}
+		if entry.PrevHash != head {
+			return "", 0, 0, &AuditLogError{Line: line, Reason: "previous hash mismatch"}
+		}
+		if auditHash(entry) != entry.Hash {
+			return "", 0, 0, &AuditLogError{Line: line, Reason: "entry hash mismatch"}
+		}
+		if visit != nil {
+			visit(entry)
+		}
+		head = entry.Hash
+		count++
+		end += int64(len(read))
+	}
+}
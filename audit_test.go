@@ -0,0 +1,131 @@
+package ceffu
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := OpenFileAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":"000000","message":"success","data":{}}`))
+	})
+	WithAuditSink(auditLog)(cl)
+	for i := 0; i < 3; i++ {
+		_, err = cl.GetStatus(BusinessTypeDeposit, WalletTypePrime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = cl.CreateWallet("audit", int(WalletTypeIntPrime), 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := auditLog.Head()
+	_ = auditLog.Close()
+
+	count, err := VerifyAuditLogFile(path, head)
+	if err != nil || count != 4 {
+		t.Fatalf("verify: %d %v", count, err)
+	}
+	// Reopening continues the chain
+	auditLog, err = OpenFileAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = auditLog.Record(&AuditEntry{Endpoint: "manual"})
+	_ = auditLog.Close()
+	if count, err = VerifyAuditLogFile(path, head); err != nil || count != 5 {
+		t.Fatalf("verify after reopen: %d %v", count, err)
+	}
+
+	original, _ := os.ReadFile(path)
+	lines := bytes.SplitAfter(original, []byte("\n"))
+	if !bytes.Contains(lines[3], []byte(`"requestId":"42"`)) || !bytes.Contains(lines[3], []byte(`"responseCode":"000000"`)) {
+		t.Fatalf("unexpected entry %s", lines[3])
+	}
+
+	var logErr *AuditLogError
+	// Edited entry
+	edited := bytes.Replace(original, []byte("walletName"), []byte("walletNamf"), 1)
+	_ = os.WriteFile(path, edited, 0600)
+	if _, err = VerifyAuditLogFile(path, ""); !errors.As(err, &logErr) || logErr.Line != 4 {
+		t.Fatalf("expected edit at line 4, got %v", err)
+	}
+	// Deleted entry
+	_ = os.WriteFile(path, bytes.Join(append(lines[:1:1], lines[2:]...), nil), 0600)
+	if _, err = VerifyAuditLogFile(path, ""); !errors.As(err, &logErr) || logErr.Line != 2 {
+		t.Fatalf("expected deletion at line 2, got %v", err)
+	}
+	// Truncated log
+	_ = os.WriteFile(path, bytes.Join(lines[:2], nil), 0600)
+	if _, err = VerifyAuditLogFile(path, head); err == nil {
+		t.Fatal("expected truncation to be detected")
+	}
+}
+
+func TestFileAuditLogTornEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := OpenFileAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = auditLog.Record(&AuditEntry{Endpoint: "manual"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	head := auditLog.Head()
+	_ = auditLog.Close()
+	complete, _ := os.ReadFile(path)
+
+	// A crash while writing the third entry leaves part of it behind
+	_ = os.WriteFile(path, append(append([]byte{}, complete...), `{"seq":3,"time":17`...), 0600)
+	var logErr *AuditLogError
+	if _, err = VerifyAuditLogFile(path, head); !errors.As(err, &logErr) || !logErr.Torn || logErr.Line != 3 {
+		t.Fatalf("expected torn entry at line 3, got %v", err)
+	}
+	auditLog, err = OpenFileAuditLog(path)
+	if err != nil {
+		t.Fatalf("torn entry blocks the log: %v", err)
+	}
+	if err = auditLog.Record(&AuditEntry{Endpoint: "manual"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = auditLog.Close()
+	if count, err := VerifyAuditLogFile(path, head); err != nil || count != 3 {
+		t.Fatalf("verify after repair: %d %v", count, err)
+	}
+
+	// The entry was written completely but its line break was not
+	_ = os.WriteFile(path, bytes.TrimSuffix(complete, []byte("\n")), 0600)
+	auditLog, err = OpenFileAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = auditLog.Record(&AuditEntry{Endpoint: "manual"})
+	_ = auditLog.Close()
+	if count, err := VerifyAuditLogFile(path, head); err != nil || count != 3 {
+		t.Fatalf("verify after missing line break: %d %v", count, err)
+	}
+
+	// A broken entry that is followed by others is not a crash, the log stays blocked
+	lines := bytes.SplitAfter(complete, []byte("\n"))
+	_ = os.WriteFile(path, append(append([]byte(`{"seq":1,"ti`), '\n'), lines[1]...), 0600)
+	if _, err = OpenFileAuditLog(path); !errors.As(err, &logErr) || logErr.Torn {
+		t.Fatalf("expected malformed entry, got %v", err)
+	}
+	// So does an edited last entry
+	_ = os.WriteFile(path, bytes.Replace(complete, []byte(`"seq":2`), []byte(`"seq":3`), 1), 0600)
+	if _, err = OpenFileAuditLog(path); !errors.As(err, &logErr) || logErr.Torn {
+		t.Fatalf("expected edited entry, got %v", err)
+	}
+}
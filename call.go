@@ -0,0 +1,127 @@
+package ceffu
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// APIVersion selects the version path of an endpoint
+type APIVersion int
+
+const (
+	APIVersion1 APIVersion = 1 // Environment.VersionPath
+	APIVersion2 APIVersion = 2 // Environment.Version2Path
+)
+
+// versionPath returns the path of version v in the environment of the client
+func (c *Client) versionPath(v APIVersion) (string, error) {
+	switch v {
+	case APIVersion1:
+		return c.env.VersionPath, nil
+	case APIVersion2:
+		return c.env.Version2Path, nil
+	}
+	return "", fmt.Errorf("unsupported api version %d", v)
+}
+
+// Call sends req to an endpoint not wrapped by this package yet and decodes the data of the response into Resp.
+// method: required, http.MethodGet or http.MethodPost
+// version: required, APIVersion1 or APIVersion2
+// endpoint: required, path after the version, example: "wallet/list"
+// req: struct or map encoded with encoding/json. GET requests send its fields as query parameters,
+// so they must be strings, numbers or bools. A requestId is not added automatically.
+// Requests go through the same signing, retries, logging and tracing as every other call.
+// A non success code is returned as *APIError.
+func Call[Req any, Resp any](c *Client, method string, version APIVersion, endpoint string, req Req) (*Resp, error) {
+	data, err := c.call(method, version, endpoint, req)
+	if err != nil {
+		return nil, err
+	}
+	result := new(Resp)
+	if len(data) == 0 || string(data) == "null" {
+		return result, nil
+	}
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Do is Call for callers without static types: the response data is decoded into result, which may be nil
+func (c *Client) Do(method string, version APIVersion, endpoint string, params interface{}, result interface{}) error {
+	data, err := c.call(method, version, endpoint, params)
+	if err != nil || result == nil || len(data) == 0 || string(data) == "null" {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// call sends params and returns the raw data of the response
+func (c *Client) call(method string, version APIVersion, endpoint string, params interface{}) (json.RawMessage, error) {
+	versionPath, err := c.versionPath(version)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := requestFields(params)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	switch method {
+	case http.MethodGet:
+		query := make(map[string]string, len(fields))
+		for key, value := range fields {
+			switch v := value.(type) {
+			case nil:
+			case string:
+				query[key] = v
+			case json.Number:
+				query[key] = v.String()
+			case bool:
+				query[key] = strconv.FormatBool(v)
+			default:
+				return nil, fmt.Errorf("query parameter %s must be a string, number or bool", key)
+			}
+		}
+		body, err = c.getVersion(versionPath, endpoint, query)
+	case http.MethodPost:
+		body, err = c.postVersion(versionPath, endpoint, fields)
+	default:
+		return nil, fmt.Errorf("unsupported method %s", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := decodeEnvelope[json.RawMessage](body)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Unwrap()
+}
+
+// requestFields encodes params with encoding/json and returns its top level fields.
+// Numbers are kept as json.Number, so int64 ids are sent exactly.
+func requestFields(params interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if params == nil {
+		return fields, nil
+	}
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	if string(encoded) == "null" {
+		return fields, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	err = decoder.Decode(&fields)
+	if err != nil {
+		return nil, fmt.Errorf("request must encode to a json object: %w", err)
+	}
+	return fields, nil
+}
@@ -0,0 +1,67 @@
+package ceffu
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	var query map[string]string
+	var posted map[string]interface{}
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v2/wallet/new/endpoint":
+			query = map[string]string{}
+			for key := range r.URL.Query() {
+				query[key] = r.URL.Query().Get(key)
+			}
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"walletId":7,"name":"main"}}`))
+		case "/open-api/v1/wallet/new/action":
+			decoder := json.NewDecoder(r.Body)
+			decoder.UseNumber()
+			_ = decoder.Decode(&posted)
+			_, _ = w.Write([]byte(`{"code":"G20015","message":"duplicate request id"}`))
+		}
+	})
+
+	type request struct {
+		WalletID int64  `json:"walletId"`
+		Coin     string `json:"coinSymbol,omitempty"`
+		Active   bool   `json:"active"`
+	}
+	type response struct {
+		WalletID int64  `json:"walletId"`
+		Name     string `json:"name"`
+	}
+	resp, err := Call[request, response](cl, http.MethodGet, APIVersion2, "wallet/new/endpoint", request{WalletID: 7, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.WalletID != 7 || resp.Name != "main" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if query["walletId"] != "7" || query["active"] != "true" || query["timestamp"] == "" {
+		t.Fatalf("unexpected query %v", query)
+	}
+	if _, ok := query["coinSymbol"]; ok {
+		t.Fatal("omitted field sent")
+	}
+
+	err = cl.Do(http.MethodPost, APIVersion1, "wallet/new/action", map[string]interface{}{"requestId": int64(4611686018427387905)}, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != ErrorDuplicateReqID {
+		t.Fatalf("expected api error, got %v", err)
+	}
+	if posted["requestId"].(json.Number).String() != "4611686018427387905" {
+		t.Fatalf("request id not sent exactly: %v", posted["requestId"])
+	}
+
+	if err = cl.Do(http.MethodGet, APIVersion1, "wallet/x", map[string]interface{}{"nested": []int{1}}, nil); err == nil {
+		t.Fatal("nested query parameter accepted")
+	}
+	if err = cl.Do(http.MethodDelete, APIVersion1, "wallet/x", nil, nil); err == nil {
+		t.Fatal("unsupported method accepted")
+	}
+}
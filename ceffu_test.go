@@ -7,13 +7,14 @@ import (
 	"os"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestGetDeposit(t *testing.T) {
 	apiKey, _ := os.LookupEnv("CEFFU_API_KEY")
 	apiSecret, _ := os.LookupEnv("CEFFU_API_SECRET")
 	depositTx, _ := os.LookupEnv("CEFFU_TX")
-	cl, err := New(apiKey, apiSecret, http.DefaultClient, nil, CeffuApiBaseUrl)
+	cl, err := New(apiKey, apiSecret, http.DefaultClient, nil, "")
 	if err != nil {
 		panic(err)
 	}
@@ -31,41 +32,33 @@ func TestCeffuClient(t *testing.T) {
 	// Load Ceffu Args from env
 	apiKey, _ := os.LookupEnv("CEFFU_API_KEY")
 	apiSecret, _ := os.LookupEnv("CEFFU_API_SECRET")
-	cl, err := New(apiKey, apiSecret, http.DefaultClient, nil, CeffuApiBaseUrl)
+	cl, err := New(apiKey, apiSecret, http.DefaultClient, nil, "")
 	if err != nil {
 		panic(err)
 	}
-	list, err := cl.GetWalletList(10, 1)
+	walletId, err := cl.Directory().Resolve("hybird_test_ent")
 	if err != nil {
 		t.Error(err)
 	}
-	t.Log(list)
-	// Find a wallet with name hybird_test_ent
-	var walletId int64
-	for _, datum := range list.Data.Data {
-		if datum.WalletName == "hybird_test_ent" {
-			t.Log(datum)
-			walletId = datum.WalletID
-		}
-	}
+	t.Log(cl.Directory().Get(walletId))
 	detail, err := cl.GetDepositDetail("0x49b865a694d13d92c22555a4e024171752479b3265af56fd8e38d72dce79ce75")
 	if err != nil {
 		return
 	}
 	t.Log(detail)
 	// Get wallet charge address
-	address, err := cl.GetDepositAddress("ETH", "ETH", fmt.Sprintf("%d", walletId))
+	address, err := cl.GetDepositAddress("ETH", "ETH", NewWalletID(walletId))
 	if err != nil {
 		t.Error(err)
 	}
 	t.Log(address)
 	// Get Balance
-	summary, err := cl.GetAssetSummary(fmt.Sprintf("%d", walletId))
+	summary, err := cl.GetAssetSummary(NewWalletID(walletId))
 	if err != nil {
 		t.Error(err)
 	}
 	t.Log(summary)
-	details, err := cl.GetAssetDetails("USDT", "ETH", fmt.Sprintf("%d", walletId), 10, 1)
+	details, err := cl.GetAssetDetails("USDT", "ETH", NewWalletID(walletId), 10, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -76,7 +69,7 @@ func TestGetMirrorXInfo(t *testing.T) {
 	// Load Ceffu Args from env
 	apiKey, _ := os.LookupEnv("CEFFU_API_KEY")
 	apiSecret, _ := os.LookupEnv("CEFFU_API_SECRET")
-	cl, err := New(apiKey, apiSecret, http.DefaultClient, nil, CeffuApiBaseUrl)
+	cl, err := New(apiKey, apiSecret, http.DefaultClient, nil, "", AllowProductionMutations())
 	if err != nil {
 		panic(err)
 	}
@@ -85,14 +78,21 @@ func TestGetMirrorXInfo(t *testing.T) {
 		t.Error(err)
 	}
 	t.Log(list)
-	mirrorXLinkIdActive := 11282
-	orders, err := cl.GetMirrorXDelegationOrders(fmt.Sprintf("%d", mirrorXLinkIdActive), "", 0, 0, 0, 10, 1)
+	mirrorXLinkIdActive := MirrorXLinkID("11282")
+	orders, err := cl.GetMirrorXDelegationOrders(&MirrorXDelegationOrdersQuery{
+		MirrorXLinkId: mirrorXLinkIdActive,
+		StartTime:     time.Now().Add(-30 * 24 * time.Hour),
+	})
 	if err != nil {
 		t.Error(err)
 	}
 	t.Log(orders)
 	// Get MirrorX Order Detail
-	amount, err := cl.GetMirrorXAvailableAmount("11282", "USDT", MirrorXOrderTypeDeposit)
+	amount, err := cl.GetMirrorXAvailableAmount(&MirrorXAvailableAmountQuery{
+		MirrorXLinkId: mirrorXLinkIdActive,
+		CoinSymbol:    "USDT",
+		OrderType:     MirrorXOrderTypeDeposit,
+	})
 	if err != nil {
 		t.Error(err)
 	}
@@ -100,7 +100,7 @@ func TestGetMirrorXInfo(t *testing.T) {
 	// Create Mirror Using API
 	order, err := cl.CreateMirrorXOrder(&CreateMirrorXOrderReq{
 		MirrorXLinkId: mirrorXLinkIdActive,
-		OrderType:     int(MirrorXOrderTypeDeposit),
+		OrderType:     MirrorXOrderTypeDeposit,
 		CoinSymbol:    "USDT",
 		Amount:        amount.Data.MaxAvailableAmount,
 		RequestId:     "",
@@ -114,25 +114,17 @@ func TestGetMirrorXInfo(t *testing.T) {
 func TestWithdraw(t *testing.T) {
 	apiKey, _ := os.LookupEnv("CEFFU_API_KEY")
 	apiSecret, _ := os.LookupEnv("CEFFU_API_SECRET")
-	cl, err := New(apiKey, apiSecret, http.DefaultClient, nil, CeffuApiBaseUrl)
+	cl, err := New(apiKey, apiSecret, http.DefaultClient, nil, "", AllowProductionMutations())
 	if err != nil {
 		panic(err)
 	}
-	list, err := cl.GetWalletList(10, 1)
+	walletId, err := cl.Directory().Resolve("hybird_test_ent")
 	if err != nil {
 		t.Error(err)
 	}
-	t.Log(list)
-	// Find a wallet with name hybird_test_ent
-	var walletId int64
-	for _, datum := range list.Data.Data {
-		if datum.WalletName == "hybird_test_ent" {
-			t.Log(datum)
-			walletId = datum.WalletID
-		}
-	}
+	t.Log(cl.Directory().Get(walletId))
 	// Get USDC Amount
-	ret, _ := cl.GetAssetDetails("USDT", "ETH", fmt.Sprintf("%d", walletId), 10, 1)
+	ret, _ := cl.GetAssetDetails("USDT", "ETH", NewWalletID(walletId), 10, 1)
 	var usdcAmount float64
 	for _, datum := range ret.Data.Data {
 		if datum.CoinSymbol == "USDT" {
@@ -140,7 +132,7 @@ func TestWithdraw(t *testing.T) {
 		}
 	}
 	usdcAmountInt := usdcAmount
-	fee, err := cl.GetWithdrawalFee(strconv.FormatInt(walletId, 10), "USDT", "ETH", fmt.Sprintf("%f", usdcAmountInt))
+	fee, err := cl.GetWithdrawalFee(NewWalletID(walletId), "USDT", "ETH", fmt.Sprintf("%f", usdcAmountInt))
 	if err != nil {
 		t.Error(err)
 	}
@@ -148,14 +140,14 @@ func TestWithdraw(t *testing.T) {
 	feeAmount, _ := strconv.ParseFloat(fee.Data.FeeAmount, 64)
 	// Get Fee From Resp & Call Withdraw
 	outAccount := "0xd3BdD5B82B4a75cb2081405C35B9DDd6875fdC03"
-	rq, err := cl.Withdrawal(fmt.Sprintf("%f", usdcAmountInt-feeAmount), "USDT", "", "ETH", walletId, outAccount)
+	rq, err := cl.Withdrawal(fmt.Sprintf("%f", usdcAmountInt-feeAmount), "USDT", "", "ETH", NewWalletID(walletId), outAccount)
 	t.Logf("%+v", rq)
 }
 
 func TestGetWithdraw(t *testing.T) {
 	apiKey, _ := os.LookupEnv("CEFFU_API_KEY")
 	apiSecret, _ := os.LookupEnv("CEFFU_API_SECRET")
-	cl, err := New(apiKey, apiSecret, http.DefaultClient, nil, CeffuApiBaseUrl)
+	cl, err := New(apiKey, apiSecret, http.DefaultClient, nil, "")
 	if err != nil {
 		panic(err)
 	}
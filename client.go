@@ -1,69 +1,106 @@
 package ceffu
 
 import (
+	"context"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/base64"
-	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"time"
 )
 
 type Client struct {
-	key     *rsa.PrivateKey
-	apiKey  string
-	http    *http.Client
-	logger  *log.Logger
-	baseUrl string
+	credentials CredentialProvider
+	http        *http.Client
+	logger      *log.Logger
+	env         Environment
+	audit       AuditSink
+	metrics     *Metrics
+	tracer      Tracer
+	ctx         context.Context
+	limiter     *RateLimiter
+
+	allowMutations   bool
+	withdrawalPolicy *WithdrawalPolicy
+	directory        *WalletDirectory
+
+	slog      *slog.Logger
+	logConfig LogConfig
+
+	maxResponseSize int64
+	maxRetries      int
+	retryBackoff    time.Duration
 }
 
+// Option configures optional Client behaviour, see the With* functions
+type Option func(*Client)
+
 // New creates a new Client from a base64 encoded x509 private key.
 // The key must be in PKCS8 format. Also, the key must be RSA.
 // x509KeyEncoded is the base64 encoded x509 private key. aka, the part between BEGIN PRIVATE KEY line and END PRIVATE KEY line.
 // client is the http client to use. If nil, http.DefaultClient is used.
 // logger is the logger to use. If nil, no logging is done.
-// baseUrl is the base url to use. If empty, the default url is used.
-func New(apiKey string, x509KeyBase64 string, client *http.Client, logger *log.Logger, baseUrl string) (*Client, error) {
-	// Base 64 Decode x509KeyEncoded
-	decodedLength := base64.StdEncoding.DecodedLen(len(x509KeyBase64))
-	decodedBytes := make([]byte, decodedLength)
-	decodedLength, err :=
-		base64.StdEncoding.Decode(decodedBytes, []byte(x509KeyBase64))
-	if err != nil {
-		return nil, err
-	}
-	decodedBytes = decodedBytes[:decodedLength]
-	key, err := x509.ParsePKCS8PrivateKey(decodedBytes)
+// baseUrl is the base url to use. If empty, the environment named by CEFFU_ENV is used, production by default.
+// opts are optional settings applied after the defaults.
+func New(apiKey string, x509KeyBase64 string, client *http.Client, logger *log.Logger, baseUrl string, opts ...Option) (*Client, error) {
+	credential, err := NewCredential(apiKey, x509KeyBase64, time.Time{})
 	if err != nil {
 		return nil, err
 	}
-	// Try Casting to RSA
-	keyRsa := key.(*rsa.PrivateKey)
-	if keyRsa == nil {
-		return nil, errors.New("key is not RSA")
+	return NewWithCredentials(StaticCredentials(credential), client, logger, baseUrl, opts...)
+}
+
+// NewWithCredentials creates a new Client signing with the credentials of provider, for example RotatingCredentials.
+// The other parameters are the same as for New.
+func NewWithCredentials(provider CredentialProvider, client *http.Client, logger *log.Logger, baseUrl string, opts ...Option) (*Client, error) {
+	if provider == nil {
+		return nil, ErrNoCredentials
 	}
 	// If no client provided, use default
 	if client == nil {
 		client = http.DefaultClient
 	}
+	c := &Client{
+		credentials: provider,
+		http:        client,
+		logger:      logger,
+	}
+	c.directory = newWalletDirectory(c)
 	if baseUrl == "" {
-		baseUrl = CeffuApiBaseUrl
+		env, err := EnvironmentFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		WithEnvironment(env)(c)
+	} else {
+		WithEnvironment(CustomEnvironment(baseUrl))(c)
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
-	return &Client{
-		apiKey:  apiKey,
-		baseUrl: baseUrl,
-		key:     keyRsa,
-		http:    client,
-		logger:  logger,
-	}, nil
+	if err := c.env.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
+// GetPublicKey returns the public key of the current credential, empty if it is not an RSA key
 func (c *Client) GetPublicKey() rsa.PublicKey {
-	return c.key.PublicKey
+	credentials := c.credentials.Credentials()
+	if len(credentials) > 0 {
+		if public, ok := credentials[0].Signer.Public().(*rsa.PublicKey); ok {
+			return *public
+		}
+	}
+	return rsa.PublicKey{}
 }
 
+// Logf logs a message to the logger given to New, or to the slog handler set with WithSlog
 func (c *Client) Logf(format string, v ...interface{}) {
 	if c.logger != nil {
 		c.logger.Printf(format, v...)
+	} else if c.slog != nil {
+		c.slog.Warn(fmt.Sprintf(format, v...))
 	}
 }
@@ -0,0 +1,442 @@
+package ceffu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as a string like "30s" or "1h30m" in config files
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config describes a fully wired Client, see LoadConfig and NewFromConfig.
+// Every string may reference environment variables as ${NAME} or ${NAME:-default}.
+type Config struct {
+	Environment EnvironmentConfig `json:"environment"`
+	Credentials CredentialsConfig `json:"credentials"`
+	HTTP        HTTPConfig        `json:"http"`
+	Retry       RetryConfig       `json:"retry"`
+	RateLimit   RateLimitConfig   `json:"rateLimit"`
+	// Wallets maps aliases to wallet ids, see WithWalletAliases
+	Wallets    map[string]int64 `json:"wallets,omitempty"`
+	Withdrawal WithdrawalPolicy `json:"withdrawal"`
+	Watchers   WatchersConfig   `json:"watchers"`
+}
+
+// EnvironmentConfig selects the Environment of the client
+type EnvironmentConfig struct {
+	// Name is production, sandbox or custom, empty selects the environment named by CEFFU_ENV
+	Name string `json:"name,omitempty"`
+	// BaseUrl replaces the base url of the environment, required for sandbox and custom
+	BaseUrl                  string `json:"baseUrl,omitempty"`
+	PageLimit                int    `json:"pageLimit,omitempty"`
+	MaxPageLimit             int    `json:"maxPageLimit,omitempty"`
+	AllowProductionMutations bool   `json:"allowProductionMutations,omitempty"`
+}
+
+// CredentialsConfig is either an API key and private key, or a File read by FileCredentialLoader
+type CredentialsConfig struct {
+	ApiKey     string     `json:"apiKey,omitempty"`
+	PrivateKey string     `json:"privateKey,omitempty"` // base64 encoded PKCS8 RSA key, see New
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	File       string     `json:"file,omitempty"`
+	// ReloadInterval is how often File is reread by RunWatchers, 0 disables reloading
+	ReloadInterval Duration `json:"reloadInterval,omitempty"`
+	Overlap        Duration `json:"overlap,omitempty"`    // see RotationConfig
+	WarnBefore     Duration `json:"warnBefore,omitempty"` // see RotationConfig
+}
+
+// HTTPConfig configures the http client of the client
+type HTTPConfig struct {
+	Timeout         Duration `json:"timeout,omitempty"` // default no timeout
+	MaxResponseSize int64    `json:"maxResponseSize,omitempty"`
+}
+
+// RetryConfig configures WithRetry
+type RetryConfig struct {
+	MaxRetries int      `json:"maxRetries,omitempty"`
+	Backoff    Duration `json:"backoff,omitempty"`
+}
+
+// RateLimitConfig configures the client side rate limit, 0 calls per second disables it
+type RateLimitConfig struct {
+	PerSecond float64 `json:"perSecond,omitempty"`
+	Burst     int     `json:"burst,omitempty"`
+}
+
+// WatchersConfig configures the background jobs started by RunWatchers, nil jobs are not started
+type WatchersConfig struct {
+	MirrorX *MirrorXWatcherConfig `json:"mirrorX,omitempty"`
+	Gauges  *GaugesWatcherConfig  `json:"gauges,omitempty"`
+}
+
+// MirrorXWatcherConfig configures a MirrorXMonitor
+type MirrorXWatcherConfig struct {
+	Interval      Duration          `json:"interval,omitempty"`
+	Thresholds    map[string]string `json:"thresholds,omitempty"`
+	OrderLookback Duration          `json:"orderLookback,omitempty"`
+}
+
+// GaugesWatcherConfig configures Metrics.RunGauges
+type GaugesWatcherConfig struct {
+	Interval           Duration `json:"interval"`
+	Balances           bool     `json:"balances,omitempty"`
+	PendingWithdrawals bool     `json:"pendingWithdrawals,omitempty"`
+	PendingLookback    Duration `json:"pendingLookback,omitempty"`
+	MirrorXPositions   bool     `json:"mirrorXPositions,omitempty"`
+}
+
+var configVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandConfigString replaces ${NAME} and ${NAME:-default} with environment variables.
+// Variables which are not set and have no default are returned in missing.
+func expandConfigString(s string, missing map[string]bool) string {
+	return configVariable.ReplaceAllStringFunc(s, func(match string) string {
+		groups := configVariable.FindStringSubmatch(match)
+		if value, ok := os.LookupEnv(groups[1]); ok {
+			return value
+		}
+		if groups[2] != "" {
+			return groups[3]
+		}
+		missing[groups[1]] = true
+		return ""
+	})
+}
+
+func expandConfigValue(value interface{}, missing map[string]bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		return expandConfigString(v, missing)
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			expanded[expandConfigString(key, missing)] = expandConfigValue(item, missing)
+		}
+		return expanded
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandConfigValue(item, missing)
+		}
+		return v
+	}
+	return value
+}
+
+// ParseConfig parses a JSON config, expands environment variables in its strings and validates it.
+// Unknown fields are an error.
+func ParseConfig(data []byte) (*Config, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	missing := map[string]bool{}
+	expanded, err := json.Marshal(expandConfigValue(raw, missing))
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("config: environment variables not set: %s", strings.Join(names, ", "))
+	}
+	config := &Config{}
+	decoder = json.NewDecoder(bytes.NewReader(expanded))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadConfig reads and validates a JSON config file, see ParseConfig
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// environment returns the Environment selected by the config
+func (cfg *Config) environment() (Environment, error) {
+	name, baseUrl := cfg.Environment.Name, cfg.Environment.BaseUrl
+	if name == "" {
+		name = os.Getenv(EnvEnvironment)
+		if baseUrl == "" {
+			baseUrl = os.Getenv(EnvBaseUrl)
+		}
+	}
+	env, err := LookupEnvironment(name)
+	if err != nil {
+		return Environment{}, err
+	}
+	if baseUrl != "" {
+		env.BaseUrl = strings.TrimSuffix(baseUrl, "/")
+		if env.Name == "custom" {
+			env.Production = env.BaseUrl == CeffuApiBaseUrl
+		}
+	}
+	if cfg.Environment.PageLimit != 0 {
+		env.PageLimit = cfg.Environment.PageLimit
+	}
+	if cfg.Environment.MaxPageLimit != 0 {
+		env.MaxPageLimit = cfg.Environment.MaxPageLimit
+	}
+	return env, env.Validate()
+}
+
+// credential returns the initial credential, read from File if set
+func (cfg *Config) credential() (*Credential, error) {
+	credentials := cfg.Credentials
+	if credentials.File != "" {
+		return FileCredentialLoader(credentials.File)()
+	}
+	var expiresAt time.Time
+	if credentials.ExpiresAt != nil {
+		expiresAt = *credentials.ExpiresAt
+	}
+	return NewCredential(credentials.ApiKey, credentials.PrivateKey, expiresAt)
+}
+
+// Validate checks the whole config, including that the private key can be parsed
+func (cfg *Config) Validate() error {
+	credentials := cfg.Credentials
+	if credentials.File != "" && (credentials.ApiKey != "" || credentials.PrivateKey != "") {
+		return errors.New("config: credentials must be either a file or an api key and private key")
+	}
+	if credentials.File == "" && (credentials.ApiKey == "" || credentials.PrivateKey == "") {
+		return errors.New("config: credentials need an api key and private key, or a file")
+	}
+	if credentials.File == "" && credentials.ReloadInterval != 0 {
+		return errors.New("config: credentials reloadInterval needs a file")
+	}
+	credential, err := cfg.credential()
+	if err == nil {
+		err = credential.validate()
+	}
+	if err != nil {
+		return fmt.Errorf("config: credentials: %w", err)
+	}
+	if _, err = cfg.environment(); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	durations := map[string]Duration{
+		"credentials.reloadInterval": credentials.ReloadInterval,
+		"credentials.overlap":        credentials.Overlap,
+		"credentials.warnBefore":     credentials.WarnBefore,
+		"http.timeout":               cfg.HTTP.Timeout,
+		"retry.backoff":              cfg.Retry.Backoff,
+	}
+	if mirrorX := cfg.Watchers.MirrorX; mirrorX != nil {
+		durations["watchers.mirrorX.interval"] = mirrorX.Interval
+		durations["watchers.mirrorX.orderLookback"] = mirrorX.OrderLookback
+		for coin, threshold := range mirrorX.Thresholds {
+			if _, err = parseAmount(threshold); err != nil {
+				return fmt.Errorf("config: watchers.mirrorX threshold of %s: %w", coin, err)
+			}
+		}
+	}
+	if gauges := cfg.Watchers.Gauges; gauges != nil {
+		if gauges.Interval <= 0 {
+			return errors.New("config: watchers.gauges.interval is required")
+		}
+		durations["watchers.gauges.pendingLookback"] = gauges.PendingLookback
+	}
+	for name, duration := range durations {
+		if duration < 0 {
+			return fmt.Errorf("config: %s must not be negative", name)
+		}
+	}
+	if cfg.HTTP.MaxResponseSize < 0 {
+		return errors.New("config: http.maxResponseSize must not be negative")
+	}
+	if cfg.Retry.MaxRetries < 0 {
+		return errors.New("config: retry.maxRetries must not be negative")
+	}
+	if cfg.RateLimit.PerSecond < 0 || cfg.RateLimit.Burst < 0 {
+		return errors.New("config: rateLimit must not be negative")
+	}
+	if cfg.RateLimit.PerSecond != 0 {
+		if err = validateRateLimit(cfg.RateLimit.PerSecond); err != nil {
+			return fmt.Errorf("config: rateLimit: %w", err)
+		}
+	}
+	for alias, walletId := range cfg.Wallets {
+		if alias == "" || walletId <= 0 {
+			return fmt.Errorf("config: invalid wallet alias %q: %d", alias, walletId)
+		}
+	}
+	if err = cfg.Withdrawal.Validate(); err != nil {
+		return fmt.Errorf("config: withdrawal: %w", err)
+	}
+	return nil
+}
+
+// NewFromConfig validates config and creates a Client with everything it describes.
+// Credentials read from a file are wrapped in RotatingCredentials, whose events are logged by the client.
+// opts are applied last, for settings a config file can not hold such as WithSlog or WithMetrics.
+func NewFromConfig(config *Config, opts ...Option) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	env, _ := config.environment()
+	credential, err := config.credential()
+	if err != nil {
+		return nil, err
+	}
+	var provider CredentialProvider = StaticCredentials(credential)
+	var rotating *RotatingCredentials
+	if config.Credentials.File != "" {
+		rotating, err = NewRotatingCredentials(credential, RotationConfig{
+			Overlap:    time.Duration(config.Credentials.Overlap),
+			WarnBefore: time.Duration(config.Credentials.WarnBefore),
+			Loader:     FileCredentialLoader(config.Credentials.File),
+		})
+		if err != nil {
+			return nil, err
+		}
+		provider = rotating
+	}
+	options := []Option{
+		WithEnvironment(env),
+		WithRetry(config.Retry.MaxRetries, time.Duration(config.Retry.Backoff)),
+		WithWithdrawalPolicy(config.Withdrawal),
+		WithWalletAliases(config.Wallets),
+	}
+	if config.Environment.AllowProductionMutations {
+		options = append(options, AllowProductionMutations())
+	}
+	if config.HTTP.MaxResponseSize > 0 {
+		options = append(options, WithMaxResponseSize(config.HTTP.MaxResponseSize))
+	}
+	if config.RateLimit.PerSecond > 0 {
+		limiter, err := TryNewRateLimiter(config.RateLimit.PerSecond, config.RateLimit.Burst)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, WithRateLimiter(limiter))
+	}
+	httpClient := &http.Client{Timeout: time.Duration(config.HTTP.Timeout)}
+	client, err := NewWithCredentials(provider, httpClient, nil, env.BaseUrl, append(options, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	if rotating != nil {
+		rotating.config.OnEvent = func(event CredentialEvent) {
+			if event.Err != nil {
+				client.Logf("credentials %s: %v", event.Type, event.Err)
+				return
+			}
+			client.Logf("credentials %s: api key %s, expires at %s", event.Type, event.ApiKey, event.ExpiresAt.Format(time.RFC3339))
+		}
+	}
+	return client, nil
+}
+
+// WatcherHandlers receive the output of the watchers started by RunWatchers
+type WatcherHandlers struct {
+	// MirrorX receives the events of the MirrorX watcher, required if it is configured
+	MirrorX func(MirrorXEvent)
+	// Metrics receives the gauges of the gauges watcher, required if it is configured
+	Metrics *Metrics
+}
+
+// RunWatchers runs the credential reload and the watchers of the config for client until ctx is done.
+// client must have been created by NewFromConfig with the same config.
+func (cfg *Config) RunWatchers(ctx context.Context, client *Client, handlers WatcherHandlers) error {
+	var jobs []func(ctx context.Context) error
+	if rotating, ok := client.credentials.(*RotatingCredentials); ok && cfg.Credentials.ReloadInterval > 0 {
+		jobs = append(jobs, func(ctx context.Context) error {
+			return rotating.Watch(ctx, time.Duration(cfg.Credentials.ReloadInterval))
+		})
+	}
+	if mirrorX := cfg.Watchers.MirrorX; mirrorX != nil {
+		if handlers.MirrorX == nil {
+			return errors.New("the mirrorX watcher needs a handler")
+		}
+		monitor, err := NewMirrorXMonitor(client, MirrorXMonitorConfig{
+			Interval:      time.Duration(mirrorX.Interval),
+			Thresholds:    mirrorX.Thresholds,
+			OrderLookback: time.Duration(mirrorX.OrderLookback),
+		}, handlers.MirrorX)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, monitor.Run)
+	}
+	if gauges := cfg.Watchers.Gauges; gauges != nil {
+		if handlers.Metrics == nil {
+			return errors.New("the gauges watcher needs metrics")
+		}
+		gaugeConfig := MetricsGaugeConfig{
+			Balances:           gauges.Balances,
+			PendingWithdrawals: gauges.PendingWithdrawals,
+			PendingLookback:    time.Duration(gauges.PendingLookback),
+			MirrorXPositions:   gauges.MirrorXPositions,
+		}
+		jobs = append(jobs, func(ctx context.Context) error {
+			return handlers.Metrics.RunGauges(ctx, client, gaugeConfig, time.Duration(gauges.Interval))
+		})
+	}
+	if len(jobs) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(jobs))
+	for _, job := range jobs {
+		go func(job func(ctx context.Context) error) {
+			errs <- job(ctx)
+		}(job)
+	}
+	// The first job to stop stops the others
+	err := <-errs
+	cancel()
+	for i := 1; i < len(jobs); i++ {
+		<-errs
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package ceffu
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posts++
+		}
+		_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("TEST_CEFFU_URL", server.URL)
+	t.Setenv("TEST_CEFFU_KEY", newTestKey(t))
+
+	path := filepath.Join(t.TempDir(), "ceffu.json")
+	err := os.WriteFile(path, []byte(`{
+		"environment": {"name": "custom", "baseUrl": "${TEST_CEFFU_URL}"},
+		"credentials": {"apiKey": "${TEST_CEFFU_API_KEY:-config-key}", "privateKey": "${TEST_CEFFU_KEY}"},
+		"http": {"timeout": "10s"},
+		"retry": {"maxRetries": 2, "backoff": "100ms"},
+		"rateLimit": {"perSecond": 100, "burst": 5},
+		"wallets": {"treasury": 42},
+		"withdrawal": {"maxAmounts": {"USDT": "1000"}, "allowedAddresses": ["0xAbC"]},
+		"watchers": {"mirrorX": {"interval": "1m", "thresholds": {"USDT": "10"}}}
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.ApiKey() != "config-key" || client.Environment().BaseUrl != server.URL || client.Environment().Production ||
+		client.maxRetries != 2 || client.retryBackoff != 100*time.Millisecond || client.limiter == nil || client.http.Timeout != 10*time.Second {
+		t.Fatalf("client not wired from config: %+v", client)
+	}
+	if walletId, ok := client.WalletAlias("treasury"); !ok || walletId != 42 {
+		t.Fatalf("unexpected alias %d", walletId)
+	}
+
+	if _, err = client.Withdrawal("1000.5", "USDT", "", "ETH", "42", "0xabc"); !errors.Is(err, ErrWithdrawalPolicy) {
+		t.Fatalf("expected policy error, got %v", err)
+	}
+	if _, err = client.Withdrawal("10", "USDT", "", "ETH", "42", "0xdef"); !errors.Is(err, ErrWithdrawalPolicy) {
+		t.Fatalf("expected policy error, got %v", err)
+	}
+	if posts != 0 {
+		t.Fatal("refused withdrawal was sent")
+	}
+	if _, err = client.Withdrawal("1000", "USDT", "", "ETH", "42", "0xABC"); err != nil || posts != 1 {
+		t.Fatalf("allowed withdrawal failed: %v", err)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	t.Setenv("TEST_CEFFU_KEY", newTestKey(t))
+	credentialPath := filepath.Join(t.TempDir(), "credential.json")
+	err := os.WriteFile(credentialPath, []byte(`{"apiKey":"file-key","privateKey":"`+os.Getenv("TEST_CEFFU_KEY")+`"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := ParseConfig([]byte(`{"environment": {"name": "custom", "baseUrl": "http://localhost"},
+		"credentials": {"file": "` + credentialPath + `", "reloadInterval": "1m"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.credentials.(*RotatingCredentials); !ok || client.ApiKey() != "file-key" {
+		t.Fatal("file credentials not rotating")
+	}
+
+	base := `"environment": {"name": "custom", "baseUrl": "http://localhost"}, "credentials": {"apiKey": "k", "privateKey": "${TEST_CEFFU_KEY}"}`
+	for name, test := range map[string]struct {
+		config string
+		error  string
+	}{
+		"missing variable": {`{"credentials": {"apiKey": "${TEST_CEFFU_UNSET}", "privateKey": "${TEST_CEFFU_UNSET_TOO}"}}`, "TEST_CEFFU_UNSET, TEST_CEFFU_UNSET_TOO"},
+		"unknown field":    {`{` + base + `, "retries": 3}`, "unknown field"},
+		"bad duration":     {`{` + base + `, "http": {"timeout": 10}}`, "duration"},
+		"bad key":          {`{"environment": {"name": "custom", "baseUrl": "http://localhost"}, "credentials": {"apiKey": "k", "privateKey": "eA=="}}`, "credentials"},
+		"no base url":      {`{"environment": {"name": "custom"}, "credentials": {"apiKey": "k", "privateKey": "${TEST_CEFFU_KEY}"}}`, "base url"},
+		"bad policy":       {`{` + base + `, "withdrawal": {"maxAmounts": {"BTC": "lots"}}}`, "withdrawal"},
+		"gauges interval":  {`{` + base + `, "watchers": {"gauges": {"balances": true}}}`, "interval"},
+		"bad alias":        {`{` + base + `, "wallets": {"treasury": 0}}`, "alias"},
+		"rate too high":    {`{` + base + `, "rateLimit": {"perSecond": 2e9}}`, "rateLimit"},
+		"rate too low":     {`{` + base + `, "rateLimit": {"perSecond": 1e-12}}`, "rateLimit"},
+	} {
+		t.Setenv(EnvBaseUrl, "")
+		if _, err = ParseConfig([]byte(test.config)); err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: expected error containing %q, got %v", name, test.error, err)
+		}
+	}
+}
@@ -6,6 +6,9 @@ const CeffuVersionPath = "/open-api/v1/"
 const CeffuVersion2Path = "/open-api/v2/"
 const CeffuApiBaseUrl = "https://open-api.ceffu.com"
 
+// CodeSuccess is the response code returned by Ceffu when a request succeeded
+const CodeSuccess = "000000"
+
 // Error Codes: see https://apidoc.ceffu.io/apidoc/shared-c9ece2c6-3ab4-4667-bb7d-c527fb3dbf78/doc-338174
 
 const (
@@ -86,10 +89,17 @@ const (
 type TransferDirection int
 
 const (
+	TransferDirectionAll         TransferDirection = 0 // Only as a query filter
 	TransferDirectionIntDeposit  TransferDirection = 10
 	TransferDirectionIntWithdraw TransferDirection = 20
 )
 
+type ExchangeCode int
+
+const (
+	ExchangeCodeBinance ExchangeCode = 10
+)
+
 type TransferType int
 
 const (
@@ -100,6 +110,7 @@ const (
 type WithdrawStatus int
 
 const (
+	WithdrawStatusAll        WithdrawStatus = 0 // Only as a query filter
 	WithdrawStatusPending    WithdrawStatus = 10
 	WithdrawStatusProcessing WithdrawStatus = 20
 	WithdrawStatusSuccess    WithdrawStatus = 30
@@ -119,6 +130,7 @@ const (
 type SubWalletTransferStatus int
 
 const (
+	SubWalletTransferStatusAll        SubWalletTransferStatus = 0 // Only as a query filter
 	SubWalletTransferStatusPending    SubWalletTransferStatus = 10
 	SubWalletTransferStatusProcessing SubWalletTransferStatus = 20
 	SubWalletTransferStatusSuccess    SubWalletTransferStatus = 30
@@ -132,3 +144,12 @@ const (
 	MirrorXOrderTypeDeposit  MirrorXOrderType = 10
 	MirrorXOrderTypeWithdraw MirrorXOrderType = 20
 )
+
+type MirrorXOrderStatus int
+
+const (
+	MirrorXOrderStatusPending    MirrorXOrderStatus = 10
+	MirrorXOrderStatusProcessing MirrorXOrderStatus = 20
+	MirrorXOrderStatusSuccess    MirrorXOrderStatus = 30
+	MirrorXOrderStatusFailed     MirrorXOrderStatus = 99
+)
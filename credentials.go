@@ -0,0 +1,321 @@
+package ceffu
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNoCredentials is returned when a CredentialProvider has no credential to sign with
+var ErrNoCredentials = errors.New("no credentials")
+
+// Credential is an API key and the private key signing its requests
+type Credential struct {
+	ApiKey string
+	// Signer signs the SHA512 digest of a request, an *rsa.PrivateKey or a key held in an HSM
+	Signer crypto.Signer
+	// ExpiresAt is when Ceffu stops accepting the key, optional
+	ExpiresAt time.Time
+}
+
+// NewCredential creates a Credential from a base64 encoded PKCS8 RSA private key, see New.
+// expiresAt is optional.
+func NewCredential(apiKey string, x509KeyBase64 string, expiresAt time.Time) (*Credential, error) {
+	decoded, err := base64.StdEncoding.DecodeString(x509KeyBase64)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(decoded)
+	if err != nil {
+		return nil, err
+	}
+	keyRsa, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not RSA")
+	}
+	return &Credential{ApiKey: apiKey, Signer: keyRsa, ExpiresAt: expiresAt}, nil
+}
+
+func (cred *Credential) validate() error {
+	if cred == nil || cred.Signer == nil {
+		return ErrNoCredentials
+	}
+	if cred.ApiKey == "" {
+		return errors.New("api key is required")
+	}
+	return nil
+}
+
+// sign signs message with RSA PKCS1v15 over SHA512 and returns it base64 encoded
+func (cred *Credential) sign(message string) (string, error) {
+	hash := sha512.Sum512([]byte(message))
+	signature, err := cred.Signer.Sign(rand.Reader, hash[:], crypto.SHA512)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// same reports whether other has the same API key and public key
+func (cred *Credential) same(other *Credential) bool {
+	if cred.ApiKey != other.ApiKey {
+		return false
+	}
+	public, ok := cred.Signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && public.Equal(other.Signer.Public())
+}
+
+// maskApiKey returns the last 4 characters of an API key for logs and events
+func maskApiKey(apiKey string) string {
+	if len(apiKey) <= 4 {
+		return Redacted
+	}
+	return "****" + apiKey[len(apiKey)-4:]
+}
+
+// CredentialProvider supplies the credentials a Client signs with. It must be safe for concurrent use.
+type CredentialProvider interface {
+	// Credentials returns the credentials to sign with, the current one first.
+	// If Ceffu rejects a key the request is signed again with the next one,
+	// so the previous key can stay in use while a new one is activated.
+	Credentials() []*Credential
+}
+
+// CredentialReloader is a CredentialProvider that can fetch new credentials.
+// The client reloads when Ceffu answers ErrorApiKeyExpired and retries once if the credentials changed.
+type CredentialReloader interface {
+	CredentialProvider
+	Reload() (changed bool, err error)
+}
+
+type staticCredentials struct {
+	credential *Credential
+}
+
+func (s staticCredentials) Credentials() []*Credential {
+	return []*Credential{s.credential}
+}
+
+// StaticCredentials always signs with credential
+func StaticCredentials(credential *Credential) CredentialProvider {
+	return staticCredentials{credential: credential}
+}
+
+// WithCredentials signs requests with the credentials of provider instead of the key given to New
+func WithCredentials(provider CredentialProvider) Option {
+	return func(c *Client) {
+		c.credentials = provider
+	}
+}
+
+// ApiKey returns the current API key of the client
+func (c *Client) ApiKey() string {
+	credentials := c.credentials.Credentials()
+	if len(credentials) == 0 {
+		return ""
+	}
+	return credentials[0].ApiKey
+}
+
+type CredentialEventType string
+
+const (
+	CredentialEventExpiring     CredentialEventType = "expiring"     // The current key expires within RotationConfig.WarnBefore
+	CredentialEventExpired      CredentialEventType = "expired"      // The current key is past its expiry
+	CredentialEventRotated      CredentialEventType = "rotated"      // A new key became current
+	CredentialEventReloadFailed CredentialEventType = "reloadFailed" // The loader failed, see Err
+)
+
+// CredentialEvent is emitted by RotatingCredentials
+type CredentialEvent struct {
+	Type      CredentialEventType
+	Time      time.Time
+	ApiKey    string // last 4 characters only
+	ExpiresAt time.Time
+	Err       error
+}
+
+// CredentialLoader returns the latest credential, for example from a file or a secret store
+type CredentialLoader func() (*Credential, error)
+
+// FileCredentialLoader reads a credential from a JSON file of the form
+// {"apiKey": "...", "privateKey": "<base64 PKCS8>", "expiresAt": "2025-01-31T00:00:00Z"}, expiresAt is optional
+func FileCredentialLoader(path string) CredentialLoader {
+	return func() (*Credential, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var file struct {
+			ApiKey     string    `json:"apiKey"`
+			PrivateKey string    `json:"privateKey"`
+			ExpiresAt  time.Time `json:"expiresAt"`
+		}
+		if err = json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return NewCredential(file.ApiKey, file.PrivateKey, file.ExpiresAt)
+	}
+}
+
+// RotationConfig configures RotatingCredentials
+type RotationConfig struct {
+	// Overlap is how long after Rotate the previous key is tried when the current one is rejected, default 24 hours
+	Overlap time.Duration
+	// WarnBefore is how long before ExpiresAt a CredentialEventExpiring is emitted, default 7 days
+	WarnBefore time.Duration
+	// Loader is used by Reload and Watch, optional
+	Loader CredentialLoader
+	// OnEvent is called for every event, optional
+	OnEvent func(CredentialEvent)
+}
+
+// RotatingCredentials is a CredentialProvider whose key can be replaced while clients use it.
+// After a rotation the previous key stays available as a fallback for RotationConfig.Overlap.
+type RotatingCredentials struct {
+	config RotationConfig
+
+	mu            sync.Mutex
+	current       *Credential
+	previous      *Credential
+	previousUntil time.Time
+	// warned records the expiry events already emitted per API key
+	warned map[string]CredentialEventType
+}
+
+// NewRotatingCredentials starts with initial as the current credential
+func NewRotatingCredentials(initial *Credential, config RotationConfig) (*RotatingCredentials, error) {
+	if err := initial.validate(); err != nil {
+		return nil, err
+	}
+	if config.Overlap <= 0 {
+		config.Overlap = 24 * time.Hour
+	}
+	if config.WarnBefore <= 0 {
+		config.WarnBefore = 7 * 24 * time.Hour
+	}
+	return &RotatingCredentials{
+		config:  config,
+		current: initial,
+		warned:  map[string]CredentialEventType{},
+	}, nil
+}
+
+// Credentials returns the current credential, followed by the previous one during the overlap
+func (r *RotatingCredentials) Credentials() []*Credential {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.previous != nil && time.Now().Before(r.previousUntil) {
+		return []*Credential{r.current, r.previous}
+	}
+	return []*Credential{r.current}
+}
+
+// Current returns the current credential
+func (r *RotatingCredentials) Current() *Credential {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Rotate makes next the current credential, the current one becomes the fallback for RotationConfig.Overlap
+func (r *RotatingCredentials) Rotate(next *Credential) error {
+	if err := next.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.previous, r.current = r.current, next
+	r.previousUntil = time.Now().Add(r.config.Overlap)
+	r.mu.Unlock()
+	r.emit(CredentialEvent{Type: CredentialEventRotated, ApiKey: maskApiKey(next.ApiKey), ExpiresAt: next.ExpiresAt})
+	return nil
+}
+
+// Reload fetches a credential from RotationConfig.Loader and rotates to it if it differs from the current one.
+// A new expiry date of the same key is taken over without a rotation.
+func (r *RotatingCredentials) Reload() (bool, error) {
+	if r.config.Loader == nil {
+		return false, errors.New("no credential loader configured")
+	}
+	next, err := r.config.Loader()
+	if err == nil {
+		err = next.validate()
+	}
+	if err != nil {
+		r.emit(CredentialEvent{Type: CredentialEventReloadFailed, Err: err})
+		return false, err
+	}
+	r.mu.Lock()
+	if r.current.same(next) {
+		updated := *r.current
+		updated.ExpiresAt = next.ExpiresAt
+		r.current = &updated
+		r.mu.Unlock()
+		return false, nil
+	}
+	r.mu.Unlock()
+	return true, r.Rotate(next)
+}
+
+// CheckExpiry emits CredentialEventExpiring or CredentialEventExpired for the current key, each once per key
+func (r *RotatingCredentials) CheckExpiry() {
+	r.mu.Lock()
+	current := r.current
+	var eventType CredentialEventType
+	now := time.Now()
+	switch {
+	case current.ExpiresAt.IsZero():
+	case !now.Before(current.ExpiresAt):
+		eventType = CredentialEventExpired
+	case now.Add(r.config.WarnBefore).After(current.ExpiresAt):
+		eventType = CredentialEventExpiring
+	}
+	if eventType == "" || r.warned[current.ApiKey] == eventType {
+		r.mu.Unlock()
+		return
+	}
+	r.warned[current.ApiKey] = eventType
+	r.mu.Unlock()
+	r.emit(CredentialEvent{Type: eventType, ApiKey: maskApiKey(current.ApiKey), ExpiresAt: current.ExpiresAt})
+}
+
+// Watch reloads the credentials and checks their expiry every interval until ctx is done.
+// Reload errors are reported as events only.
+func (r *RotatingCredentials) Watch(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if r.config.Loader != nil {
+			_, _ = r.Reload()
+		}
+		r.CheckExpiry()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *RotatingCredentials) emit(event CredentialEvent) {
+	if r.config.OnEvent == nil {
+		return
+	}
+	event.Time = time.Now()
+	r.config.OnEvent(event)
+}
+
+// isKeyRejected reports whether Ceffu refused the API key or signature of a request
+func isKeyRejected(code string) bool {
+	return code == ErrorInvalidApiKey || code == ErrorApiKeyExpired || code == ErrorInvalidSignature
+}
@@ -0,0 +1,143 @@
+package ceffu
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestKey returns a base64 encoded PKCS8 RSA key as accepted by New
+func newTestKey(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func TestCredentialRotation(t *testing.T) {
+	var seen []string
+	rejected := map[string]string{"new-key-0001": ErrorInvalidApiKey, "old-key-0002": ErrorApiKeyExpired}
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		apiKey := r.Header.Get("open-apikey")
+		seen = append(seen, apiKey)
+		if code, ok := rejected[apiKey]; ok {
+			_, _ = w.Write([]byte(`{"code":"` + code + `","message":"rejected"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+	})
+	old, err := NewCredential("old-key-0001", newTestKey(t), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := NewCredential("new-key-0001", newTestKey(t), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []CredentialEvent
+	path := filepath.Join(t.TempDir(), "credential.json")
+	rotating, err := NewRotatingCredentials(old, RotationConfig{
+		Loader:  FileCredentialLoader(path),
+		OnEvent: func(event CredentialEvent) { events = append(events, event) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	WithCredentials(rotating)(cl)
+
+	// The new key is not active yet, the old one is used during the overlap
+	if err = rotating.Rotate(next); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cl.GetAssetSummary("7"); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0] != "new-key-0001" || seen[1] != "old-key-0001" {
+		t.Fatalf("unexpected keys %v", seen)
+	}
+	if len(events) != 1 || events[0].Type != CredentialEventRotated || events[0].ApiKey != "****0001" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	// An expired key reloads the credential file and retries
+	expired, err := NewCredential("old-key-0002", newTestKey(t), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotating, err = NewRotatingCredentials(expired, RotationConfig{Loader: FileCredentialLoader(path)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	WithCredentials(rotating)(cl)
+	err = os.WriteFile(path, []byte(`{"apiKey":"reloaded-0003","privateKey":"`+newTestKey(t)+`","expiresAt":"2100-01-01T00:00:00Z"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen = nil
+	resp, err := cl.GetAssetSummary("7")
+	if err != nil || resp.Code != CodeSuccess {
+		t.Fatalf("expected reload and retry, got %v %v", resp, err)
+	}
+	if len(seen) != 2 || seen[1] != "reloaded-0003" || cl.ApiKey() != "reloaded-0003" || rotating.Current().ExpiresAt.Year() != 2100 {
+		t.Fatalf("unexpected keys %v", seen)
+	}
+	if changed, err := rotating.Reload(); changed || err != nil {
+		t.Fatalf("unchanged file reloaded: %v %v", changed, err)
+	}
+}
+
+func TestCredentialExpiry(t *testing.T) {
+	credential, err := NewCredential("expiring-key", newTestKey(t), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []CredentialEvent
+	rotating, err := NewRotatingCredentials(credential, RotationConfig{
+		WarnBefore: 2 * time.Hour,
+		OnEvent:    func(event CredentialEvent) { events = append(events, event) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotating.CheckExpiry()
+	rotating.CheckExpiry()
+	if len(events) != 1 || events[0].Type != CredentialEventExpiring || events[0].ApiKey != "****-key" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	expired := *credential
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	if err = rotating.Rotate(&expired); err != nil {
+		t.Fatal(err)
+	}
+	rotating.CheckExpiry()
+	if len(events) != 3 || events[2].Type != CredentialEventExpired {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	// Signatures stay RSA PKCS1v15 over SHA512
+	signature, err := credential.sign("timestamp=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(signature)
+	hash := sha512.Sum512([]byte("timestamp=1"))
+	public := credential.Signer.Public().(*rsa.PublicKey)
+	if err = rsa.VerifyPKCS1v15(public, crypto.SHA512, hash[:], decoded); err != nil {
+		t.Fatal(err)
+	}
+}
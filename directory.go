@@ -0,0 +1,323 @@
+package ceffu
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWalletNameMaxAge is how long wallet names are trusted before the directory is reloaded
+	DefaultWalletNameMaxAge = 10 * time.Minute
+	// DefaultWalletMissInterval is the minimum time between reloads caused by unknown names
+	DefaultWalletMissInterval = 30 * time.Second
+)
+
+var (
+	ErrUnknownWalletName   = errors.New("no wallet with this alias or name")
+	ErrAmbiguousWalletName = errors.New("several wallets have this name")
+)
+
+// WalletEntry is a wallet or sub wallet known to a WalletDirectory
+type WalletEntry struct {
+	WalletID int64  `json:"walletId"`
+	Name     string `json:"name,omitempty"`
+	Type     int    `json:"type,omitempty"` // See WalletTypeInt*
+	// ParentWalletID is set for sub wallets
+	ParentWalletID int64 `json:"parentWalletId,omitempty"`
+}
+
+// WalletDirectory caches the wallets and sub wallets of the organization, so wallets can be
+// referred to by alias or name. Ceffu does not list the names of sub wallets, they are only known
+// for sub wallets created or updated through the client.
+// Names are reloaded once they are older than the max age, so renamed wallets stop resolving.
+// It is safe for concurrent use.
+type WalletDirectory struct {
+	// client loads the wallets, copies made by Client.WithContext share the cache but load with their own client
+	client *Client
+	*walletCache
+}
+
+// walletCache is the state of a WalletDirectory
+type walletCache struct {
+	mu           sync.RWMutex
+	entries      map[int64]*WalletEntry
+	aliases      map[string]int64
+	refreshedAt  time.Time // last successful Refresh
+	missedAt     time.Time // last reload caused by an unknown name
+	maxAge       time.Duration
+	missInterval time.Duration
+}
+
+func newWalletDirectory(client *Client) *WalletDirectory {
+	return &WalletDirectory{
+		client: client,
+		walletCache: &walletCache{
+			entries:      map[int64]*WalletEntry{},
+			aliases:      map[string]int64{},
+			maxAge:       DefaultWalletNameMaxAge,
+			missInterval: DefaultWalletMissInterval,
+		},
+	}
+}
+
+// withClient returns a directory sharing the cache of d which loads wallets through client
+func (d *WalletDirectory) withClient(client *Client) *WalletDirectory {
+	return &WalletDirectory{client: client, walletCache: d.walletCache}
+}
+
+// WithWalletNameCache sets how long resolved wallet names are trusted, default DefaultWalletNameMaxAge,
+// and the minimum time between reloads caused by unknown names, default DefaultWalletMissInterval.
+// Unknown names are rejected without a reload within missInterval of the previous one.
+func WithWalletNameCache(maxAge, missInterval time.Duration) Option {
+	return func(c *Client) {
+		c.directory.mu.Lock()
+		defer c.directory.mu.Unlock()
+		c.directory.maxAge = maxAge
+		c.directory.missInterval = missInterval
+	}
+}
+
+// Directory returns the wallet directory of the client, which is loaded when a name is first resolved
+func (c *Client) Directory() *WalletDirectory {
+	return c.directory
+}
+
+// WithWalletAliases names wallet ids, aliases take precedence over wallet names
+func WithWalletAliases(aliases map[string]int64) Option {
+	return func(c *Client) {
+		for alias, walletId := range aliases {
+			c.directory.SetAlias(alias, walletId)
+		}
+	}
+}
+
+// WalletAlias returns the wallet id named alias by WithWalletAliases or SetAlias
+func (c *Client) WalletAlias(alias string) (int64, bool) {
+	c.directory.mu.RLock()
+	defer c.directory.mu.RUnlock()
+	walletId, ok := c.directory.aliases[alias]
+	return walletId, ok
+}
+
+// SetAlias names walletId
+func (d *WalletDirectory) SetAlias(alias string, walletId int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.aliases[alias] = walletId
+}
+
+// Refresh reloads all wallets and their sub wallets.
+// Names of sub wallets learned before are kept.
+func (d *WalletDirectory) Refresh() error {
+	wallets, err := d.client.listAllWallets()
+	if err != nil {
+		return err
+	}
+	entries := map[int64]*WalletEntry{}
+	for _, wallet := range wallets {
+		entries[wallet.WalletID] = &WalletEntry{
+			WalletID: wallet.WalletID,
+			Name:     wallet.WalletName,
+			Type:     wallet.WalletType,
+		}
+		subWallets, err := d.client.listAllSubWallets(wallet.WalletID)
+		if isAPIError(err, ErrorWalletTypeNotSupported, ErrorWalletRelationship) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, subWalletId := range subWallets {
+			entries[subWalletId] = &WalletEntry{WalletID: subWalletId, ParentWalletID: wallet.WalletID}
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for walletId, entry := range entries {
+		if known, ok := d.entries[walletId]; ok && entry.Name == "" {
+			entry.Name = known.Name
+			entry.Type = known.Type
+		}
+	}
+	d.entries = entries
+	d.refreshedAt = time.Now()
+	return nil
+}
+
+// put adds or replaces a single entry after a wallet was created or updated
+func (d *WalletDirectory) put(entry WalletEntry) {
+	if entry.WalletID == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[entry.WalletID] = &entry
+}
+
+// Get returns the entry of walletId
+func (d *WalletDirectory) Get(walletId int64) (WalletEntry, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	entry, ok := d.entries[walletId]
+	if !ok {
+		return WalletEntry{}, false
+	}
+	return *entry, true
+}
+
+// Wallets returns all entries sorted by wallet id
+func (d *WalletDirectory) Wallets() []WalletEntry {
+	return d.filter(func(entry *WalletEntry) bool { return true })
+}
+
+// SubWallets returns the sub wallets of parentWalletId sorted by wallet id
+func (d *WalletDirectory) SubWallets(parentWalletId int64) []WalletEntry {
+	return d.filter(func(entry *WalletEntry) bool { return entry.ParentWalletID == parentWalletId })
+}
+
+func (d *WalletDirectory) filter(keep func(entry *WalletEntry) bool) []WalletEntry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var entries []WalletEntry
+	for _, entry := range d.entries {
+		if keep(entry) {
+			entries = append(entries, *entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].WalletID < entries[j].WalletID })
+	return entries
+}
+
+// lookup resolves a name from the cache
+func (d *WalletDirectory) lookup(ref string) (int64, bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var found *WalletEntry
+	for _, entry := range d.entries {
+		if entry.Name != ref {
+			continue
+		}
+		if found != nil {
+			return 0, false, fmt.Errorf("%w: %q is wallet %d and %d", ErrAmbiguousWalletName, ref, found.WalletID, entry.WalletID)
+		}
+		found = entry
+	}
+	if found == nil {
+		return 0, false, nil
+	}
+	return found.WalletID, true, nil
+}
+
+// stale reports whether the names of the cache are older than the max age
+func (d *WalletDirectory) stale() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return time.Since(d.refreshedAt) > d.maxAge
+}
+
+// claimMissRefresh reports whether an unknown name may reload the directory, and records the reload if so
+func (d *WalletDirectory) claimMissRefresh() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if now.Sub(d.refreshedAt) < d.missInterval || now.Sub(d.missedAt) < d.missInterval {
+		return false
+	}
+	d.missedAt = now
+	return true
+}
+
+// Resolve returns the wallet id of ref, which is a wallet id, an alias or a wallet name.
+// Names are looked up after reloading the directory if it is older than the max age.
+// Unknown names reload it at most once per miss interval before ErrUnknownWalletName is returned.
+func (d *WalletDirectory) Resolve(ref WalletID) (int64, error) {
+	if walletId, err := ref.Int64(); err == nil {
+		return walletId, nil
+	}
+	if ref == "" {
+		return 0, fmt.Errorf("%w: empty reference", ErrUnknownWalletName)
+	}
+	d.mu.RLock()
+	walletId, ok := d.aliases[ref.String()]
+	d.mu.RUnlock()
+	if ok {
+		return walletId, nil
+	}
+	refreshed := false
+	if d.stale() {
+		if err := d.Refresh(); err != nil {
+			return 0, err
+		}
+		refreshed = true
+	}
+	walletId, ok, err := d.lookup(ref.String())
+	if err != nil || ok {
+		return walletId, err
+	}
+	if !refreshed && d.claimMissRefresh() {
+		if err = d.Refresh(); err != nil {
+			return 0, err
+		}
+		walletId, ok, err = d.lookup(ref.String())
+		if err != nil || ok {
+			return walletId, err
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownWalletName, ref)
+}
+
+// isWalletRef reports whether a wallet id parameter holds an alias or name rather than an id
+func isWalletRef(value string) bool {
+	if value == "" {
+		return false
+	}
+	_, err := strconv.ParseInt(value, 10, 64)
+	return err != nil
+}
+
+// resolveQueryWallets replaces aliases and names in the wallet id parameters of a GET request
+func (c *Client) resolveQueryWallets(params map[string]string) error {
+	for _, key := range walletIdParams {
+		if value, ok := params[key]; ok && isWalletRef(value) {
+			walletId, err := c.directory.Resolve(WalletID(value))
+			if err != nil {
+				return err
+			}
+			params[key] = strconv.FormatInt(walletId, 10)
+		}
+	}
+	return nil
+}
+
+// resolveBodyWallets replaces aliases and names in the wallet id parameters of a POST request.
+// Ids are sent as numbers, except for walletIdStr.
+func (c *Client) resolveBodyWallets(message map[string]interface{}) error {
+	for _, key := range walletIdParams {
+		var value WalletID
+		switch v := message[key].(type) {
+		case WalletID:
+			value = v
+		case string:
+			value = WalletID(v)
+		default:
+			continue
+		}
+		if !isWalletRef(value.String()) {
+			continue
+		}
+		walletId, err := c.directory.Resolve(value)
+		if err != nil {
+			return err
+		}
+		if key == "walletIdStr" {
+			message[key] = strconv.FormatInt(walletId, 10)
+		} else {
+			message[key] = walletId
+		}
+	}
+	return nil
+}
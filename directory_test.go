@@ -0,0 +1,124 @@
+package ceffu
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWalletDirectory(t *testing.T) {
+	listed := 0
+	var summaryWallet string
+	var posted map[string]interface{}
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/wallet/list":
+			listed++
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"walletId":1,"walletName":"hot","walletType":20},{"walletId":2,"walletName":"cold","walletType":10}],"totalPage":1,"pageNo":1}}`))
+		case "/open-api/v1/subwallet/list":
+			if r.URL.Query().Get("parentWalletId") != "1" {
+				_, _ = w.Write([]byte(`{"code":"G20024","message":"wallet type not supported"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[11,12,13],"totalPage":1,"pageNo":1}}`))
+		case "/open-api/v1/wallet/asset/summary":
+			summaryWallet = r.URL.Query().Get("walletIdStr")
+			_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+		case "/open-api/v1/subwallet/create":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"walletId":13,"walletName":"desk","walletType":20,"parentWalletId":1}}`))
+		default:
+			posted = nil
+			_ = json.NewDecoder(r.Body).Decode(&posted)
+			_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+		}
+	})
+	WithWalletAliases(map[string]int64{"treasury": 2})(cl)
+	WithWalletNameCache(time.Hour, 0)(cl)
+
+	if _, err := cl.GetAssetSummary("cold"); err != nil || summaryWallet != "2" {
+		t.Fatalf("name not resolved: %s %v", summaryWallet, err)
+	}
+	if _, err := cl.GetAssetSummary("treasury"); err != nil || summaryWallet != "2" {
+		t.Fatalf("alias not resolved: %s %v", summaryWallet, err)
+	}
+	if err := cl.Do(http.MethodPost, APIVersion1, "wallet/new/action", map[string]string{"walletId": "hot"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if posted["walletId"] != float64(1) {
+		t.Fatalf("expected numeric wallet id, got %v", posted["walletId"])
+	}
+
+	entry, ok := cl.Directory().Get(12)
+	if !ok || entry.ParentWalletID != 1 {
+		t.Fatalf("unexpected sub wallet %+v", entry)
+	}
+	if _, err := cl.CreateSubWallet("1", "desk", false); err != nil {
+		t.Fatal(err)
+	}
+	if walletId, err := cl.Directory().Resolve("desk"); err != nil || walletId != 13 {
+		t.Fatalf("created sub wallet not resolved: %d %v", walletId, err)
+	}
+	if subWallets := cl.Directory().SubWallets(1); len(subWallets) != 3 || subWallets[2].Name != "desk" {
+		t.Fatalf("unexpected sub wallets %+v", subWallets)
+	}
+	if listed != 1 {
+		t.Fatalf("wallet list fetched %d times", listed)
+	}
+
+	if _, err := cl.GetAssetSummary("missing"); !errors.Is(err, ErrUnknownWalletName) {
+		t.Fatalf("expected unknown wallet, got %v", err)
+	}
+	// Refreshing keeps the name of the sub wallet, which Ceffu does not list
+	if entry, _ = cl.Directory().Get(13); listed != 2 || entry.Name != "desk" {
+		t.Fatalf("unexpected refresh: %d lists, %+v", listed, entry)
+	}
+}
+
+func TestWalletDirectoryMaxAge(t *testing.T) {
+	listed := 0
+	wallets := `[{"walletId":1,"walletName":"hot"},{"walletId":2,"walletName":"cold"}]`
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/open-api/v1/wallet/list" {
+			listed++
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":` + wallets + `,"totalPage":1,"pageNo":1}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":"G20024","message":"wallet type not supported"}`))
+	})
+	directory := cl.Directory()
+	if walletId, err := directory.Resolve("hot"); err != nil || walletId != 1 {
+		t.Fatalf("unexpected %d %v", walletId, err)
+	}
+	// Misses right after a reload are answered from the cache
+	for i := 0; i < 3; i++ {
+		if _, err := directory.Resolve("missing"); !errors.Is(err, ErrUnknownWalletName) {
+			t.Fatalf("expected unknown wallet, got %v", err)
+		}
+	}
+	if listed != 1 {
+		t.Fatalf("misses reloaded the directory %d times", listed-1)
+	}
+
+	// Once the names are too old, a renamed wallet stops resolving and a reused name moves
+	wallets = `[{"walletId":1,"walletName":"warm"},{"walletId":3,"walletName":"hot"}]`
+	directory.mu.Lock()
+	directory.refreshedAt = directory.refreshedAt.Add(-DefaultWalletNameMaxAge - time.Second)
+	directory.mu.Unlock()
+	if walletId, err := directory.Resolve("hot"); err != nil || walletId != 3 || listed != 2 {
+		t.Fatalf("stale name resolved to %d %v after %d lists", walletId, err, listed)
+	}
+	if walletId, err := directory.Resolve("warm"); err != nil || walletId != 1 || listed != 2 {
+		t.Fatalf("renamed wallet resolved to %d %v after %d lists", walletId, err, listed)
+	}
+
+	// After the miss interval an unknown name reloads once
+	directory.mu.Lock()
+	directory.refreshedAt = directory.refreshedAt.Add(-DefaultWalletMissInterval)
+	directory.mu.Unlock()
+	wallets = `[{"walletId":4,"walletName":"new"}]`
+	if walletId, err := directory.Resolve("new"); err != nil || walletId != 4 || listed != 3 {
+		t.Fatalf("new wallet resolved to %d %v after %d lists", walletId, err, listed)
+	}
+}
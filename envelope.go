@@ -0,0 +1,47 @@
+package ceffu
+
+import "encoding/json"
+
+// Envelope is the body of every Ceffu response
+type Envelope[T any] struct {
+	Data    T      `json:"data"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Err returns an *APIError unless the response code is CodeSuccess
+func (e *Envelope[T]) Err() error {
+	return checkCode(e.Code, e.Message)
+}
+
+// Unwrap returns the data of a successful response, or an *APIError for any other code
+func (e *Envelope[T]) Unwrap() (T, error) {
+	if err := e.Err(); err != nil {
+		var zero T
+		return zero, err
+	}
+	return e.Data, nil
+}
+
+// Page is the data of a paginated response
+type Page[T any] struct {
+	Data      []T `json:"data"`
+	TotalPage int `json:"totalPage"`
+	PageNo    int `json:"pageNo"`
+	PageLimit int `json:"pageLimit"`
+}
+
+// HasNext reports whether there is a page after this one
+func (p *Page[T]) HasNext() bool {
+	return p.PageNo < p.TotalPage
+}
+
+// decodeEnvelope decodes a response body, a non success code is not an error here
+func decodeEnvelope[T any](body []byte) (*Envelope[T], error) {
+	response := &Envelope[T]{}
+	err := json.Unmarshal(body, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,33 @@
+package ceffu
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEnvelopeUnwrap(t *testing.T) {
+	cl := newRouteClient(t, map[string]string{
+		"/open-api/v1/subwallet/deposit/history": `{"code":"000000","message":"success","data":{"data":[{"orderViewId":"ov1","amount":"1.5","feeAmount":"0","memo":null,"walletId":9}],"totalPage":2,"pageNo":1,"pageLimit":25}}`,
+		"/open-api/v1/subwallet/update":          `{"code":"G20010","message":"wallet not found"}`,
+	})
+	history, err := cl.GetSubWalletDepositHistory("9", "", "", 1, 0, 25, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := history.Unwrap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Data) != 1 || page.Data[0].OrderViewID != "ov1" || page.Data[0].Amount != "1.5" || !page.HasNext() {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	updated, err := cl.UpdateSubWallet(true, "9", "name", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiErr *APIError
+	if _, err = updated.Unwrap(); !errors.As(err, &apiErr) || apiErr.Code != "G20010" || apiErr.Message != "wallet not found" {
+		t.Fatalf("expected api error, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package ceffu
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Environment variables read by EnvironmentFromEnv
+const (
+	EnvEnvironment    = "CEFFU_ENV"              // production, sandbox or custom, default production
+	EnvBaseUrl        = "CEFFU_BASE_URL"         // base url of a custom environment, overrides the url of the others
+	EnvSandboxBaseUrl = "CEFFU_SANDBOX_BASE_URL" // base url of the sandbox, handed out by Ceffu with sandbox credentials
+)
+
+// ErrProductionMutation is returned by mutating calls in a production environment unless
+// AllowProductionMutations was given to New
+var ErrProductionMutation = errors.New("mutating calls are disabled in production, see AllowProductionMutations")
+
+// Environment is a named set of endpoints and defaults a Client talks to
+type Environment struct {
+	Name         string
+	BaseUrl      string
+	VersionPath  string  // path of version 1 endpoints
+	Version2Path string  // path of version 2 endpoints
+	PageLimit    int     // page size used when a call is given pageLimit 0
+	MaxPageLimit int     // larger page sizes are reduced to this
+	RateLimit    float64 // calls per second of the client side rate limit, 0 disables it
+	RateBurst    int     // burst size of the client side rate limit
+	// Production enables the guard refusing mutating calls, see AllowProductionMutations
+	Production bool
+}
+
+// EnvironmentProduction is the live Ceffu API and the default of New
+var EnvironmentProduction = Environment{
+	Name:         "production",
+	BaseUrl:      CeffuApiBaseUrl,
+	VersionPath:  CeffuVersionPath,
+	Version2Path: CeffuVersion2Path,
+	PageLimit:    25,
+	MaxPageLimit: 25,
+	Production:   true,
+}
+
+// EnvironmentSandbox is the Ceffu QA environment. Its host is given out together with sandbox
+// credentials, so BaseUrl must be set before use, see SandboxEnvironment.
+var EnvironmentSandbox = Environment{
+	Name:         "sandbox",
+	VersionPath:  CeffuVersionPath,
+	Version2Path: CeffuVersion2Path,
+	PageLimit:    25,
+	MaxPageLimit: 25,
+}
+
+// SandboxEnvironment returns EnvironmentSandbox served from baseUrl
+func SandboxEnvironment(baseUrl string) Environment {
+	env := EnvironmentSandbox
+	env.BaseUrl = baseUrl
+	return env
+}
+
+// CustomEnvironment returns an environment with the production paths and limits served from baseUrl,
+// for proxies and mock servers. It is treated as production when baseUrl is CeffuApiBaseUrl.
+func CustomEnvironment(baseUrl string) Environment {
+	env := EnvironmentProduction
+	env.Name = "custom"
+	env.BaseUrl = strings.TrimSuffix(baseUrl, "/")
+	env.Production = env.BaseUrl == CeffuApiBaseUrl
+	return env
+}
+
+// Validate checks the environment can be used by a Client
+func (e Environment) Validate() error {
+	if e.BaseUrl == "" {
+		return fmt.Errorf("environment %q has no base url", e.Name)
+	}
+	if e.VersionPath == "" || e.Version2Path == "" {
+		return fmt.Errorf("environment %q has no version paths", e.Name)
+	}
+	if e.PageLimit < 1 || e.MaxPageLimit < e.PageLimit {
+		return fmt.Errorf("environment %q has invalid page limits %d and %d", e.Name, e.PageLimit, e.MaxPageLimit)
+	}
+	if e.RateLimit < 0 {
+		return fmt.Errorf("environment %q has negative rate limit", e.Name)
+	}
+	if e.RateLimit != 0 {
+		if err := validateRateLimit(e.RateLimit); err != nil {
+			return fmt.Errorf("environment %q: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// LookupEnvironment returns the predefined environment called name.
+// The sandbox takes its base url from CEFFU_SANDBOX_BASE_URL.
+func LookupEnvironment(name string) (Environment, error) {
+	switch strings.ToLower(name) {
+	case "", "production", "prod":
+		return EnvironmentProduction, nil
+	case "sandbox", "qa":
+		return SandboxEnvironment(os.Getenv(EnvSandboxBaseUrl)), nil
+	case "custom":
+		return CustomEnvironment(os.Getenv(EnvBaseUrl)), nil
+	}
+	return Environment{}, fmt.Errorf("unknown environment %q", name)
+}
+
+// EnvironmentFromEnv selects an environment by CEFFU_ENV, defaulting to production.
+// CEFFU_BASE_URL replaces the base url of the selected environment.
+func EnvironmentFromEnv() (Environment, error) {
+	env, err := LookupEnvironment(os.Getenv(EnvEnvironment))
+	if err != nil {
+		return Environment{}, err
+	}
+	if baseUrl := os.Getenv(EnvBaseUrl); baseUrl != "" {
+		env.BaseUrl = strings.TrimSuffix(baseUrl, "/")
+	}
+	return env, env.Validate()
+}
+
+// WithEnvironment sends calls to env instead of the base url given to New.
+// A rate limit of env replaces the limiter of the client, without one the current limiter is kept.
+// New returns an error if env is invalid, an invalid rate limit is not applied.
+func WithEnvironment(env Environment) Option {
+	return func(c *Client) {
+		c.env = env
+		if env.RateLimit > 0 {
+			if limiter, err := TryNewRateLimiter(env.RateLimit, env.RateBurst); err == nil {
+				c.limiter = limiter
+			}
+		}
+	}
+}
+
+// WithRateLimiter paces every call of the client with limiter, which may be shared between clients
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// AllowProductionMutations lets the client create wallets, withdraw, transfer and place orders in production.
+// Without it these calls return ErrProductionMutation.
+func AllowProductionMutations() Option {
+	return func(c *Client) {
+		c.allowMutations = true
+	}
+}
+
+// Environment returns the environment the client talks to
+func (c *Client) Environment() Environment {
+	return c.env
+}
+
+// checkMutation returns ErrProductionMutation if mutating calls are disabled
+func (c *Client) checkMutation() error {
+	if c.env.Production && !c.allowMutations {
+		return ErrProductionMutation
+	}
+	return nil
+}
+
+// pageLimit applies the page size defaults of the environment
+func (c *Client) pageLimit(pageLimit int) int {
+	if pageLimit <= 0 {
+		return c.env.PageLimit
+	}
+	if pageLimit > c.env.MaxPageLimit {
+		return c.env.MaxPageLimit
+	}
+	return pageLimit
+}
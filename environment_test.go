@@ -0,0 +1,116 @@
+package ceffu
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestEnvironmentFromEnv(t *testing.T) {
+	t.Setenv(EnvEnvironment, "")
+	t.Setenv(EnvBaseUrl, "")
+	t.Setenv(EnvSandboxBaseUrl, "")
+	env, err := EnvironmentFromEnv()
+	if err != nil || env.Name != "production" || env.BaseUrl != CeffuApiBaseUrl || !env.Production {
+		t.Fatalf("expected production, got %+v %v", env, err)
+	}
+
+	t.Setenv(EnvEnvironment, "sandbox")
+	if _, err = EnvironmentFromEnv(); err == nil {
+		t.Fatal("sandbox without base url accepted")
+	}
+	t.Setenv(EnvSandboxBaseUrl, "https://sandbox.example.com")
+	env, err = EnvironmentFromEnv()
+	if err != nil || env.BaseUrl != "https://sandbox.example.com" || env.Production {
+		t.Fatalf("unexpected sandbox %+v %v", env, err)
+	}
+
+	t.Setenv(EnvEnvironment, "custom")
+	t.Setenv(EnvBaseUrl, "http://localhost:8080/")
+	env, err = EnvironmentFromEnv()
+	if err != nil || env.BaseUrl != "http://localhost:8080" || env.Production {
+		t.Fatalf("unexpected custom %+v %v", env, err)
+	}
+
+	t.Setenv(EnvEnvironment, "staging")
+	if _, err = EnvironmentFromEnv(); err == nil {
+		t.Fatal("unknown environment accepted")
+	}
+}
+
+func TestEnvironmentPathsAndLimits(t *testing.T) {
+	var path, pageLimit string
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path, pageLimit = r.URL.Path, r.URL.Query().Get("pageLimit")
+		_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[],"totalPage":1,"pageNo":1}}`))
+	})
+	env := cl.Environment()
+	env.Name, env.VersionPath, env.PageLimit, env.MaxPageLimit = "qa", "/qa/v1/", 5, 10
+	WithEnvironment(env)(cl)
+
+	if _, err := cl.GetWalletList(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/qa/v1/wallet/list" || pageLimit != "5" {
+		t.Fatalf("unexpected request %s pageLimit=%s", path, pageLimit)
+	}
+	if _, err := cl.GetWalletList(50, 1); err != nil || pageLimit != "10" {
+		t.Fatalf("page limit not capped: %s %v", pageLimit, err)
+	}
+}
+
+func TestProductionMutationGuard(t *testing.T) {
+	posts := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posts++
+		}
+		_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+	})
+	env := cl.Environment()
+	env.Production = true
+	WithEnvironment(env)(cl)
+
+	if _, err := cl.GetAssetSummary("7"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.CreateWallet("w", int(WalletTypeIntPrime), 1); !errors.Is(err, ErrProductionMutation) {
+		t.Fatalf("expected production mutation error, got %v", err)
+	}
+	if posts != 0 {
+		t.Fatal("guarded call was sent")
+	}
+
+	AllowProductionMutations()(cl)
+	if _, err := cl.CreateWallet("w", int(WalletTypeIntPrime), 1); err != nil || posts != 1 {
+		t.Fatalf("allowed call failed: %v, %d posts", err, posts)
+	}
+}
+
+func TestEnvironmentKeepsRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(100, 1)
+	// New applies its own environment before the options, the limiter must survive either order
+	cl, err := New("test-api-key", newTestKey(t), nil, nil, "https://example.com", WithRateLimiter(limiter), WithEnvironment(CustomEnvironment("https://example.org")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.limiter != limiter {
+		t.Fatal("environment without rate limit replaced the limiter")
+	}
+	env := CustomEnvironment("https://example.org")
+	env.RateLimit, env.RateBurst = 10, 2
+	WithEnvironment(env)(cl)
+	if cl.limiter == nil || cl.limiter == limiter {
+		t.Fatal("environment rate limit not applied")
+	}
+}
+
+func TestEnvironmentInvalidRateLimit(t *testing.T) {
+	for _, rate := range []float64{2e9, 1e-12} {
+		env := CustomEnvironment("https://example.org")
+		env.RateLimit = rate
+		if _, err := New("test-api-key", newTestKey(t), nil, nil, "https://example.com", WithEnvironment(env)); err == nil {
+			t.Errorf("rate limit %v accepted", rate)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package ceffu
+
+import "fmt"
+
+// APIError is returned when Ceffu answered a request with a non success code
+type APIError struct {
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = ErrorMap[e.Code]
+	}
+	return fmt.Sprintf("ceffu: %s %s", e.Code, message)
+}
+
+// checkCode returns an *APIError unless code is CodeSuccess
+func checkCode(code string, message string) error {
+	if code == CodeSuccess {
+		return nil
+	}
+	return &APIError{Code: code, Message: message}
+}
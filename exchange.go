@@ -0,0 +1,219 @@
+package ceffu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ExchangeTransferReq describes a transfer between a Ceffu wallet and an exchange account
+type ExchangeTransferReq struct {
+	WalletID       WalletID          // required, wallet the transfer is booked on, used to query its detail
+	ParentWalletID WalletID          // optional, required if using parent shared wallet
+	CoinSymbol     string            // required, example: "USDT"
+	Amount         string            // required, positive decimal string
+	Direction      TransferDirection // required, TransferDirectionIntDeposit or TransferDirectionIntWithdraw
+	ExchangeCode   ExchangeCode      // optional, default ExchangeCodeBinance
+	ExchangeUserID string            // required, binance UID
+	// RequestId is optional, default random. Supply a stored id to retry a transfer safely.
+	RequestId int64
+	// PollInterval is the delay between detail queries in TransferAndWait, default 5 seconds
+	PollInterval time.Duration
+	// Lookback is how far back the history is searched for a transfer already submitted
+	// with RequestId, default 24 hours
+	Lookback time.Duration
+}
+
+func (r *ExchangeTransferReq) Validate() error {
+	if r.WalletID == "" {
+		return errors.New("walletId is required")
+	}
+	if r.CoinSymbol == "" {
+		return errors.New("coinSymbol is required")
+	}
+	amount, err := parseAmount(r.Amount)
+	if err != nil || amount.Sign() <= 0 {
+		return fmt.Errorf("invalid amount %q", r.Amount)
+	}
+	if r.Direction != TransferDirectionIntDeposit && r.Direction != TransferDirectionIntWithdraw {
+		return fmt.Errorf("unsupported transfer direction %d", r.Direction)
+	}
+	if r.ExchangeCode != 0 && r.ExchangeCode != ExchangeCodeBinance {
+		return fmt.Errorf("unsupported exchange code %d", r.ExchangeCode)
+	}
+	if r.ExchangeUserID == "" {
+		return errors.New("exchangeUserId is required")
+	}
+	if r.RequestId < 0 {
+		return errors.New("requestId must not be negative")
+	}
+	return nil
+}
+
+// ExchangeTransfer submits a single exchange transfer and follows it until it settled.
+// Submitting again is safe, Ceffu rejects the repeated requestId and the existing order is looked up instead.
+type ExchangeTransfer struct {
+	client      *Client
+	req         ExchangeTransferReq
+	OrderViewID string
+	Status      WithdrawStatus
+}
+
+// NewExchangeTransfer validates req and prepares the transfer without sending it
+func (c *Client) NewExchangeTransfer(req ExchangeTransferReq) (*ExchangeTransfer, error) {
+	err := req.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if req.ExchangeCode == 0 {
+		req.ExchangeCode = ExchangeCodeBinance
+	}
+	if req.RequestId == 0 {
+		req.RequestId = GetReqId()
+	}
+	if req.PollInterval <= 0 {
+		req.PollInterval = 5 * time.Second
+	}
+	if req.Lookback <= 0 {
+		req.Lookback = 24 * time.Hour
+	}
+	return &ExchangeTransfer{
+		client: c,
+		req:    req,
+	}, nil
+}
+
+// RequestId returns the requestId the transfer is submitted with, store it to resume after a crash
+func (t *ExchangeTransfer) RequestId() int64 {
+	return t.req.RequestId
+}
+
+// Done reports whether the transfer reached a final status
+func (t *ExchangeTransfer) Done() bool {
+	return t.Status == WithdrawStatusSuccess || t.Status == WithdrawStatusConfirmed || t.Status == WithdrawStatusFailed
+}
+
+// Submit sends the transfer unless it was submitted already
+func (t *ExchangeTransfer) Submit() error {
+	if t.OrderViewID != "" {
+		return nil
+	}
+	var parentWalletId []WalletID
+	if t.req.ParentWalletID != "" {
+		parentWalletId = append(parentWalletId, t.req.ParentWalletID)
+	}
+	resp, err := t.client.TransferWithExchangeWithRequestId(t.req.RequestId, t.req.Amount, t.req.CoinSymbol, t.req.Direction, t.req.ExchangeCode, t.req.ExchangeUserID, parentWalletId...)
+	if err != nil {
+		return err
+	}
+	if resp.Code == ErrorDuplicateReqID {
+		return t.recover()
+	}
+	if err = checkCode(resp.Code, resp.Message); err != nil {
+		return err
+	}
+	t.OrderViewID = resp.Data.OrderViewID
+	t.Status = resp.Data.Status
+	return nil
+}
+
+// recover finds the order of a transfer submitted earlier with the same requestId
+func (t *ExchangeTransfer) recover() error {
+	requestId := strconv.FormatInt(t.req.RequestId, 10)
+	query := &ExchangeTransferHistoryQuery{
+		WalletID:   t.req.WalletID,
+		CoinSymbol: t.req.CoinSymbol,
+		Direction:  t.req.Direction,
+		StartTime:  time.Now().Add(-t.req.Lookback),
+	}
+	err := forEachPage(func(pageNo int) (int, error) {
+		query.PageNo = pageNo
+		resp, err := t.client.QueryTransferHistoryWithExchange(query)
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		for _, transfer := range resp.Data.Data {
+			if transfer.RequestID.String() == requestId {
+				t.OrderViewID = transfer.OrderViewID
+				t.Status = WithdrawStatus(transfer.Status)
+				return 0, nil
+			}
+		}
+		return resp.Data.TotalPage, nil
+	})
+	if err != nil {
+		return err
+	}
+	if t.OrderViewID == "" {
+		return fmt.Errorf("transfer with requestId %s was already submitted but is not in the history", requestId)
+	}
+	return nil
+}
+
+// Refresh queries the detail of a submitted transfer and updates Status
+func (t *ExchangeTransfer) Refresh() (*GetTransferDetailWithExchangeResp, error) {
+	if t.OrderViewID == "" {
+		return nil, errors.New("transfer was not submitted")
+	}
+	resp, err := t.client.GetTransferDetailWithExchange(t.OrderViewID, t.req.WalletID)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkCode(resp.Code, resp.Message); err != nil {
+		return nil, err
+	}
+	t.Status = resp.Data.Status
+	return resp, nil
+}
+
+// TransferAndWait submits the transfer and polls its detail until it reached a final status or ctx is done.
+// The final detail is returned, check Data.Status for WithdrawStatusFailed.
+// Detail queries failing with a network, gateway or rate limit error are retried, other errors are returned, see temporaryError.
+func (t *ExchangeTransfer) TransferAndWait(ctx context.Context) (*GetTransferDetailWithExchangeResp, error) {
+	err := t.Submit()
+	if err != nil {
+		return nil, err
+	}
+	ticker := time.NewTicker(t.req.PollInterval)
+	defer ticker.Stop()
+	var last *GetTransferDetailWithExchangeResp
+	for {
+		resp, err := t.Refresh()
+		if err != nil && !temporaryError(err) {
+			return nil, err
+		}
+		if err != nil {
+			t.client.Logf("ceffu: failed to query exchange transfer %s, retrying: %s", t.OrderViewID, err)
+		} else {
+			last = resp
+			if t.Done() {
+				return resp, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return last, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// temporaryError reports whether a failed query may succeed when sent again: network errors,
+// http 429, 502, 503 or 504 and rate limiting reported by Ceffu. Anything else, e.g. a malformed
+// response or an invalid request, is reported at once.
+func temporaryError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == ErrorRateLimitExceeded
+	}
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return transportErr.Temporary()
+	}
+	return networkError(err)
+}
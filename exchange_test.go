@@ -0,0 +1,147 @@
+package ceffu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestExchangeTransferAndWait(t *testing.T) {
+	var sent map[string]interface{}
+	polls := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/wallet/transferWithExchange":
+			_ = json.NewDecoder(r.Body).Decode(&sent)
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"orderViewId":"ov1","status":10,"direction":20}}`))
+		case "/open-api/v1/wallet/transfer/exchange/detail":
+			polls++
+			if r.URL.Query().Get("orderViewId") != "ov1" || r.URL.Query().Get("walletId") != "7" {
+				t.Errorf("unexpected detail query %v", r.URL.Query())
+			}
+			if polls == 2 {
+				// A gateway error while polling is retried
+				w.WriteHeader(http.StatusBadGateway)
+				_, _ = w.Write([]byte("<html>bad gateway</html>"))
+				return
+			}
+			status := 20
+			if polls > 2 {
+				status = 30
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": "000000", "data": map[string]interface{}{"orderViewId": "ov1", "status": status}})
+		}
+	})
+	transfer, err := cl.NewExchangeTransfer(ExchangeTransferReq{
+		WalletID:       "7",
+		CoinSymbol:     "USDT",
+		Amount:         "10",
+		Direction:      TransferDirectionIntWithdraw,
+		ExchangeUserID: "123",
+		RequestId:      42,
+		PollInterval:   time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	detail, err := transfer.TransferAndWait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.Data.Status != WithdrawStatusSuccess || polls != 3 {
+		t.Fatalf("unexpected detail %+v after %d polls", detail.Data, polls)
+	}
+	if sent["requestId"].(float64) != 42 || sent["exchangeCode"].(float64) != float64(ExchangeCodeBinance) || sent["direction"].(float64) != 20 {
+		t.Fatalf("unexpected request %v", sent)
+	}
+}
+
+func TestExchangeTransferAndWaitFatal(t *testing.T) {
+	cl := newRouteClient(t, map[string]string{
+		"/open-api/v1/wallet/transferWithExchange":     `{"code":"000000","data":{"orderViewId":"ov1","status":10}}`,
+		"/open-api/v1/wallet/transfer/exchange/detail": `{"code":"G20004","message":"order not found"}`,
+	})
+	transfer, _ := cl.NewExchangeTransfer(ExchangeTransferReq{
+		WalletID:       "7",
+		CoinSymbol:     "USDT",
+		Amount:         "10",
+		Direction:      TransferDirectionIntWithdraw,
+		ExchangeUserID: "123",
+		PollInterval:   time.Millisecond,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var apiErr *APIError
+	if _, err := transfer.TransferAndWait(ctx); !errors.As(err, &apiErr) {
+		t.Fatalf("expected api error, got %v", err)
+	}
+}
+
+func TestExchangeTransferDuplicate(t *testing.T) {
+	cl := newRouteClient(t, map[string]string{
+		"/open-api/v1/wallet/transferWithExchange":      `{"code":"G20015","message":"duplicate request id"}`,
+		"/open-api/v1/wallet/transfer/exchange/history": `{"code":"000000","data":{"data":[{"orderViewId":"ov0","status":30,"requestId":41},{"orderViewId":"ov1","status":30,"requestId":"4611686018427387905"}],"totalPage":1}}`,
+	})
+	transfer, err := cl.NewExchangeTransfer(ExchangeTransferReq{
+		WalletID:       "7",
+		CoinSymbol:     "USDT",
+		Amount:         "10",
+		Direction:      TransferDirectionIntWithdraw,
+		ExchangeUserID: "123",
+		RequestId:      4611686018427387905,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = transfer.Submit(); err != nil {
+		t.Fatal(err)
+	}
+	if transfer.OrderViewID != "ov1" || !transfer.Done() {
+		t.Fatalf("existing transfer not found: %+v", transfer)
+	}
+}
+
+func TestExchangeTemporaryError(t *testing.T) {
+	cases := []struct {
+		err       error
+		temporary bool
+	}{
+		{&url.Error{Op: "Get", URL: "https://open-api.ceffu.com", Err: errors.New("connection reset")}, true},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{&TransportError{StatusCode: http.StatusGatewayTimeout, Err: ErrHTTPStatus}, true},
+		{&TransportError{StatusCode: http.StatusTooManyRequests, Err: ErrHTTPStatus}, true},
+		{&APIError{Code: ErrorRateLimitExceeded}, true},
+		{&TransportError{StatusCode: http.StatusInternalServerError, Err: ErrHTTPStatus}, false},
+		{&TransportError{StatusCode: http.StatusOK, Err: ErrNotJSON}, false},
+		{&APIError{Code: "G10001"}, false},
+		{&json.SyntaxError{}, false},
+		{errors.New("sign request: invalid key"), false},
+	}
+	for _, c := range cases {
+		if temporaryError(c.err) != c.temporary {
+			t.Errorf("temporaryError(%v) = %v", c.err, !c.temporary)
+		}
+	}
+}
+
+func TestExchangeTransferValidate(t *testing.T) {
+	req := ExchangeTransferReq{WalletID: "7", CoinSymbol: "USDT", Amount: "10", Direction: 30, ExchangeUserID: "123"}
+	if err := req.Validate(); err == nil {
+		t.Error("unsupported direction accepted")
+	}
+	req.Direction = TransferDirectionIntDeposit
+	req.ExchangeCode = 20
+	if err := req.Validate(); err == nil {
+		t.Error("unsupported exchange accepted")
+	}
+	req.ExchangeCode = ExchangeCodeBinance
+	if err := req.Validate(); err != nil {
+		t.Error(err)
+	}
+}
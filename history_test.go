@@ -0,0 +1,155 @@
+package ceffu
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHistoryQuery(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var query map[string]string
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		query = map[string]string{}
+		for key := range r.URL.Query() {
+			query[key] = r.URL.Query().Get(key)
+		}
+		_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[],"totalPage":1}}`))
+	})
+
+	_, err := cl.QueryWithdrawalHistory(&WithdrawalHistoryQuery{
+		WalletID:  "5",
+		Status:    WithdrawStatusSuccess,
+		StartTime: start,
+		EndTime:   start.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query["startTime"] != strconv.FormatInt(start.UnixMilli(), 10) || query["endTime"] != strconv.FormatInt(start.Add(time.Hour).UnixMilli(), 10) {
+		t.Fatalf("times not sent in milliseconds: %v", query)
+	}
+	if query["status"] != "30" || query["walletId"] != "5" || query["pageLimit"] != "25" || query["pageNo"] != "1" {
+		t.Fatalf("unexpected query %v", query)
+	}
+	if _, ok := query["network"]; ok {
+		t.Fatalf("unset filter sent: %v", query)
+	}
+
+	// The positional method is a wrapper of the query
+	if _, err = cl.GetTransferHistory("5", "", SubWalletParentToSub, 0, start.UnixMilli(), 0, 0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if query["direction"] != "10" || query["pageNo"] != "2" || query["endTime"] == "" {
+		t.Fatalf("unexpected query %v", query)
+	}
+	if _, ok := query["status"]; ok {
+		t.Fatalf("unset status sent: %v", query)
+	}
+}
+
+func TestHistoryQueryValidation(t *testing.T) {
+	calls := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+	start := time.Now()
+	if _, err := cl.QueryDepositHistory(&DepositHistoryQuery{StartTime: start}); err == nil {
+		t.Error("missing wallet id accepted")
+	}
+	if _, err := cl.QueryDepositHistory(&DepositHistoryQuery{WalletID: "5"}); err == nil {
+		t.Error("missing start time accepted")
+	}
+	if _, err := cl.QuerySubWalletDepositHistory(&SubWalletDepositHistoryQuery{WalletID: "5", StartTime: start, EndTime: start.Add(-time.Second)}); err == nil {
+		t.Error("end before start accepted")
+	}
+	if _, err := cl.QueryWithdrawalHistory(&WithdrawalHistoryQuery{WalletID: "5", StartTime: start, Status: 31}); err == nil {
+		t.Error("unknown status accepted")
+	}
+	if _, err := cl.QueryTransferHistoryWithExchange(&ExchangeTransferHistoryQuery{WalletID: "5", StartTime: start, Direction: 15}); err == nil {
+		t.Error("unknown direction accepted")
+	}
+	if _, err := cl.QueryAllSubWalletDepositHistory(&AllSubWalletDepositHistoryQuery{ParentWalletID: "5", PageLimit: -1}); err == nil {
+		t.Error("negative page limit accepted")
+	}
+	if calls != 0 {
+		t.Fatalf("invalid queries sent %d requests", calls)
+	}
+}
+
+func TestListQuery(t *testing.T) {
+	var query map[string]string
+	calls := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		query = map[string]string{}
+		for key := range r.URL.Query() {
+			query[key] = r.URL.Query().Get(key)
+		}
+		_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[],"totalPage":1}}`))
+	})
+
+	// Paging defaults come from the environment
+	if _, err := cl.QueryAllSubWalletDepositHistory(&AllSubWalletDepositHistoryQuery{ParentWalletID: "5"}); err != nil {
+		t.Fatal(err)
+	}
+	if query["pageLimit"] != "25" || query["pageNo"] != "1" {
+		t.Fatalf("unexpected paging %v", query)
+	}
+	if _, err := cl.QuerySubWalletAssetDetails(&SubWalletAssetDetailsQuery{WalletID: "6", CoinSymbol: "USDT", PageNo: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if query["walletId"] != "6" || query["coinSymbol"] != "USDT" || query["pageLimit"] != "25" || query["pageNo"] != "2" {
+		t.Fatalf("unexpected query %v", query)
+	}
+	if _, ok := query["network"]; ok {
+		t.Fatalf("unset filter sent: %v", query)
+	}
+	// The positional method is a wrapper of the query
+	if _, err := cl.GetAllSubWalletDepositAddress("5", "USDT", "ETH", 10, 0); err != nil {
+		t.Fatal(err)
+	}
+	if query["parentWalletId"] != "5" || query["network"] != "ETH" || query["pageLimit"] != "10" {
+		t.Fatalf("unexpected query %v", query)
+	}
+	if _, err := cl.GetAllSubWallet("5", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if query["parentWalletId"] != "5" || query["pageLimit"] != "25" || query["pageNo"] != "1" {
+		t.Fatalf("unexpected query %v", query)
+	}
+	if _, err := cl.GetMirrorXLinkList(0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if query["pageLimit"] != "25" || query["pageNo"] != "3" {
+		t.Fatalf("unexpected query %v", query)
+	}
+
+	calls = 0
+	if _, err := cl.QueryWalletList(&WalletListQuery{PageNo: -1}); err == nil {
+		t.Error("negative page accepted")
+	}
+	if _, err := cl.QueryAssetDetails(&AssetDetailsQuery{}); err == nil {
+		t.Error("missing wallet id accepted")
+	}
+	if _, err := cl.QueryAllSubWalletDepositAddress(&AllSubWalletDepositAddressQuery{ParentWalletID: "5", CoinSymbol: "USDT"}); err == nil {
+		t.Error("missing network accepted")
+	}
+	if _, err := cl.QueryAllSubWallet(&SubWalletListQuery{}); err == nil {
+		t.Error("missing parent wallet id accepted")
+	}
+	if _, err := cl.GetMirrorXLinkList(-1, 1); err == nil {
+		t.Error("negative page limit accepted")
+	}
+	if _, err := cl.GetMirrorXAssetPositions(&MirrorXAssetPositionsQuery{MirrorXLinkId: "1", PageNo: -1}); err == nil {
+		t.Error("negative page accepted")
+	}
+	// A zero start time in the positional wrappers means unset, not the epoch
+	if _, err := cl.GetTransferHistory("6", "", 0, 0, 0, 0, 0, 0); err == nil {
+		t.Error("zero startTime accepted")
+	}
+	if calls != 0 {
+		t.Fatalf("invalid queries sent %d requests", calls)
+	}
+}
@@ -0,0 +1,376 @@
+package ceffu
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IdempotencyRecord maps a caller supplied business key to a stable requestId.
+// Result holds the response of the completed call, if any.
+type IdempotencyRecord struct {
+	RequestId int64           `json:"requestId"`
+	CreatedAt int64           `json:"createdAt,omitempty"` // unix milliseconds, bounds the history searched on recovery
+	Digest    string          `json:"digest,omitempty"`    // sha256 of the parameters bound to the key
+	Completed bool            `json:"completed"`
+	Result    json.RawMessage `json:"result,omitempty"`
+}
+
+// ErrIdempotencyKeyReused is returned when a key is used again with different parameters
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with different parameters")
+
+// paramsDigest returns the hex sha256 of the json encoding of params, empty without params
+func paramsDigest(params ...interface{}) (string, error) {
+	if len(params) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// idempotencyLookback is searched for the original order of records without CreatedAt
+const idempotencyLookback = 24 * time.Hour
+
+// since returns the earliest time the order of the record could have been placed
+func (r *IdempotencyRecord) since() time.Time {
+	if r.CreatedAt == 0 {
+		return time.Now().Add(-idempotencyLookback)
+	}
+	// Allow for clock skew between this host and Ceffu
+	return time.UnixMilli(r.CreatedAt).Add(-time.Minute)
+}
+
+// IdempotencyStore persists idempotency records. Implementations must be safe for concurrent use.
+// Get returns nil without error if the key is unknown.
+type IdempotencyStore interface {
+	Get(key string) (*IdempotencyRecord, error)
+	Put(key string, record *IdempotencyRecord) error
+}
+
+// MemoryIdempotencyStore keeps records in memory, which only protects retries within one process.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: map[string]IdempotencyRecord{}}
+}
+
+func (s *MemoryIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (s *MemoryIdempotencyStore) Put(key string, record *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = *record
+	return nil
+}
+
+// FileIdempotencyStore keeps all records in a single json file, rewritten atomically on every Put.
+type FileIdempotencyStore struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]IdempotencyRecord
+}
+
+// NewFileIdempotencyStore loads the store at path, creating it on first Put if missing
+func NewFileIdempotencyStore(path string) (*FileIdempotencyStore, error) {
+	store := &FileIdempotencyStore{
+		path:    path,
+		records: map[string]IdempotencyRecord{},
+	}
+	encoded, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(encoded, &store.records)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *FileIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (s *FileIdempotencyStore) Put(key string, record *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, existed := s.records[key]
+	s.records[key] = *record
+	encoded, err := json.Marshal(s.records)
+	if err == nil {
+		// Write to temp file first, so a crash never leaves a half written store
+		err = os.WriteFile(s.path+".tmp", encoded, 0600)
+	}
+	if err == nil {
+		err = os.Rename(s.path+".tmp", s.path)
+	}
+	if err != nil {
+		// Keep memory consistent with disk
+		if existed {
+			s.records[key] = previous
+		} else {
+			delete(s.records, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// IdempotencyManager maps business keys to stable requestIds, so a call retried after
+// a crash or timeout reuses the requestId of the first attempt instead of creating a new order.
+type IdempotencyManager struct {
+	client *Client
+	store  IdempotencyStore
+	mu     sync.Mutex
+}
+
+func NewIdempotencyManager(client *Client, store IdempotencyStore) *IdempotencyManager {
+	return &IdempotencyManager{
+		client: client,
+		store:  store,
+	}
+}
+
+// RequestId returns the requestId for key, generating and persisting a new one on first use.
+// params, if given, are bound to key on first use, ErrIdempotencyKeyReused is returned
+// if key is used again with different params.
+func (m *IdempotencyManager) RequestId(key string, params ...interface{}) (int64, error) {
+	record, err := m.record(key, params...)
+	if err != nil {
+		return 0, err
+	}
+	return record.RequestId, nil
+}
+
+func (m *IdempotencyManager) record(key string, params ...interface{}) (*IdempotencyRecord, error) {
+	if key == "" {
+		return nil, errors.New("idempotency key is required")
+	}
+	digest, err := paramsDigest(params...)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, err := m.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		if digest == "" || record.Digest == digest {
+			return record, nil
+		}
+		if record.Digest != "" {
+			return nil, fmt.Errorf("%w: %q", ErrIdempotencyKeyReused, key)
+		}
+		// Bind the parameters to a key first used without them
+		record.Digest = digest
+		if err = m.store.Put(key, record); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+	record = &IdempotencyRecord{RequestId: GetReqId(), CreatedAt: time.Now().UnixMilli(), Digest: digest}
+	err = m.store.Put(key, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (m *IdempotencyManager) complete(key string, record *IdempotencyRecord, result interface{}) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	record.Completed = true
+	record.Result = encoded
+	return m.store.Put(key, record)
+}
+
+// Withdrawal is Client.Withdrawal keyed by a business key.
+// The parameters are bound to key, reusing key for another withdrawal returns ErrIdempotencyKeyReused.
+// Once a withdrawal for key succeeded, the stored result is returned without calling Ceffu.
+// If Ceffu rejects the requestId as duplicate (ErrorDuplicateReqID), the original withdrawal
+// is fetched with GetWithdrawalDetailByRequestId and returned instead of failing.
+func (m *IdempotencyManager) Withdrawal(key string, amount string, coinSymbol string, memo string, network string, walletId WalletID, withdrawalAddress string) (*WithdrawalResp, error) {
+	record, err := m.record(key, "withdrawal", amount, coinSymbol, memo, network, walletId.String(), withdrawalAddress)
+	if err != nil {
+		return nil, err
+	}
+	response := &WithdrawalResp{}
+	if record.Completed {
+		err = json.Unmarshal(record.Result, response)
+		if err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+	response, err = m.client.Withdrawal(amount, coinSymbol, memo, network, walletId, withdrawalAddress, record.RequestId)
+	if err != nil {
+		return nil, err
+	}
+	switch response.Code {
+	case CodeSuccess:
+	case ErrorDuplicateReqID:
+		original, err := m.client.recoverWithdrawal(record.RequestId)
+		if err != nil {
+			return nil, err
+		}
+		if original == nil {
+			// Original withdrawal can't be resolved, hand the duplicate response back to the caller
+			return response, nil
+		}
+		response = original
+	default:
+		return response, nil
+	}
+	err = m.complete(key, record, response)
+	if err != nil {
+		return response, err
+	}
+	return response, nil
+}
+
+// recoverWithdrawal returns the withdrawal placed with requestId as a Withdrawal response,
+// nil if Ceffu does not know it
+func (c *Client) recoverWithdrawal(requestId int64) (*WithdrawalResp, error) {
+	detail, err := c.GetWithdrawalDetailByRequestId(requestId)
+	if err != nil {
+		return nil, err
+	}
+	if detail.Code != CodeSuccess {
+		return nil, nil
+	}
+	return &WithdrawalResp{
+		Code:    detail.Code,
+		Message: detail.Message,
+		Data: WithdrawalResult{
+			OrderViewID:  detail.Data.OrderViewID,
+			Status:       WithdrawStatus(detail.Data.Status),
+			TransferType: TransferType(detail.Data.TransferType),
+		},
+	}, nil
+}
+
+// TransferWithExchange is Client.TransferWithExchangeWithRequestId keyed by a business key.
+// req.RequestId is replaced by the requestId of key. If Ceffu rejects it as duplicate
+// (ErrorDuplicateReqID), the original transfer is looked up in the exchange transfer history of req.WalletID.
+// The transfer parameters are bound to key like in Withdrawal.
+func (m *IdempotencyManager) TransferWithExchange(key string, req ExchangeTransferReq) (*TransferWithExchangeResp, error) {
+	bound := req
+	bound.RequestId, bound.PollInterval, bound.Lookback = 0, 0, 0
+	record, err := m.record(key, "exchangeTransfer", bound)
+	if err != nil {
+		return nil, err
+	}
+	response := &TransferWithExchangeResp{}
+	if record.Completed {
+		err = json.Unmarshal(record.Result, response)
+		if err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+	req.RequestId = record.RequestId
+	if req.Lookback <= 0 {
+		req.Lookback = time.Since(record.since())
+	}
+	transfer, err := m.client.NewExchangeTransfer(req)
+	if err != nil {
+		return nil, err
+	}
+	var parentWalletId []WalletID
+	if req.ParentWalletID != "" {
+		parentWalletId = append(parentWalletId, req.ParentWalletID)
+	}
+	response, err = m.client.TransferWithExchangeWithRequestId(record.RequestId, req.Amount, req.CoinSymbol, req.Direction, transfer.req.ExchangeCode, req.ExchangeUserID, parentWalletId...)
+	if err != nil {
+		return nil, err
+	}
+	switch response.Code {
+	case CodeSuccess:
+	case ErrorDuplicateReqID:
+		if err = transfer.recover(); err != nil {
+			return nil, err
+		}
+		response.Code = CodeSuccess
+		response.Message = ""
+		response.Data = ExchangeTransferResult{
+			OrderViewID: transfer.OrderViewID,
+			Status:      transfer.Status,
+			Direction:   req.Direction,
+		}
+	default:
+		return response, nil
+	}
+	err = m.complete(key, record, response)
+	if err != nil {
+		return response, err
+	}
+	return response, nil
+}
+
+// CreateMirrorXOrder is Client.CreateMirrorXOrder keyed by a business key.
+// req.RequestId is replaced by the requestId of key, the order parameters are bound to key like in Withdrawal.
+// Ceffu can't look up MirrorX orders by requestId, so a duplicate response (ErrorDuplicateReqID)
+// is handed back to the caller, who has to find the original order in the delegation orders of the link.
+func (m *IdempotencyManager) CreateMirrorXOrder(key string, req CreateMirrorXOrderReq) (*CreateMirrorXOrderResp, error) {
+	bound := req
+	bound.RequestId = ""
+	record, err := m.record(key, "mirrorXOrder", bound)
+	if err != nil {
+		return nil, err
+	}
+	response := &CreateMirrorXOrderResp{}
+	if record.Completed {
+		err = json.Unmarshal(record.Result, response)
+		if err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+	req.RequestId = strconv.FormatInt(record.RequestId, 10)
+	response, err = m.client.CreateMirrorXOrder(&req)
+	if err != nil {
+		return nil, err
+	}
+	if response.Code != CodeSuccess {
+		return response, nil
+	}
+	err = m.complete(key, record, response)
+	if err != nil {
+		return response, err
+	}
+	return response, nil
+}
@@ -0,0 +1,158 @@
+package ceffu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIdempotentWithdrawal(t *testing.T) {
+	var requestIds []int64
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if !strings.Contains(r.URL.RawQuery, "requestId=") {
+				t.Errorf("detail lookup without requestId: %s", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`{"code":"000000","message":"success","data":{"orderViewId":"original","status":30,"transferType":10}}`))
+			return
+		}
+		var body struct {
+			RequestId int64 `json:"requestId"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		requestIds = append(requestIds, body.RequestId)
+		// Simulate a crash after Ceffu accepted the first attempt
+		_, _ = w.Write([]byte(`{"code":"G20015","message":"duplicate request id"}`))
+	})
+	path := filepath.Join(t.TempDir(), "idempotency.json")
+	store, err := NewFileIdempotencyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := NewIdempotencyManager(cl, store).RequestId("payout-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A restarted process loads the same requestId from disk
+	store, err = NewFileIdempotencyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := NewIdempotencyManager(cl, store)
+	resp, err := manager.Withdrawal("payout-1", "1", "USDT", "", "ETH", "1", "0x0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != CodeSuccess || resp.Data.OrderViewID != "original" || resp.Data.Status != WithdrawStatusSuccess {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if len(requestIds) != 1 || requestIds[0] != first {
+		t.Fatalf("expected single withdrawal with requestId %d, got %v", first, requestIds)
+	}
+	// Completed keys are answered from the store
+	resp, err = manager.Withdrawal("payout-1", "1", "USDT", "", "ETH", "1", "0x0")
+	if err != nil || resp.Data.OrderViewID != "original" || len(requestIds) != 1 {
+		t.Fatalf("expected stored result, got %+v %v", resp, err)
+	}
+}
+
+func TestIdempotentExchangeAndMirrorX(t *testing.T) {
+	manager := NewIdempotencyManager(nil, NewMemoryIdempotencyStore())
+	transferId, _ := manager.RequestId("transfer-1")
+	posts, lists := 0, 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/wallet/transfer/exchange/history":
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"code":"000000","data":{"data":[{"orderViewId":"other","status":30,"requestId":1},{"orderViewId":"transfer","status":30,"requestId":%d}],"totalPage":1}}`, transferId)))
+		case "/open-api/v1/mirrorX/order/list":
+			lists++
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[],"totalPage":1}}`))
+		default:
+			posts++
+			_, _ = w.Write([]byte(`{"code":"G20015","message":"duplicate request id"}`))
+		}
+	})
+	manager.client = cl
+
+	transferReq := ExchangeTransferReq{
+		WalletID:       "1",
+		CoinSymbol:     "USDT",
+		Amount:         "5",
+		Direction:      TransferDirectionIntDeposit,
+		ExchangeUserID: "uid",
+	}
+	transfer, err := manager.TransferWithExchange("transfer-1", transferReq)
+	if err != nil || transfer.Code != CodeSuccess || transfer.Data.OrderViewID != "transfer" {
+		t.Fatalf("transfer not recovered: %+v %v", transfer, err)
+	}
+	// MirrorX orders can't be looked up by requestId, the duplicate is handed back
+	order, err := manager.CreateMirrorXOrder("order-1", CreateMirrorXOrderReq{MirrorXLinkId: "11", OrderType: MirrorXOrderTypeDeposit, CoinSymbol: "USDT", Amount: "5"})
+	if err != nil || order.Code != ErrorDuplicateReqID {
+		t.Fatalf("expected unresolved duplicate, got %+v %v", order, err)
+	}
+	if lists != 0 {
+		t.Fatalf("order list searched %d times", lists)
+	}
+	// Completed keys are answered from the store
+	if _, err = manager.TransferWithExchange("transfer-1", transferReq); err != nil || posts != 2 {
+		t.Fatalf("expected stored result, %d posts %v", posts, err)
+	}
+}
+
+func TestIdempotencyKeyReuse(t *testing.T) {
+	posts := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		_, _ = w.Write([]byte(`{"code":"000000","data":{"orderViewId":"payout"}}`))
+	})
+	manager := NewIdempotencyManager(cl, NewMemoryIdempotencyStore())
+	if _, err := manager.Withdrawal("payout-1", "1", "USDT", "", "ETH", "1", "0x0"); err != nil {
+		t.Fatal(err)
+	}
+	for name, reuse := range map[string]func() error{
+		"amount": func() error {
+			_, err := manager.Withdrawal("payout-1", "2", "USDT", "", "ETH", "1", "0x0")
+			return err
+		},
+		"address": func() error {
+			_, err := manager.Withdrawal("payout-1", "1", "USDT", "", "ETH", "1", "0x1")
+			return err
+		},
+		"operation": func() error {
+			_, err := manager.CreateMirrorXOrder("payout-1", CreateMirrorXOrderReq{MirrorXLinkId: "11", OrderType: MirrorXOrderTypeDeposit, CoinSymbol: "USDT", Amount: "1"})
+			return err
+		},
+	} {
+		if err := reuse(); !errors.Is(err, ErrIdempotencyKeyReused) {
+			t.Errorf("%s: expected reused key, got %v", name, err)
+		}
+	}
+	if _, err := manager.Withdrawal("payout-1", "1", "USDT", "", "ETH", "1", "0x0"); err != nil || posts != 1 {
+		t.Fatalf("expected stored result, %d posts %v", posts, err)
+	}
+	// A key first used without parameters is bound on its first call
+	if _, err := manager.RequestId("payout-2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Withdrawal("payout-2", "1", "USDT", "", "ETH", "1", "0x0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Withdrawal("payout-2", "3", "USDT", "", "ETH", "1", "0x0"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("expected reused key, got %v", err)
+	}
+}
+
+func TestGetReqIdUnique(t *testing.T) {
+	seen := map[int64]bool{}
+	for i := 0; i < 10000; i++ {
+		id := GetReqId()
+		if id <= 0 || seen[id] {
+			t.Fatalf("bad request id %d", id)
+		}
+		seen[id] = true
+	}
+}
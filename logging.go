@@ -0,0 +1,207 @@
+package ceffu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Redacted replaces sensitive values in logs
+const Redacted = "[REDACTED]"
+
+// maxLoggedBody is the number of bytes of a response body included in logs
+const maxLoggedBody = 4096
+
+// Redaction selects which values are hidden from logs. Signatures, api keys and memos are always redacted.
+type Redaction struct {
+	// KeepAddresses logs addresses in clear, they are redacted by default
+	KeepAddresses bool
+	// Keys are additional attribute and payload keys to redact, matched case insensitive
+	Keys []string
+}
+
+func (r Redaction) sensitive(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "signature", "open-apikey", "apikey", "memo":
+		return true
+	}
+	if !r.KeepAddresses && strings.Contains(key, "address") {
+		return true
+	}
+	for _, extra := range r.Keys {
+		if strings.EqualFold(extra, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactPayload redacts a json body or a query string.
+// Numbers are kept as written, large ids would lose precision as float64.
+func (r Redaction) redactPayload(payload string) string {
+	var decoded interface{}
+	decoder := json.NewDecoder(strings.NewReader(payload))
+	decoder.UseNumber()
+	if decoder.Decode(&decoded) == nil && decoder.Decode(new(interface{})) == io.EOF {
+		encoded, err := json.Marshal(r.redactValue(decoded))
+		if err == nil {
+			return string(encoded)
+		}
+	}
+	pairs := strings.Split(payload, "&")
+	for i, pair := range pairs {
+		key, _, found := strings.Cut(pair, "=")
+		if found && r.sensitive(key) {
+			pairs[i] = key + "=" + Redacted
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// redactError returns the text of err for logs. The body carried by a *TransportError is left out,
+// it is only logged redacted with LogConfig.Bodies.
+func (r Redaction) redactError(err error) string {
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return fmt.Sprintf("ceffu: %s: http %d: %s", transportErr.Endpoint, transportErr.StatusCode, transportErr.Err)
+	}
+	return err.Error()
+}
+
+func (r Redaction) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			if r.sensitive(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = r.redactValue(inner)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = r.redactValue(v[i])
+		}
+	}
+	return value
+}
+
+func (r Redaction) redactAttr(attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindGroup {
+		group := attr.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i := range group {
+			redacted[i] = r.redactAttr(group[i])
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+	}
+	if r.sensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
+
+// RedactingHandler is a slog.Handler hiding the values of sensitive attributes before passing records on
+type RedactingHandler struct {
+	next      slog.Handler
+	redaction Redaction
+}
+
+// NewRedactingHandler wraps next, redacting attributes selected by redaction
+func NewRedactingHandler(next slog.Handler, redaction Redaction) *RedactingHandler {
+	return &RedactingHandler{next: next, redaction: redaction}
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redaction.redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i := range attrs {
+		redacted[i] = h.redaction.redactAttr(attrs[i])
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redacted), redaction: h.redaction}
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name), redaction: h.redaction}
+}
+
+// LogConfig configures structured request logging
+type LogConfig struct {
+	// Level successful requests are logged at, default slog.LevelInfo.
+	// Responses with a non success code are logged at slog.LevelWarn, transport errors at slog.LevelError.
+	Level slog.Level
+	// Bodies adds the redacted request payload and response body to every log record
+	Bodies bool
+	// Redaction selects which values are hidden
+	Redaction Redaction
+}
+
+// WithSlog logs every request through handler, wrapped in a RedactingHandler.
+// Messages passed to Logf are logged at slog.LevelWarn if no *log.Logger was given to New.
+func WithSlog(handler slog.Handler, config LogConfig) Option {
+	return func(c *Client) {
+		c.slog = slog.New(NewRedactingHandler(handler, config.Redaction))
+		c.logConfig = config
+	}
+}
+
+// logRequest writes a structured record for a finished request
+func (c *Client) logRequest(ctx context.Context, signed *signedRequest, status int, code string, duration time.Duration, body []byte, err error) {
+	level := c.logConfig.Level
+	if err != nil {
+		level = slog.LevelError
+	} else if code != "" && code != CodeSuccess {
+		level = slog.LevelWarn
+	}
+	if !c.slog.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", signed.Method),
+		slog.String("endpoint", signed.Endpoint),
+		slog.Duration("duration", duration),
+		slog.Int("httpStatus", status),
+	}
+	if code != "" {
+		attrs = append(attrs, slog.String("code", code))
+	}
+	if signed.RequestId != "" {
+		attrs = append(attrs, slog.String("requestId", signed.RequestId))
+	}
+	if signed.WalletId != "" {
+		attrs = append(attrs, slog.String("walletId", signed.WalletId))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", c.logConfig.Redaction.redactError(err)))
+	}
+	if c.logConfig.Bodies {
+		// Redact before truncating, a truncated json body could not be parsed anymore
+		response := c.logConfig.Redaction.redactPayload(string(body))
+		if len(response) > maxLoggedBody {
+			response = response[:maxLoggedBody]
+		}
+		attrs = append(attrs,
+			slog.String("payload", c.logConfig.Redaction.redactPayload(signed.Payload)),
+			slog.String("response", response),
+		)
+	}
+	c.slog.LogAttrs(ctx, level, "ceffu request", attrs...)
+}
@@ -0,0 +1,86 @@
+package ceffu
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSlogRequestLogging(t *testing.T) {
+	cl := newRouteClient(t, map[string]string{
+		"/open-api/v1/wallet/deposit/address": `{"code":"000000","data":{"walletAddress":"0xdeadbeef","memo":"secret-memo"}}`,
+		"/open-api/v2/wallet/withdrawal":      `{"code":"G20015","message":"duplicate request id"}`,
+	})
+	var out bytes.Buffer
+	WithSlog(slog.NewJSONHandler(&out, nil), LogConfig{Bodies: true})(cl)
+
+	_, err := cl.GetDepositAddress("USDT", "ETH", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Withdrawal("1", "USDT", "memo-1", "ETH", "8", "0xfeedface", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"0xdeadbeef", "secret-memo", "0xfeedface", "memo-1"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("%s not redacted:\n%s", secret, out.String())
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(lines))
+	}
+	var record map[string]interface{}
+	if err = json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["level"] != "WARN" || record["code"] != ErrorDuplicateReqID || record["endpoint"] != "/open-api/v2/wallet/withdrawal" || record["requestId"] != "42" {
+		t.Fatalf("unexpected record %v", record)
+	}
+}
+
+func TestRedactingHandler(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(NewRedactingHandler(slog.NewTextHandler(&out, nil), Redaction{KeepAddresses: true, Keys: []string{"customer"}}))
+	logger.With("signature", "abc").Info("test", "withdrawalAddress", "0x1", slog.Group("user", "customer", "bob", "memo", "m"))
+	for _, expected := range []string{"signature=" + Redacted, "withdrawalAddress=0x1", "user.customer=" + Redacted, "user.memo=" + Redacted} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("missing %s in %s", expected, out.String())
+		}
+	}
+}
+
+func TestRedactQueryString(t *testing.T) {
+	redacted := Redaction{}.redactPayload("coinSymbol=USDT&toAddress=0xabc&timestamp=1")
+	if redacted != "coinSymbol=USDT&toAddress="+Redacted+"&timestamp=1" {
+		t.Fatalf("unexpected %s", redacted)
+	}
+}
+
+func TestRedactKeepsNumbers(t *testing.T) {
+	redacted := Redaction{}.redactPayload(`{"requestId":4611686018427387904,"walletId":123456789012345678,"amount":0.10,"toAddress":"0xabc"}`)
+	for _, expected := range []string{`"requestId":4611686018427387904`, `"walletId":123456789012345678`, `"amount":0.10`, `"toAddress":"` + Redacted + `"`} {
+		if !strings.Contains(redacted, expected) {
+			t.Errorf("missing %s in %s", expected, redacted)
+		}
+	}
+}
+
+func TestSlogTransportErrorRedacted(t *testing.T) {
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`<html>toAddress=0xdeadbeef</html>`))
+	})
+	var out bytes.Buffer
+	WithSlog(slog.NewJSONHandler(&out, nil), LogConfig{})(cl)
+	if _, err := cl.GetAssetSummary("7"); err == nil {
+		t.Fatal("expected transport error")
+	}
+	if strings.Contains(out.String(), "0xdeadbeef") || !strings.Contains(out.String(), "http 502") {
+		t.Fatalf("unexpected record %s", out.String())
+	}
+}
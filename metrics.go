@@ -0,0 +1,333 @@
+package ceffu
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the request latency histogram
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metricSeries maps a rendered label set to its value
+type metricSeries map[string]float64
+
+type latencyHistogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Metrics collects request metrics from the transport and optional balance gauges and
+// exposes them in the Prometheus text exposition format. It is safe for concurrent use.
+type Metrics struct {
+	mu      sync.Mutex
+	buckets []float64
+
+	requests        metricSeries
+	apiErrors       metricSeries
+	transportErrors metricSeries
+	latency         map[string]*latencyHistogram
+
+	balances          metricSeries
+	availableBalances metricSeries
+	pendingCount      metricSeries
+	pendingAmount     metricSeries
+	positions         metricSeries
+	gaugeErrors       float64
+}
+
+// NewMetrics creates an empty collector, buckets are the latency histogram bounds in seconds,
+// DefaultLatencyBuckets if none are given
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{
+		buckets:           buckets,
+		requests:          metricSeries{},
+		apiErrors:         metricSeries{},
+		transportErrors:   metricSeries{},
+		latency:           map[string]*latencyHistogram{},
+		balances:          metricSeries{},
+		availableBalances: metricSeries{},
+		pendingCount:      metricSeries{},
+		pendingAmount:     metricSeries{},
+		positions:         metricSeries{},
+	}
+}
+
+// WithMetrics records every request made by the client into m
+func WithMetrics(m *Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricLabels renders name, value pairs as a Prometheus label set
+func metricLabels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// observe records a single request, called by the transport after every round trip
+func (m *Metrics) observe(method string, endpoint string, status int, code string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[metricLabels("endpoint", endpoint, "method", method, "status", strconv.Itoa(status))]++
+	if err != nil {
+		m.transportErrors[metricLabels("endpoint", endpoint)]++
+	} else if code != "" && code != CodeSuccess {
+		m.apiErrors[metricLabels("endpoint", endpoint, "code", code)]++
+	}
+	key := metricLabels("endpoint", endpoint)
+	histogram, ok := m.latency[key]
+	if !ok {
+		histogram = &latencyHistogram{counts: make([]uint64, len(m.buckets))}
+		m.latency[key] = histogram
+	}
+	seconds := latency.Seconds()
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			histogram.counts[i]++
+			break
+		}
+	}
+	histogram.sum += seconds
+	histogram.count++
+}
+
+// MetricsGaugeConfig selects the gauges UpdateGauges collects
+type MetricsGaugeConfig struct {
+	// Balances collects the balance of every coin in every wallet from GetAssetDetails
+	Balances bool
+	// PendingWithdrawals collects the number and amount of pending and processing withdrawals per wallet and coin
+	PendingWithdrawals bool
+	// PendingLookback is how far back withdrawals are considered, default 7 days
+	PendingLookback time.Duration
+	// MirrorXPositions collects the balance of every MirrorX position
+	MirrorXPositions bool
+}
+
+// UpdateGauges queries Ceffu and replaces the gauges selected by config.
+// On error the previous values are kept.
+func (m *Metrics) UpdateGauges(client *Client, config MetricsGaugeConfig) error {
+	err := m.updateGauges(client, config)
+	if err != nil {
+		m.mu.Lock()
+		m.gaugeErrors++
+		m.mu.Unlock()
+	}
+	return err
+}
+
+func (m *Metrics) updateGauges(client *Client, config MetricsGaugeConfig) error {
+	balances := metricSeries{}
+	availableBalances := metricSeries{}
+	pendingCount := metricSeries{}
+	pendingAmount := metricSeries{}
+	positions := metricSeries{}
+	if config.Balances || config.PendingWithdrawals {
+		wallets, err := client.listAllWallets()
+		if err != nil {
+			return err
+		}
+		if config.PendingLookback <= 0 {
+			config.PendingLookback = 7 * 24 * time.Hour
+		}
+		for _, wallet := range wallets {
+			walletId := NewWalletID(wallet.WalletID)
+			if config.Balances {
+				assets, err := client.listAllAssets(walletId)
+				if err != nil {
+					return err
+				}
+				for _, asset := range assets {
+					labels := metricLabels("wallet_id", walletId.String(), "coin", asset.CoinSymbol, "network", asset.Network)
+					balances[labels], _ = strconv.ParseFloat(asset.Amount, 64)
+					availableBalances[labels], _ = strconv.ParseFloat(asset.AvailableAmount, 64)
+				}
+			}
+			if config.PendingWithdrawals {
+				query := &WithdrawalHistoryQuery{WalletID: walletId, StartTime: time.Now().Add(-config.PendingLookback)}
+				err := forEachPage(func(pageNo int) (int, error) {
+					query.PageNo = pageNo
+					resp, err := client.QueryWithdrawalHistory(query)
+					if err != nil {
+						return 0, err
+					}
+					if err = checkCode(resp.Code, resp.Message); err != nil {
+						return 0, err
+					}
+					for _, withdrawal := range resp.Data.Data {
+						status := WithdrawStatus(withdrawal.Status)
+						if status != WithdrawStatusPending && status != WithdrawStatusProcessing {
+							continue
+						}
+						labels := metricLabels("wallet_id", walletId.String(), "coin", withdrawal.CoinSymbol)
+						amount, _ := strconv.ParseFloat(withdrawal.Amount, 64)
+						pendingCount[labels]++
+						pendingAmount[labels] += amount
+					}
+					return resp.Data.TotalPage, nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if config.MirrorXPositions {
+		links, err := client.listAllMirrorXLinks()
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			linkPositions, err := client.listAllMirrorXPositions(link.MirrorXLinkId, false)
+			if err != nil {
+				return err
+			}
+			for _, position := range linkPositions {
+				labels := metricLabels("mirrorx_link_id", link.MirrorXLinkId.String(), "coin", position.CoinSymbol)
+				positions[labels], _ = strconv.ParseFloat(position.MirrorXBalance, 64)
+			}
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if config.Balances {
+		m.balances = balances
+		m.availableBalances = availableBalances
+	}
+	if config.PendingWithdrawals {
+		m.pendingCount = pendingCount
+		m.pendingAmount = pendingAmount
+	}
+	if config.MirrorXPositions {
+		m.positions = positions
+	}
+	return nil
+}
+
+// RunGauges calls UpdateGauges every interval until ctx is done, failures are logged through client
+func (m *Metrics) RunGauges(ctx context.Context, client *Client, config MetricsGaugeConfig, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.UpdateGauges(client, config); err != nil {
+			client.Logf("ceffu: failed to update metric gauges: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counter := &countingWriter{w: bufio.NewWriter(w)}
+	writeSeries := func(name string, kind string, help string, series metricSeries) {
+		if len(series) == 0 {
+			return
+		}
+		fmt.Fprintf(counter, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, labels := range sortedKeys(series) {
+			fmt.Fprintf(counter, "%s{%s} %s\n", name, labels, formatMetricValue(series[labels]))
+		}
+	}
+	writeSeries("ceffu_requests_total", "counter", "Requests sent to Ceffu by endpoint, method and http status.", m.requests)
+	writeSeries("ceffu_api_errors_total", "counter", "Responses with a non success Ceffu code by endpoint and code.", m.apiErrors)
+	writeSeries("ceffu_transport_errors_total", "counter", "Requests that failed with a network error or a response that is not Ceffu json, e.g. an http error page, by endpoint.", m.transportErrors)
+	if len(m.latency) > 0 {
+		name := "ceffu_request_duration_seconds"
+		fmt.Fprintf(counter, "# HELP %s Request latency by endpoint.\n# TYPE %s histogram\n", name, name)
+		keys := make([]string, 0, len(m.latency))
+		for labels := range m.latency {
+			keys = append(keys, labels)
+		}
+		sort.Strings(keys)
+		for _, labels := range keys {
+			histogram := m.latency[labels]
+			var cumulative uint64
+			for i, bound := range m.buckets {
+				cumulative += histogram.counts[i]
+				fmt.Fprintf(counter, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatMetricValue(bound), cumulative)
+			}
+			fmt.Fprintf(counter, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, histogram.count)
+			fmt.Fprintf(counter, "%s_sum{%s} %s\n", name, labels, formatMetricValue(histogram.sum))
+			fmt.Fprintf(counter, "%s_count{%s} %d\n", name, labels, histogram.count)
+		}
+	}
+	writeSeries("ceffu_wallet_balance", "gauge", "Wallet balance by wallet, coin and network.", m.balances)
+	writeSeries("ceffu_wallet_available_balance", "gauge", "Available wallet balance by wallet, coin and network.", m.availableBalances)
+	writeSeries("ceffu_pending_withdrawals", "gauge", "Pending and processing withdrawals by wallet and coin.", m.pendingCount)
+	writeSeries("ceffu_pending_withdrawal_amount", "gauge", "Amount of pending and processing withdrawals by wallet and coin.", m.pendingAmount)
+	writeSeries("ceffu_mirrorx_position", "gauge", "MirrorX position balance by link and coin.", m.positions)
+	if m.gaugeErrors > 0 {
+		fmt.Fprintf(counter, "# HELP ceffu_gauge_update_errors_total Failed gauge updates.\n# TYPE ceffu_gauge_update_errors_total counter\nceffu_gauge_update_errors_total %s\n", formatMetricValue(m.gaugeErrors))
+	}
+	if counter.err != nil {
+		return counter.n, counter.err
+	}
+	return counter.n, counter.w.Flush()
+}
+
+// ServeHTTP serves the metrics for a Prometheus scrape
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+func sortedKeys(series metricSeries) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// countingWriter counts written bytes and keeps the first error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,80 @@
+package ceffu
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	cl := newRouteClient(t, map[string]string{
+		"/open-api/v1/wallet/list":               `{"code":"000000","data":{"data":[{"walletId":7,"walletType":10}],"totalPage":1}}`,
+		"/open-api/v1/wallet/asset/list":         `{"code":"000000","data":{"data":[{"coinSymbol":"USDT","network":"ETH","amount":"12.5","availableAmount":"10"}],"totalPage":1}}`,
+		"/open-api/v1/wallet/withdrawal/history": `{"code":"000000","data":{"data":[{"coinSymbol":"BTC","amount":"0.5","status":10},{"coinSymbol":"BTC","amount":"1","status":20},{"coinSymbol":"BTC","amount":"3","status":30}],"totalPage":1}}`,
+		"/open-api/v1/wallet/deposit/address":    `{"code":"G20025","message":"address not activated"}`,
+	})
+	metrics := NewMetrics()
+	WithMetrics(metrics)(cl)
+	_, err := cl.GetDepositAddress("USDT", "ETH", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = metrics.UpdateGauges(cl, MetricsGaugeConfig{Balances: true, PendingWithdrawals: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		"# TYPE ceffu_requests_total counter",
+		`ceffu_requests_total{endpoint="/open-api/v1/wallet/list",method="GET",status="200"} 1`,
+		`ceffu_api_errors_total{endpoint="/open-api/v1/wallet/deposit/address",code="G20025"} 1`,
+		`ceffu_request_duration_seconds_bucket{endpoint="/open-api/v1/wallet/list",le="+Inf"} 1`,
+		`ceffu_request_duration_seconds_count{endpoint="/open-api/v1/wallet/asset/list"} 1`,
+		`ceffu_wallet_balance{wallet_id="7",coin="USDT",network="ETH"} 12.5`,
+		`ceffu_wallet_available_balance{wallet_id="7",coin="USDT",network="ETH"} 10`,
+		`ceffu_pending_withdrawals{wallet_id="7",coin="BTC"} 2`,
+		`ceffu_pending_withdrawal_amount{wallet_id="7",coin="BTC"} 1.5`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("missing %q in\n%s", expected, body)
+		}
+	}
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", recorder.Header().Get("Content-Type"))
+	}
+}
+
+func TestMetricLabelsEscape(t *testing.T) {
+	if labels := metricLabels("a", `x"y\z`+"\n"); labels != `a="x\"y\\z\n"` {
+		t.Fatalf("unexpected labels %s", labels)
+	}
+}
+
+func TestMetricsTransportErrors(t *testing.T) {
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("<html>bad gateway</html>"))
+	})
+	metrics := NewMetrics()
+	WithMetrics(metrics)(cl)
+	if _, err := cl.GetAssetSummary("7"); err == nil {
+		t.Fatal("expected transport error")
+	}
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	// Error pages are counted as transport errors along with their http status
+	for _, expected := range []string{
+		"# HELP ceffu_transport_errors_total Requests that failed with a network error or a response that is not Ceffu json",
+		`ceffu_transport_errors_total{endpoint="/open-api/v1/wallet/asset/summary"} 1`,
+		`ceffu_requests_total{endpoint="/open-api/v1/wallet/asset/summary",method="GET",status="502"} 1`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("missing %q in\n%s", expected, body)
+		}
+	}
+}
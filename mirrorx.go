@@ -2,8 +2,8 @@ package ceffu
 
 import (
 	"encoding/json"
-	"math"
-	"math/rand"
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 )
@@ -16,232 +16,292 @@ const (
 	CreateMirrorXOrderApi         = "mirrorX/order"
 )
 
-type GetMirrorXLinkListResp struct {
-	Data struct {
-		Data []struct {
-			MirrorXLinkId string `json:"mirrorXLinkId"`
-			BinanceUID    string `json:"binanceUID"`
-			WalletIdStr   string `json:"walletIdStr"`
-			Label         string `json:"label"`
-			Status        int    `json:"status"`
-			CreateDate    string `json:"createDate"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
-
-type GetMirrorXDelegationOrdersResp struct {
-	Data struct {
-		Data []struct {
-			MirrorXLinkId string `json:"mirrorXLinkId"`
-			BinanceUID    string `json:"binanceUID"`
-			WalletIdStr   string `json:"walletIdStr"`
-			OrderType     int    `json:"orderType"`
-			Amount        string `json:"amount"`
-			CoinSymbol    string `json:"coinSymbol"`
-			Status        int    `json:"status"`
-			OrderTime     string `json:"orderTime"`
-			OrderViewId   string `json:"orderViewId"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
-
-type GetMirrorXAvailableAmountResp struct {
-	Data struct {
-		CoinSymbol         string `json:"coinSymbol"`
-		MaxAvailableAmount string `json:"maxAvailableAmount"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
-
-type GetMirrorXAssetPositionsResp struct {
-	Data struct {
-		Data []struct {
-			MirrorXLinkId  string `json:"mirrorXLinkId"`
-			BinanceUID     string `json:"binanceUID"`
-			WalletIdStr    string `json:"walletIdStr"`
-			CoinSymbol     string `json:"coinSymbol"`
-			MirrorXBalance string `json:"mirrorXBalance"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+// MirrorXLinkID identifies a MirrorX link, the binding between a Ceffu wallet and a Binance account.
+// Ceffu returns it as string but expects a number in request bodies, both forms are accepted when decoding.
+type MirrorXLinkID string
+
+func (id MirrorXLinkID) String() string {
+	return string(id)
 }
 
-type CreateMirrorXOrderReq struct {
-	MirrorXLinkId int    `json:"mirrorXLinkId"`
-	OrderType     int    `json:"orderType"`
-	CoinSymbol    string `json:"coinSymbol"`
-	Amount        string `json:"amount"`
-	RequestId     string `json:"requestId"`
+func (id MirrorXLinkID) validate() error {
+	if id == "" {
+		return errors.New("mirrorXLinkId is required")
+	}
+	if !id.numeric() {
+		return fmt.Errorf("invalid mirrorXLinkId %q", string(id))
+	}
+	return nil
 }
 
-type CreateMirrorXOrderResp struct {
-	Data struct {
-		OrderViewId string `json:"orderViewId"`
-		Status      int    `json:"status"`
-		RequestId   string `json:"requestId"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+// numeric reports whether id is a plain decimal int64 without sign or leading zeros,
+// which is also its JSON encoding as a number
+func (id MirrorXLinkID) numeric() bool {
+	s := string(id)
+	if s == "" || s[0] == '+' || s[0] == '-' || (len(s) > 1 && s[0] == '0') {
+		return false
+	}
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
 }
 
-func (c *Client) GetMirrorXLinkList(pageLimit, pageNo int) (*GetMirrorXLinkListResp, error) {
-	params := map[string]string{
-		"pageLimit": strconv.Itoa(pageLimit),
-		"pageNo":    strconv.Itoa(pageNo),
+func (id MirrorXLinkID) MarshalJSON() ([]byte, error) {
+	if id.numeric() {
+		return []byte(id), nil
 	}
-	resp, err := c.get(GetMirrorXLinkIdListApi, params)
-	if err != nil {
-		return nil, err
+	return json.Marshal(string(id))
+}
+
+func (id *MirrorXLinkID) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		*id = MirrorXLinkID(s)
+		return nil
 	}
-	var result GetMirrorXLinkListResp
-	err = json.Unmarshal(resp, &result)
+	var n json.Number
+	err := json.Unmarshal(data, &n)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &result, nil
+	*id = MirrorXLinkID(n.String())
+	return nil
 }
 
-// GetMirrorXDelegationOrders get mirrorX delegation orders
-// @param mirrorXLinkId: mirrorXLinkId, must have, binded binance uid
-// @param coinSymbol: coin symbol optional, if not set, will return all orders, example: "USDT"
-// @param orderType: order type, optional, if not set, will return all orders, 10: buy, 20: sell
-// @param startTime: start time, required
-// @param endTime: end time, required
-// @param pageLimit: page limit, optional, default 10
-// @param pageNo: page no, optional, default 1
-func (c *Client) GetMirrorXDelegationOrders(mirrorXLinkId string, coinSymbol string, orderType MirrorXOrderType, startTime int, endTime int, pageLimit int, pageNo int) (*GetMirrorXDelegationOrdersResp, error) {
-	params := map[string]string{
-		"mirrorXLinkId": mirrorXLinkId,
-		"startTime":     strconv.Itoa(startTime),
+type MirrorXLink struct {
+	MirrorXLinkId MirrorXLinkID `json:"mirrorXLinkId"`
+	BinanceUID    string        `json:"binanceUID"`
+	WalletIdStr   string        `json:"walletIdStr"`
+	Label         string        `json:"label"`
+	Status        int           `json:"status"`
+	CreateDate    string        `json:"createDate"`
+}
+
+type GetMirrorXLinkListResp = Envelope[Page[MirrorXLink]]
+
+type MirrorXOrder struct {
+	MirrorXLinkId MirrorXLinkID      `json:"mirrorXLinkId"`
+	BinanceUID    string             `json:"binanceUID"`
+	WalletIdStr   string             `json:"walletIdStr"`
+	OrderType     MirrorXOrderType   `json:"orderType"`
+	Amount        string             `json:"amount"`
+	CoinSymbol    string             `json:"coinSymbol"`
+	Status        MirrorXOrderStatus `json:"status"`
+	OrderTime     string             `json:"orderTime"`
+	OrderViewId   string             `json:"orderViewId"`
+	RequestId     string             `json:"requestId"` // Empty if Ceffu does not return it
+}
+
+type GetMirrorXDelegationOrdersResp = Envelope[Page[MirrorXOrder]]
+
+type MirrorXAvailableAmount struct {
+	CoinSymbol         string `json:"coinSymbol"`
+	MaxAvailableAmount string `json:"maxAvailableAmount"`
+}
+
+type GetMirrorXAvailableAmountResp = Envelope[MirrorXAvailableAmount]
+
+type MirrorXPosition struct {
+	MirrorXLinkId  MirrorXLinkID `json:"mirrorXLinkId"`
+	BinanceUID     string        `json:"binanceUID"`
+	WalletIdStr    string        `json:"walletIdStr"`
+	CoinSymbol     string        `json:"coinSymbol"`
+	MirrorXBalance string        `json:"mirrorXBalance"`
+}
+
+type GetMirrorXAssetPositionsResp = Envelope[Page[MirrorXPosition]]
+
+type MirrorXOrderResult struct {
+	OrderViewId string             `json:"orderViewId"`
+	Status      MirrorXOrderStatus `json:"status"`
+	RequestId   string             `json:"requestId"`
+}
+
+type CreateMirrorXOrderResp = Envelope[MirrorXOrderResult]
+
+// MirrorXDelegationOrdersQuery filters GetMirrorXDelegationOrders
+type MirrorXDelegationOrdersQuery struct {
+	MirrorXLinkId MirrorXLinkID    // required
+	CoinSymbol    string           // optional, all coins if empty
+	OrderType     MirrorXOrderType // optional, MirrorXOrderTypeAll by default
+	StartTime     time.Time        // required
+	EndTime       time.Time        // optional, default now
+	PageLimit     int              // optional, default 25, max 25
+	PageNo        int              // optional, default 1
+}
+
+func (q *MirrorXDelegationOrdersQuery) Validate() error {
+	if err := q.MirrorXLinkId.validate(); err != nil {
+		return err
 	}
-	if endTime == 0 {
-		// Set endTime to current time
-		endTime = int(time.Now().Unix())
+	if q.OrderType != MirrorXOrderTypeAll && q.OrderType != MirrorXOrderTypeDeposit && q.OrderType != MirrorXOrderTypeWithdraw {
+		return fmt.Errorf("invalid orderType %d", q.OrderType)
 	}
-	params["endTime"] = strconv.Itoa(endTime)
-	if coinSymbol != "" {
-		params["coinSymbol"] = coinSymbol
+	return validateHistory(q.StartTime, q.EndTime, q.PageLimit, q.PageNo)
+}
+
+// MirrorXAssetPositionsQuery filters GetMirrorXAssetPositions
+type MirrorXAssetPositionsQuery struct {
+	MirrorXLinkId     MirrorXLinkID // required
+	ExcludeZeroAmount bool          // optional, default false
+	PageLimit         int           // optional, default 25, max 25
+	PageNo            int           // optional, default 1
+}
+
+func (q *MirrorXAssetPositionsQuery) Validate() error {
+	if err := q.MirrorXLinkId.validate(); err != nil {
+		return err
 	}
-	if orderType != 0 {
-		params["orderType"] = strconv.Itoa(int(orderType))
+	return validatePaging(q.PageLimit, q.PageNo)
+}
+
+// MirrorXAvailableAmountQuery selects the coin and direction for GetMirrorXAvailableAmount
+type MirrorXAvailableAmountQuery struct {
+	MirrorXLinkId MirrorXLinkID    // required
+	CoinSymbol    string           // required, example: "USDT"
+	OrderType     MirrorXOrderType // required, MirrorXOrderTypeDeposit or MirrorXOrderTypeWithdraw
+}
+
+func (q *MirrorXAvailableAmountQuery) Validate() error {
+	if err := q.MirrorXLinkId.validate(); err != nil {
+		return err
 	}
-	if pageLimit != 0 {
-		params["pageLimit"] = strconv.Itoa(pageLimit)
-	} else {
-		params["pageLimit"] = "10"
+	if q.CoinSymbol == "" {
+		return errors.New("coinSymbol is required")
 	}
-	if pageNo != 0 {
-		params["pageNo"] = strconv.Itoa(pageNo)
-	} else {
-		params["pageNo"] = "1"
+	if q.OrderType != MirrorXOrderTypeDeposit && q.OrderType != MirrorXOrderTypeWithdraw {
+		return fmt.Errorf("invalid orderType %d", q.OrderType)
 	}
-	resp, err := c.get(GetMirrorXDelegationOrdersApi, params)
-	if err != nil {
+	return nil
+}
+
+type CreateMirrorXOrderReq struct {
+	MirrorXLinkId MirrorXLinkID    // required
+	OrderType     MirrorXOrderType // required, MirrorXOrderTypeDeposit or MirrorXOrderTypeWithdraw
+	CoinSymbol    string           // required, example: "USDT"
+	Amount        string           // required, positive decimal string, example: "100"
+	RequestId     string           // optional, default random
+}
+
+func (r *CreateMirrorXOrderReq) Validate() error {
+	if err := r.MirrorXLinkId.validate(); err != nil {
+		return err
+	}
+	if r.OrderType != MirrorXOrderTypeDeposit && r.OrderType != MirrorXOrderTypeWithdraw {
+		return fmt.Errorf("invalid orderType %d", r.OrderType)
+	}
+	if r.CoinSymbol == "" {
+		return errors.New("coinSymbol is required")
+	}
+	amount, err := parseAmount(r.Amount)
+	if err != nil || amount.Sign() <= 0 {
+		return fmt.Errorf("invalid amount %q", r.Amount)
+	}
+	return nil
+}
+
+// MirrorXLinkListQuery pages QueryMirrorXLinkList
+type MirrorXLinkListQuery struct {
+	PageLimit int // optional, default 25, max 25
+	PageNo    int // optional, default 1
+}
+
+func (q *MirrorXLinkListQuery) Validate() error {
+	return validatePaging(q.PageLimit, q.PageNo)
+}
+
+// QueryMirrorXLinkList get the mirrorX links of the organization
+func (c *Client) QueryMirrorXLinkList(query *MirrorXLinkListQuery) (*GetMirrorXLinkListResp, error) {
+	if err := query.Validate(); err != nil {
 		return nil, err
 	}
-	var result GetMirrorXDelegationOrdersResp
-	err = json.Unmarshal(resp, &result)
+	resp, err := c.get(GetMirrorXLinkIdListApi, c.pageParams(query.PageLimit, query.PageNo))
 	if err != nil {
 		return nil, err
 	}
-	return &result, nil
+	return decodeEnvelope[Page[MirrorXLink]](resp)
 }
 
-// GetMirrorXAvailableAmount get mirrorX available amount
-// @param mirrorXLinkId: mirrorXLinkId, must have, binded binance uid
-// @param coinSymbol: coin symbol, must have, example: "USDT"
-// @param orderType: order type, must have, 10: buy, 20: sell
-func (c *Client) GetMirrorXAvailableAmount(mirrorXLinkId string, coinSymbol string, orderType MirrorXOrderType) (*GetMirrorXAvailableAmountResp, error) {
-	params := map[string]string{
-		"mirrorXLinkId": mirrorXLinkId,
-		"coinSymbol":    coinSymbol,
-		"orderType":     strconv.Itoa(int(orderType)),
+// GetMirrorXLinkList get the mirrorX links of the organization, see QueryMirrorXLinkList
+// pageLimit: optional, default 25, max 25
+// pageNo: optional, default 1
+func (c *Client) GetMirrorXLinkList(pageLimit, pageNo int) (*GetMirrorXLinkListResp, error) {
+	return c.QueryMirrorXLinkList(&MirrorXLinkListQuery{PageLimit: pageLimit, PageNo: pageNo})
+}
+
+// GetMirrorXDelegationOrders get mirrorX delegation orders
+func (c *Client) GetMirrorXDelegationOrders(query *MirrorXDelegationOrdersQuery) (*GetMirrorXDelegationOrdersResp, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
 	}
-	resp, err := c.get(GetMirrorXAvailableAmountApi, params)
+	params := c.historyParams(query.StartTime, query.EndTime, query.PageLimit, query.PageNo)
+	params["mirrorXLinkId"] = query.MirrorXLinkId.String()
+	if query.CoinSymbol != "" {
+		params["coinSymbol"] = query.CoinSymbol
+	}
+	if query.OrderType != MirrorXOrderTypeAll {
+		params["orderType"] = strconv.Itoa(int(query.OrderType))
+	}
+	resp, err := c.get(GetMirrorXDelegationOrdersApi, params)
 	if err != nil {
 		return nil, err
 	}
-	var result GetMirrorXAvailableAmountResp
-	err = json.Unmarshal(resp, &result)
+	return decodeEnvelope[Page[MirrorXOrder]](resp)
+}
+
+// GetMirrorXAvailableAmount get the max amount that can be ordered for a coin and direction
+func (c *Client) GetMirrorXAvailableAmount(query *MirrorXAvailableAmountQuery) (*GetMirrorXAvailableAmountResp, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	params := map[string]string{
+		"mirrorXLinkId": query.MirrorXLinkId.String(),
+		"coinSymbol":    query.CoinSymbol,
+		"orderType":     strconv.Itoa(int(query.OrderType)),
+	}
+	resp, err := c.get(GetMirrorXAvailableAmountApi, params)
 	if err != nil {
 		return nil, err
 	}
-	return &result, nil
+	return decodeEnvelope[MirrorXAvailableAmount](resp)
 }
 
 // GetMirrorXAssetPositions get mirrorX asset positions
-// @param mirrorXLinkId: mirrorXLinkId, must have, binded binance uid
-// @param excludeZeroAmountFlag: exclude zero amount flag, optional, default false
-// @param pageLimit: page limit, optional, default 10
-// @param pageNo: page no, optional, default 1
-func (c *Client) GetMirrorXAssetPositions(mirrorXLinkId string, excludeZeroAmountFlag bool, pageLimit int, pageNo int) (*GetMirrorXAssetPositionsResp, error) {
-	params := map[string]string{
-		"mirrorXLinkId": mirrorXLinkId,
+func (c *Client) GetMirrorXAssetPositions(query *MirrorXAssetPositionsQuery) (*GetMirrorXAssetPositionsResp, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
 	}
-	if excludeZeroAmountFlag {
+	params := c.pageParams(query.PageLimit, query.PageNo)
+	params["mirrorXLinkId"] = query.MirrorXLinkId.String()
+	if query.ExcludeZeroAmount {
 		params["excludeZeroAmountFlag"] = "true"
 	}
-	if pageLimit != 0 {
-		params["pageLimit"] = strconv.Itoa(pageLimit)
-	} else {
-		params["pageLimit"] = "10"
-	}
-	if pageNo != 0 {
-		params["pageNo"] = strconv.Itoa(pageNo)
-	} else {
-		params["pageNo"] = "1"
-	}
 	resp, err := c.get(GetMirrorXAssetPositionsApi, params)
 	if err != nil {
 		return nil, err
 	}
-	var result GetMirrorXAssetPositionsResp
-	err = json.Unmarshal(resp, &result)
-	if err != nil {
-		return nil, err
-	}
-	return &result, nil
+	return decodeEnvelope[Page[MirrorXPosition]](resp)
 }
 
 // CreateMirrorXOrder place mirrorX order
-// @param mirrorXLinkId: mirrorXLinkId, must have, binded binance uid
-// @param orderType: order type, must have, 10: buy, 20: sell
-// @param coinSymbol: coin symbol, must have, example: "USDT"
-// @param amount: amount, must have, example: "100"
-// @param timestamp: timestamp, must have, example: 1630000000
+// req.RequestId is filled with a random id if empty, keep it to retry the order safely
 func (c *Client) CreateMirrorXOrder(req *CreateMirrorXOrderReq) (*CreateMirrorXOrderResp, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
 	if req.RequestId == "" {
 		// Fill requestId with random int
-		randId := rand.Intn(math.MaxInt)
-		req.RequestId = strconv.Itoa(randId)
-	}
-	// Convert req to map[string]interface{}
-	reqMap := map[string]interface{}{}
-	reqJson, _ := json.Marshal(req)
-	_ = json.Unmarshal(reqJson, &reqMap)
-	resp, err := c.post(CreateMirrorXOrderApi, reqMap)
-	if err != nil {
-		return nil, err
+		req.RequestId = strconv.FormatInt(GetReqId(), 10)
+	}
+	params := map[string]interface{}{
+		"mirrorXLinkId": req.MirrorXLinkId,
+		"orderType":     int(req.OrderType),
+		"coinSymbol":    req.CoinSymbol,
+		"amount":        req.Amount,
+		"requestId":     req.RequestId,
 	}
-	var result CreateMirrorXOrderResp
-	err = json.Unmarshal(resp, &result)
+	resp, err := c.post(CreateMirrorXOrderApi, params)
 	if err != nil {
 		return nil, err
 	}
-	return &result, nil
+	return decodeEnvelope[MirrorXOrderResult](resp)
 }
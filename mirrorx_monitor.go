@@ -0,0 +1,392 @@
+package ceffu
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+type MirrorXEventType string
+
+const (
+	MirrorXEventOrderStatus MirrorXEventType = "orderStatus" // An order was seen for the first time or changed status
+	MirrorXEventPosition    MirrorXEventType = "position"    // A position balance changed
+	MirrorXEventLinkStatus  MirrorXEventType = "linkStatus"  // A link appeared, disappeared or changed status
+	MirrorXEventLowPosition MirrorXEventType = "lowPosition" // A position fell below its threshold
+	MirrorXEventPollFailed  MirrorXEventType = "pollFailed"  // Polling a link failed, see Err
+)
+
+// MirrorXEvent is emitted by MirrorXMonitor. Only the fields relevant to Type are set.
+type MirrorXEvent struct {
+	Type          MirrorXEventType
+	Time          time.Time
+	MirrorXLinkId MirrorXLinkID
+	CoinSymbol    string
+	OrderViewId   string
+	OrderType     MirrorXOrderType
+	Amount        string
+	OldStatus     int // order or link status, 0 if not seen before
+	NewStatus     int // order or link status, 0 if the link disappeared
+	OldBalance    string
+	NewBalance    string
+	Threshold     string
+	Err           error
+}
+
+// MirrorXMonitorConfig configures a MirrorXMonitor
+type MirrorXMonitorConfig struct {
+	// Interval is the delay between polls in Run, default 30 seconds
+	Interval time.Duration
+	// Thresholds maps coin symbols to the minimum balance of a position, optional.
+	// A MirrorXEventLowPosition is emitted once when a position falls below it.
+	Thresholds map[string]string
+	// LinkThresholds overrides Thresholds per link, keyed by mirrorXLinkId, optional
+	LinkThresholds map[MirrorXLinkID]map[string]string
+	// OrderLookback is how far back delegation orders are polled, default 24 hours
+	OrderLookback time.Duration
+}
+
+// mirrorXOrderState is the last seen status of an order and the link it belongs to
+type mirrorXOrderState struct {
+	linkId MirrorXLinkID
+	status MirrorXOrderStatus
+}
+
+type mirrorXPositionKey struct {
+	linkId MirrorXLinkID
+	coin   string
+}
+
+// MirrorXMonitor polls all MirrorX links, their delegation orders and positions and emits
+// an event for every change. The first poll only records the current state, apart from
+// low position alerts.
+type MirrorXMonitor struct {
+	client  *Client
+	config  MirrorXMonitorConfig
+	handler func(MirrorXEvent)
+
+	// pollMu serializes Poll, mu guards the state below
+	pollMu    sync.Mutex
+	mu        sync.Mutex
+	polled    bool
+	links     map[MirrorXLinkID]int
+	orders    map[string]mirrorXOrderState
+	positions map[mirrorXPositionKey]string
+	alerted   map[mirrorXPositionKey]bool
+	// queued holds events of the running poll, emitted once the lock is released
+	queued []MirrorXEvent
+}
+
+// NewMirrorXMonitor creates a monitor calling handler for every event, handler is called from the polling goroutine
+func NewMirrorXMonitor(client *Client, config MirrorXMonitorConfig, handler func(MirrorXEvent)) (*MirrorXMonitor, error) {
+	for _, threshold := range config.Thresholds {
+		if _, err := parseAmount(threshold); err != nil {
+			return nil, err
+		}
+	}
+	for _, thresholds := range config.LinkThresholds {
+		for _, threshold := range thresholds {
+			if _, err := parseAmount(threshold); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+	if config.OrderLookback <= 0 {
+		config.OrderLookback = 24 * time.Hour
+	}
+	return &MirrorXMonitor{
+		client:    client,
+		config:    config,
+		handler:   handler,
+		links:     map[MirrorXLinkID]int{},
+		orders:    map[string]mirrorXOrderState{},
+		positions: map[mirrorXPositionKey]string{},
+		alerted:   map[mirrorXPositionKey]bool{},
+	}, nil
+}
+
+// Run polls until ctx is done
+func (m *MirrorXMonitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+	for {
+		err := m.Poll()
+		if err != nil {
+			m.emit(MirrorXEvent{Type: MirrorXEventPollFailed, Err: err})
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// OrderStatus returns the last seen status of an order.
+// Orders are forgotten once they are older than OrderLookback.
+func (m *MirrorXMonitor) OrderStatus(orderViewId string) (MirrorXOrderStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order, ok := m.orders[orderViewId]
+	return order.status, ok
+}
+
+func (m *MirrorXMonitor) emit(event MirrorXEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if m.handler != nil {
+		m.handler(event)
+	}
+}
+
+// queue records an event while m.mu is held
+func (m *MirrorXMonitor) queue(event MirrorXEvent) {
+	event.Time = time.Now()
+	m.queued = append(m.queued, event)
+}
+
+func (m *MirrorXMonitor) threshold(linkId MirrorXLinkID, coin string) (*big.Rat, bool) {
+	threshold, ok := m.config.LinkThresholds[linkId][coin]
+	if !ok {
+		threshold, ok = m.config.Thresholds[coin]
+	}
+	if !ok {
+		return nil, false
+	}
+	r, _ := parseAmount(threshold)
+	return r, true
+}
+
+// mirrorXLinkPoll is the state of one link fetched by Poll before it is merged
+type mirrorXLinkPoll struct {
+	link      MirrorXLink
+	orders    []MirrorXOrder
+	positions []MirrorXPosition
+	err       error
+}
+
+// Poll runs a single polling cycle. Failures of single links are emitted as MirrorXEventPollFailed,
+// only a failure to list links is returned.
+// The state is only locked to merge the fetched data, so OrderStatus does not wait for the API calls.
+func (m *MirrorXMonitor) Poll() error {
+	m.pollMu.Lock()
+	defer m.pollMu.Unlock()
+	links, err := m.client.listAllMirrorXLinks()
+	if err != nil {
+		return err
+	}
+	polls := make([]mirrorXLinkPoll, len(links))
+	for i, link := range links {
+		polls[i].link = link
+		polls[i].orders, polls[i].err = m.fetchOrders(link.MirrorXLinkId)
+		if polls[i].err == nil {
+			polls[i].positions, polls[i].err = m.client.listAllMirrorXPositions(link.MirrorXLinkId, false)
+		}
+	}
+
+	m.mu.Lock()
+	defer func() {
+		queued := m.queued
+		m.queued = nil
+		m.mu.Unlock()
+		for _, event := range queued {
+			m.emit(event)
+		}
+	}()
+	first := !m.polled
+	m.polled = true
+
+	seen := map[MirrorXLinkID]bool{}
+	for _, poll := range polls {
+		link := poll.link
+		seen[link.MirrorXLinkId] = true
+		old, known := m.links[link.MirrorXLinkId]
+		m.links[link.MirrorXLinkId] = link.Status
+		if !first && (!known || old != link.Status) {
+			m.queue(MirrorXEvent{Type: MirrorXEventLinkStatus, MirrorXLinkId: link.MirrorXLinkId, OldStatus: old, NewStatus: link.Status})
+		}
+		err = poll.err
+		if err == nil {
+			m.mergeOrders(link.MirrorXLinkId, poll.orders, first)
+			err = m.mergePositions(link.MirrorXLinkId, poll.positions, first)
+		}
+		if err != nil {
+			m.queue(MirrorXEvent{Type: MirrorXEventPollFailed, MirrorXLinkId: link.MirrorXLinkId, Err: err})
+		}
+	}
+	for linkId, old := range m.links {
+		if !seen[linkId] {
+			delete(m.links, linkId)
+			m.forgetLink(linkId)
+			m.queue(MirrorXEvent{Type: MirrorXEventLinkStatus, MirrorXLinkId: linkId, OldStatus: old})
+		}
+	}
+	return nil
+}
+
+// forgetLink drops the orders and positions of a removed link while m.mu is held
+func (m *MirrorXMonitor) forgetLink(linkId MirrorXLinkID) {
+	for orderViewId, order := range m.orders {
+		if order.linkId == linkId {
+			delete(m.orders, orderViewId)
+		}
+	}
+	for key := range m.positions {
+		if key.linkId == linkId {
+			delete(m.positions, key)
+		}
+	}
+	for key := range m.alerted {
+		if key.linkId == linkId {
+			delete(m.alerted, key)
+		}
+	}
+}
+
+func (m *MirrorXMonitor) fetchOrders(linkId MirrorXLinkID) ([]MirrorXOrder, error) {
+	start := time.Now().Add(-m.config.OrderLookback)
+	var orders []MirrorXOrder
+	err := forEachPage(func(pageNo int) (int, error) {
+		resp, err := m.client.GetMirrorXDelegationOrders(&MirrorXDelegationOrdersQuery{
+			MirrorXLinkId: linkId,
+			StartTime:     start,
+			PageNo:        pageNo,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		orders = append(orders, resp.Data.Data...)
+		return resp.Data.TotalPage, nil
+	})
+	return orders, err
+}
+
+// mergeOrders records fetched orders while m.mu is held.
+// Orders of the link no longer listed have left the lookback and are dropped.
+func (m *MirrorXMonitor) mergeOrders(linkId MirrorXLinkID, orders []MirrorXOrder, first bool) {
+	listed := map[string]bool{}
+	for _, order := range orders {
+		listed[order.OrderViewId] = true
+		previous, known := m.orders[order.OrderViewId]
+		old := previous.status
+		m.orders[order.OrderViewId] = mirrorXOrderState{linkId: linkId, status: order.Status}
+		if first || (known && old == order.Status) {
+			continue
+		}
+		m.queue(MirrorXEvent{
+			Type:          MirrorXEventOrderStatus,
+			MirrorXLinkId: linkId,
+			CoinSymbol:    order.CoinSymbol,
+			OrderViewId:   order.OrderViewId,
+			OrderType:     order.OrderType,
+			Amount:        order.Amount,
+			OldStatus:     int(old),
+			NewStatus:     int(order.Status),
+		})
+	}
+	for orderViewId, order := range m.orders {
+		if order.linkId == linkId && !listed[orderViewId] {
+			delete(m.orders, orderViewId)
+		}
+	}
+}
+
+// mergePositions records fetched positions while m.mu is held.
+// Coins with a threshold but without position are checked with a zero balance,
+// other positions that disappeared are reported with a zero balance and dropped.
+func (m *MirrorXMonitor) mergePositions(linkId MirrorXLinkID, positions []MirrorXPosition, first bool) error {
+	listed := map[string]bool{}
+	for _, position := range positions {
+		listed[position.CoinSymbol] = true
+	}
+	thresholdCoins := map[string]bool{}
+	for _, coin := range m.thresholdCoins(linkId) {
+		thresholdCoins[coin] = true
+		if listed[coin] {
+			continue
+		}
+		positions = append(positions, MirrorXPosition{MirrorXLinkId: linkId, CoinSymbol: coin, MirrorXBalance: "0"})
+	}
+	var gone []string
+	for key := range m.positions {
+		if key.linkId == linkId && !listed[key.coin] && !thresholdCoins[key.coin] {
+			gone = append(gone, key.coin)
+		}
+	}
+	sort.Strings(gone)
+	for _, coin := range gone {
+		key := mirrorXPositionKey{linkId: linkId, coin: coin}
+		old := m.positions[key]
+		delete(m.positions, key)
+		if !sameAmount(old, "0") {
+			m.queue(MirrorXEvent{
+				Type:          MirrorXEventPosition,
+				MirrorXLinkId: linkId,
+				CoinSymbol:    coin,
+				OldBalance:    old,
+				NewBalance:    "0",
+			})
+		}
+	}
+	for _, position := range positions {
+		key := mirrorXPositionKey{linkId: linkId, coin: position.CoinSymbol}
+		old, known := m.positions[key]
+		if known || listed[position.CoinSymbol] {
+			m.positions[key] = position.MirrorXBalance
+			if !first && (!known || !sameAmount(old, position.MirrorXBalance)) {
+				m.queue(MirrorXEvent{
+					Type:          MirrorXEventPosition,
+					MirrorXLinkId: linkId,
+					CoinSymbol:    position.CoinSymbol,
+					OldBalance:    old,
+					NewBalance:    position.MirrorXBalance,
+				})
+			}
+		}
+		threshold, ok := m.threshold(linkId, position.CoinSymbol)
+		if !ok {
+			continue
+		}
+		balance, err := parseAmount(position.MirrorXBalance)
+		if err != nil {
+			return err
+		}
+		below := balance.Cmp(threshold) < 0
+		if below && !m.alerted[key] {
+			m.queue(MirrorXEvent{
+				Type:          MirrorXEventLowPosition,
+				MirrorXLinkId: linkId,
+				CoinSymbol:    position.CoinSymbol,
+				NewBalance:    position.MirrorXBalance,
+				Threshold:     formatAmount(threshold),
+			})
+		}
+		// Alert again once the position recovered and fell below again
+		m.alerted[key] = below
+	}
+	return nil
+}
+
+// thresholdCoins returns the coins with a threshold for linkId, sorted
+func (m *MirrorXMonitor) thresholdCoins(linkId MirrorXLinkID) []string {
+	var coins []string
+	for coin := range m.config.Thresholds {
+		coins = append(coins, coin)
+	}
+	for coin := range m.config.LinkThresholds[linkId] {
+		if _, ok := m.config.Thresholds[coin]; !ok {
+			coins = append(coins, coin)
+		}
+	}
+	sort.Strings(coins)
+	return coins
+}
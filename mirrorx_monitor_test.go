@@ -0,0 +1,136 @@
+package ceffu
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMirrorXMonitor(t *testing.T) {
+	linkStatus, orderStatus, balance := "1", "10", "100"
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/mirrorX/mirrorXLinkId/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"mirrorXLinkId":"11","status":` + linkStatus + `}],"totalPage":1}}`))
+		case "/open-api/v1/mirrorX/order/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"orderViewId":"ov1","coinSymbol":"USDT","status":` + orderStatus + `}],"totalPage":1}}`))
+		case "/open-api/v1/mirrorX/positions/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"coinSymbol":"USDT","mirrorXBalance":"` + balance + `"}],"totalPage":1}}`))
+		}
+	})
+	var events []MirrorXEvent
+	monitor, err := NewMirrorXMonitor(cl, MirrorXMonitorConfig{Thresholds: map[string]string{"USDT": "50"}}, func(event MirrorXEvent) {
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = monitor.Poll(); err != nil || len(events) != 0 {
+		t.Fatalf("first poll should only record state: %v %+v", err, events)
+	}
+	linkStatus, orderStatus, balance = "2", "30", "40"
+	if err = monitor.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	want := []MirrorXEventType{MirrorXEventLinkStatus, MirrorXEventOrderStatus, MirrorXEventPosition, MirrorXEventLowPosition}
+	if len(events) != len(want) {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	for i, event := range events {
+		if event.Type != want[i] {
+			t.Fatalf("event %d: expected %s, got %+v", i, want[i], event)
+		}
+	}
+	if status, _ := monitor.OrderStatus("ov1"); status != MirrorXOrderStatusSuccess {
+		t.Fatalf("unexpected order status %d", status)
+	}
+	// Still below threshold, no repeated alert
+	events = nil
+	if err = monitor.Poll(); err != nil || len(events) != 0 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestMirrorXMonitorMissingPositionAndLocking(t *testing.T) {
+	var monitor *MirrorXMonitor
+	blocked := false
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/mirrorX/mirrorXLinkId/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"mirrorXLinkId":"11","status":1}],"totalPage":1}}`))
+		case "/open-api/v1/mirrorX/order/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[],"totalPage":1}}`))
+		case "/open-api/v1/mirrorX/positions/list":
+			// The state must not be locked while the monitor waits for Ceffu
+			done := make(chan struct{})
+			go func() {
+				monitor.OrderStatus("ov1")
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				blocked = true
+			}
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"coinSymbol":"USDT","mirrorXBalance":"100"}],"totalPage":1}}`))
+		}
+	})
+	var events []MirrorXEvent
+	monitor, _ = NewMirrorXMonitor(cl, MirrorXMonitorConfig{Thresholds: map[string]string{"USDT": "50", "BTC": "1"}}, func(event MirrorXEvent) {
+		events = append(events, event)
+	})
+	if err := monitor.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if blocked {
+		t.Fatal("OrderStatus blocked during poll")
+	}
+	if len(events) != 1 || events[0].Type != MirrorXEventLowPosition || events[0].CoinSymbol != "BTC" || events[0].NewBalance != "0" {
+		t.Fatalf("expected low BTC position, got %+v", events)
+	}
+}
+
+func TestMirrorXMonitorPrunesState(t *testing.T) {
+	orders := `[{"orderViewId":"ov1","coinSymbol":"USDT","status":30}]`
+	positions := `[{"coinSymbol":"USDT","mirrorXBalance":"100"},{"coinSymbol":"ETH","mirrorXBalance":"2"}]`
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/mirrorX/mirrorXLinkId/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"mirrorXLinkId":"11","status":1}],"totalPage":1}}`))
+		case "/open-api/v1/mirrorX/order/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":` + orders + `,"totalPage":1}}`))
+		case "/open-api/v1/mirrorX/positions/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":` + positions + `,"totalPage":1}}`))
+		}
+	})
+	var events []MirrorXEvent
+	monitor, _ := NewMirrorXMonitor(cl, MirrorXMonitorConfig{Thresholds: map[string]string{"USDT": "50"}}, func(event MirrorXEvent) {
+		events = append(events, event)
+	})
+	if err := monitor.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := monitor.OrderStatus("ov1"); !ok {
+		t.Fatal("order not recorded")
+	}
+
+	// The order left the lookback, the ETH position without threshold was closed
+	orders = `[]`
+	positions = `[{"coinSymbol":"USDT","mirrorXBalance":"100"}]`
+	if err := monitor.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := monitor.OrderStatus("ov1"); ok {
+		t.Fatal("order outside the lookback kept")
+	}
+	if len(events) != 1 || events[0].Type != MirrorXEventPosition || events[0].CoinSymbol != "ETH" || events[0].OldBalance != "2" || events[0].NewBalance != "0" {
+		t.Fatalf("expected closed ETH position, got %+v", events)
+	}
+	if len(monitor.positions) != 1 || len(monitor.orders) != 0 {
+		t.Fatalf("state not pruned: %v %v", monitor.positions, monitor.orders)
+	}
+	events = nil
+	if err := monitor.Poll(); err != nil || len(events) != 0 {
+		t.Fatalf("closed position reported again: %v %+v", err, events)
+	}
+}
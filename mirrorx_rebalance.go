@@ -0,0 +1,339 @@
+package ceffu
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// MirrorXTarget is the desired MirrorX balance of a coin on a link.
+// No order is placed while the balance stays within [Lower, Upper], otherwise the
+// balance is moved back to Target.
+type MirrorXTarget struct {
+	MirrorXLinkId MirrorXLinkID
+	CoinSymbol    string
+	Target        string // decimal string
+	Lower         string // optional, default Target
+	Upper         string // optional, default Target
+}
+
+// MirrorXRebalanceConfig configures a MirrorXRebalancer
+type MirrorXRebalanceConfig struct {
+	// Targets are the balances to keep, required
+	Targets []MirrorXTarget
+	// Decimals is the number of decimals order amounts are truncated to, default 8
+	Decimals int
+	// DryRun only plans the orders without placing them
+	DryRun bool
+	// Idempotency is optional, if set together with RunID every order gets a stable requestId,
+	// so repeating a run after a crash does not place orders twice
+	Idempotency *IdempotencyManager
+	// RunID identifies a rebalance run. Required with Idempotency.
+	RunID string
+	// PollInterval is the delay between order status checks, default 5 seconds
+	PollInterval time.Duration
+	// Timeout is how long Run waits for orders to complete, default 5 minutes
+	Timeout time.Duration
+	// Lookback is how long before a run the delegation orders are searched for orders
+	// placed by an earlier run with the same RunID, default 1 hour
+	Lookback time.Duration
+}
+
+// MirrorXRebalanceOrder is a single planned or placed rebalance order
+type MirrorXRebalanceOrder struct {
+	Target      MirrorXTarget
+	Balance     string // balance before rebalancing
+	OrderType   MirrorXOrderType
+	Amount      string // amount ordered, capped by Available
+	Available   string // max available amount reported by Ceffu
+	Capped      bool   // the full difference could not be ordered
+	RequestId   string
+	OrderViewId string
+	Status      MirrorXOrderStatus
+	Err         error
+}
+
+// Done reports whether the order reached a final status
+func (o *MirrorXRebalanceOrder) Done() bool {
+	return o.Err != nil || o.Status == MirrorXOrderStatusSuccess || o.Status == MirrorXOrderStatusFailed
+}
+
+type MirrorXRebalanceReport struct {
+	DryRun bool
+	Orders []MirrorXRebalanceOrder
+	Failed int
+}
+
+// MirrorXRebalancer keeps MirrorX collateral within target bands by placing deposit and withdraw orders
+type MirrorXRebalancer struct {
+	client *Client
+	config MirrorXRebalanceConfig
+}
+
+func NewMirrorXRebalancer(client *Client, config MirrorXRebalanceConfig) (*MirrorXRebalancer, error) {
+	if len(config.Targets) == 0 {
+		return nil, errors.New("at least one target is required")
+	}
+	for i := range config.Targets {
+		target := &config.Targets[i]
+		if err := target.MirrorXLinkId.validate(); err != nil {
+			return nil, err
+		}
+		if target.CoinSymbol == "" {
+			return nil, errors.New("coinSymbol is required for every target")
+		}
+		if target.Lower == "" {
+			target.Lower = target.Target
+		}
+		if target.Upper == "" {
+			target.Upper = target.Target
+		}
+		value, err := parseAmount(target.Target)
+		if err != nil {
+			return nil, err
+		}
+		lower, err := parseAmount(target.Lower)
+		if err != nil {
+			return nil, err
+		}
+		upper, err := parseAmount(target.Upper)
+		if err != nil {
+			return nil, err
+		}
+		if lower.Cmp(value) > 0 || upper.Cmp(value) < 0 {
+			return nil, fmt.Errorf("target %s %s must lie within its band", target.MirrorXLinkId, target.CoinSymbol)
+		}
+	}
+	if config.Idempotency != nil && config.RunID == "" {
+		return nil, errors.New("run id is required when idempotency is enabled")
+	}
+	if config.Decimals <= 0 {
+		config.Decimals = 8
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 5 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Minute
+	}
+	if config.Lookback <= 0 {
+		config.Lookback = time.Hour
+	}
+	return &MirrorXRebalancer{
+		client: client,
+		config: config,
+	}, nil
+}
+
+// Plan reads the current positions and returns the orders needed to reach the targets
+func (r *MirrorXRebalancer) Plan() ([]MirrorXRebalanceOrder, error) {
+	positions := map[MirrorXLinkID][]MirrorXPosition{}
+	var orders []MirrorXRebalanceOrder
+	for _, target := range r.config.Targets {
+		linkPositions, ok := positions[target.MirrorXLinkId]
+		if !ok {
+			var err error
+			linkPositions, err = r.client.listAllMirrorXPositions(target.MirrorXLinkId, false)
+			if err != nil {
+				return nil, err
+			}
+			positions[target.MirrorXLinkId] = linkPositions
+		}
+		balance := new(big.Rat)
+		for _, position := range linkPositions {
+			if position.CoinSymbol == target.CoinSymbol {
+				amount, err := parseAmount(position.MirrorXBalance)
+				if err != nil {
+					return nil, err
+				}
+				balance.Add(balance, amount)
+			}
+		}
+		value, _ := parseAmount(target.Target)
+		lower, _ := parseAmount(target.Lower)
+		upper, _ := parseAmount(target.Upper)
+		if balance.Cmp(lower) >= 0 && balance.Cmp(upper) <= 0 {
+			continue
+		}
+		order := MirrorXRebalanceOrder{
+			Target:    target,
+			Balance:   formatAmount(balance),
+			OrderType: MirrorXOrderTypeDeposit,
+		}
+		diff := new(big.Rat).Sub(value, balance)
+		if diff.Sign() < 0 {
+			order.OrderType = MirrorXOrderTypeWithdraw
+			diff.Neg(diff)
+		}
+		resp, err := r.client.GetMirrorXAvailableAmount(&MirrorXAvailableAmountQuery{
+			MirrorXLinkId: target.MirrorXLinkId,
+			CoinSymbol:    target.CoinSymbol,
+			OrderType:     order.OrderType,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return nil, err
+		}
+		available, err := parseAmount(resp.Data.MaxAvailableAmount)
+		if err != nil {
+			return nil, err
+		}
+		order.Available = formatAmount(available)
+		if diff.Cmp(available) > 0 {
+			diff = available
+			order.Capped = true
+		}
+		diff = truncateAmount(diff, r.config.Decimals)
+		if diff.Sign() <= 0 {
+			continue
+		}
+		order.Amount = formatAmount(diff)
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// Run plans and places the rebalance orders, then waits until all of them completed or Timeout passed.
+// Failed orders are reported in the result instead of aborting the run.
+func (r *MirrorXRebalancer) Run() (*MirrorXRebalanceReport, error) {
+	orders, err := r.Plan()
+	if err != nil {
+		return nil, err
+	}
+	report := &MirrorXRebalanceReport{
+		DryRun: r.config.DryRun,
+		Orders: orders,
+	}
+	if r.config.DryRun {
+		return report, nil
+	}
+	placedAt := time.Now()
+	for i := range orders {
+		r.place(&orders[i])
+	}
+	r.wait(orders, placedAt)
+	for i := range orders {
+		if orders[i].Err != nil || orders[i].Status != MirrorXOrderStatusSuccess {
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+func (r *MirrorXRebalancer) place(order *MirrorXRebalanceOrder) {
+	if r.config.Idempotency != nil {
+		key := fmt.Sprintf("mirrorx/%s/%s/%s", r.config.RunID, order.Target.MirrorXLinkId, order.Target.CoinSymbol)
+		requestId, err := r.config.Idempotency.RequestId(key)
+		if err != nil {
+			order.Err = err
+			return
+		}
+		order.RequestId = strconv.FormatInt(requestId, 10)
+	} else {
+		order.RequestId = strconv.FormatInt(GetReqId(), 10)
+	}
+	resp, err := r.client.CreateMirrorXOrder(&CreateMirrorXOrderReq{
+		MirrorXLinkId: order.Target.MirrorXLinkId,
+		OrderType:     order.OrderType,
+		CoinSymbol:    order.Target.CoinSymbol,
+		Amount:        order.Amount,
+		RequestId:     order.RequestId,
+	})
+	if err != nil {
+		order.Err = err
+		return
+	}
+	if resp.Code == ErrorDuplicateReqID {
+		// Placed by an earlier run, its order view id is looked up while waiting
+		return
+	}
+	if err = checkCode(resp.Code, resp.Message); err != nil {
+		order.Err = err
+		return
+	}
+	order.OrderViewId = resp.Data.OrderViewId
+	order.Status = resp.Data.Status
+}
+
+// wait polls the delegation orders of every link until all orders are done or the timeout passed.
+// Orders whose create response was lost may not be listed yet, they are searched until the timeout.
+func (r *MirrorXRebalancer) wait(orders []MirrorXRebalanceOrder, placedAt time.Time) {
+	deadline := time.Now().Add(r.config.Timeout)
+	for {
+		pending := map[MirrorXLinkID]bool{}
+		for i := range orders {
+			if !orders[i].Done() {
+				pending[orders[i].Target.MirrorXLinkId] = true
+			}
+		}
+		if len(pending) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			for i := range orders {
+				order := &orders[i]
+				switch {
+				case order.Done():
+				case order.OrderViewId == "":
+					order.Err = fmt.Errorf("mirrorX order with requestId %s was placed earlier but not found in the delegation orders", order.RequestId)
+				default:
+					order.Err = errors.New("timed out waiting for mirrorX order to complete")
+				}
+			}
+			return
+		}
+		time.Sleep(r.config.PollInterval)
+		for linkId := range pending {
+			// Orders of an earlier run may be older than this run
+			start := placedAt.Add(-r.config.Lookback)
+			err := forEachPage(func(pageNo int) (int, error) {
+				resp, err := r.client.GetMirrorXDelegationOrders(&MirrorXDelegationOrdersQuery{
+					MirrorXLinkId: linkId,
+					StartTime:     start,
+					PageNo:        pageNo,
+				})
+				if err != nil {
+					return 0, err
+				}
+				if err = checkCode(resp.Code, resp.Message); err != nil {
+					return 0, err
+				}
+				for _, placed := range resp.Data.Data {
+					for i := range orders {
+						order := &orders[i]
+						if order.Target.MirrorXLinkId != linkId || order.Done() {
+							continue
+						}
+						// Orders whose create response was lost are matched by requestId only
+						matches := (order.OrderViewId != "" && placed.OrderViewId == order.OrderViewId) ||
+							(order.OrderViewId == "" && placed.RequestId == order.RequestId)
+						if matches {
+							order.OrderViewId = placed.OrderViewId
+							order.Status = placed.Status
+						}
+					}
+				}
+				return resp.Data.TotalPage, nil
+			})
+			if err != nil {
+				r.client.Logf("ceffu: failed to poll mirrorX orders of link %s: %s", linkId, err)
+			}
+		}
+	}
+}
+
+func sameAmount(a string, b string) bool {
+	x, err := parseAmount(a)
+	if err != nil {
+		return false
+	}
+	y, err := parseAmount(b)
+	if err != nil {
+		return false
+	}
+	return x.Cmp(y) == 0
+}
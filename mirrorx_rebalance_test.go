@@ -0,0 +1,149 @@
+package ceffu
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMirrorXRebalancer(t *testing.T) {
+	var placed []map[string]interface{}
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/mirrorX/positions/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"coinSymbol":"USDT","mirrorXBalance":"100"},{"coinSymbol":"BTC","mirrorXBalance":"2"}],"totalPage":1}}`))
+		case "/open-api/v1/mirrorX/order/check":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"maxAvailableAmount":"300"}}`))
+		case "/open-api/v1/mirrorX/order":
+			body := map[string]interface{}{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			placed = append(placed, body)
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"orderViewId":"ov1","status":10}}`))
+		case "/open-api/v1/mirrorX/order/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"orderViewId":"ov1","status":30}],"totalPage":1}}`))
+		}
+	})
+	rebalancer, err := NewMirrorXRebalancer(cl, MirrorXRebalanceConfig{
+		Targets: []MirrorXTarget{
+			{MirrorXLinkId: "11", CoinSymbol: "USDT", Target: "500", Lower: "400", Upper: "600"},
+			{MirrorXLinkId: "11", CoinSymbol: "BTC", Target: "2", Lower: "1", Upper: "3"},
+		},
+		PollInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := rebalancer.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Orders) != 1 || report.Failed != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	order := report.Orders[0]
+	if order.OrderType != MirrorXOrderTypeDeposit || order.Amount != "300" || !order.Capped || order.Status != MirrorXOrderStatusSuccess {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	if len(placed) != 1 || placed[0]["amount"] != "300" || placed[0]["mirrorXLinkId"].(float64) != 11 {
+		t.Fatalf("unexpected placed orders %+v", placed)
+	}
+}
+
+func TestMirrorXRebalancerDuplicateMatchedByRequestId(t *testing.T) {
+	idempotency := NewIdempotencyManager(nil, NewMemoryIdempotencyStore())
+	requestId, _ := idempotency.RequestId("mirrorx/run-1/11/USDT")
+	listed := `{"orderViewId":"manual","coinSymbol":"USDT","orderType":10,"amount":"300","status":30}`
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/mirrorX/positions/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"coinSymbol":"USDT","mirrorXBalance":"200"}],"totalPage":1}}`))
+		case "/open-api/v1/mirrorX/order/check":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"maxAvailableAmount":"1000"}}`))
+		case "/open-api/v1/mirrorX/order":
+			_, _ = w.Write([]byte(`{"code":"G20015","message":"duplicate request id"}`))
+		case "/open-api/v1/mirrorX/order/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[` + listed + `],"totalPage":1}}`))
+		}
+	})
+	idempotency.client = cl
+	config := MirrorXRebalanceConfig{
+		Targets:      []MirrorXTarget{{MirrorXLinkId: "11", CoinSymbol: "USDT", Target: "500", Lower: "400", Upper: "600"}},
+		PollInterval: time.Millisecond,
+		Timeout:      time.Second,
+		Idempotency:  idempotency,
+		RunID:        "run-1",
+	}
+	rebalancer, err := NewMirrorXRebalancer(cl, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A manual order with the same coin, type and amount is not taken for the lost one
+	report, err := rebalancer.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order := report.Orders[0]; report.Failed != 1 || order.Err == nil || order.OrderViewId != "" {
+		t.Fatalf("expected unresolved order, got %+v", order)
+	}
+
+	listed += `,{"orderViewId":"original","coinSymbol":"USDT","orderType":10,"amount":"300","status":30,"requestId":"` + strconv.FormatInt(requestId, 10) + `"}`
+	report, err = rebalancer.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order := report.Orders[0]; report.Failed != 0 || order.OrderViewId != "original" || order.Status != MirrorXOrderStatusSuccess {
+		t.Fatalf("unexpected order %+v", order)
+	}
+}
+
+func TestMirrorXRebalancerDuplicateNotYetListed(t *testing.T) {
+	idempotency := NewIdempotencyManager(nil, NewMemoryIdempotencyStore())
+	requestId, _ := idempotency.RequestId("mirrorx/run-1/11/USDT")
+	polls := 0
+	var startTime string
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/mirrorX/positions/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"coinSymbol":"USDT","mirrorXBalance":"200"}],"totalPage":1}}`))
+		case "/open-api/v1/mirrorX/order/check":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"maxAvailableAmount":"1000"}}`))
+		case "/open-api/v1/mirrorX/order":
+			_, _ = w.Write([]byte(`{"code":"G20015","message":"duplicate request id"}`))
+		case "/open-api/v1/mirrorX/order/list":
+			polls++
+			startTime = r.URL.Query().Get("startTime")
+			if polls < 3 {
+				// Not listed yet
+				_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[],"totalPage":1}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"orderViewId":"original","status":30,"requestId":"` + strconv.FormatInt(requestId, 10) + `"}],"totalPage":1}}`))
+		}
+	})
+	idempotency.client = cl
+	rebalancer, err := NewMirrorXRebalancer(cl, MirrorXRebalanceConfig{
+		Targets:      []MirrorXTarget{{MirrorXLinkId: "11", CoinSymbol: "USDT", Target: "500"}},
+		PollInterval: time.Millisecond,
+		Timeout:      time.Second,
+		Lookback:     48 * time.Hour,
+		Idempotency:  idempotency,
+		RunID:        "run-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	report, err := rebalancer.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order := report.Orders[0]; report.Failed != 0 || order.OrderViewId != "original" || polls != 3 {
+		t.Fatalf("unexpected order %+v after %d polls", order, polls)
+	}
+	start, _ := strconv.ParseInt(startTime, 10, 64)
+	if lookback := started.Sub(time.UnixMilli(start)); lookback < 47*time.Hour {
+		t.Fatalf("lookback not applied: %s", lookback)
+	}
+}
@@ -0,0 +1,91 @@
+package ceffu
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMirrorXLinkIDJSON(t *testing.T) {
+	var link MirrorXLink
+	err := json.Unmarshal([]byte(`{"mirrorXLinkId":11282}`), &link)
+	if err != nil || link.MirrorXLinkId != "11282" {
+		t.Fatalf("number not decoded: %v %q", err, link.MirrorXLinkId)
+	}
+	err = json.Unmarshal([]byte(`{"mirrorXLinkId":"11283"}`), &link)
+	if err != nil || link.MirrorXLinkId != "11283" {
+		t.Fatalf("string not decoded: %v %q", err, link.MirrorXLinkId)
+	}
+	encoded, err := json.Marshal(MirrorXLinkID("11282"))
+	if err != nil || string(encoded) != "11282" {
+		t.Fatalf("numeric id not encoded as number: %v %s", err, encoded)
+	}
+	for _, id := range []MirrorXLinkID{"+5", "007", "-1", "1e3"} {
+		if id.validate() == nil {
+			t.Errorf("invalid id %q accepted", id)
+		}
+		if encoded, err = json.Marshal(id); err != nil || !json.Valid(encoded) {
+			t.Errorf("id %q encoded as invalid json %s", id, encoded)
+		}
+	}
+}
+
+func TestGetMirrorXDelegationOrdersMillis(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	var query map[string]string
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		query = map[string]string{}
+		for key := range r.URL.Query() {
+			query[key] = r.URL.Query().Get(key)
+		}
+		_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"mirrorXLinkId":"11","orderType":10,"status":30}],"totalPage":1}}`))
+	})
+	resp, err := cl.GetMirrorXDelegationOrders(&MirrorXDelegationOrdersQuery{
+		MirrorXLinkId: "11",
+		OrderType:     MirrorXOrderTypeDeposit,
+		StartTime:     start,
+		EndTime:       end,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query["startTime"] != strconv.FormatInt(start.UnixMilli(), 10) || query["endTime"] != strconv.FormatInt(end.UnixMilli(), 10) {
+		t.Fatalf("times not sent in milliseconds: %v", query)
+	}
+	if query["orderType"] != "10" || query["pageLimit"] != "25" || query["pageNo"] != "1" {
+		t.Fatalf("unexpected query %v", query)
+	}
+	order := resp.Data.Data[0]
+	if order.OrderType != MirrorXOrderTypeDeposit || order.Status != MirrorXOrderStatusSuccess {
+		t.Fatalf("unexpected order %+v", order)
+	}
+}
+
+func TestMirrorXValidation(t *testing.T) {
+	calls := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+	start := time.Now()
+	if _, err := cl.GetMirrorXDelegationOrders(&MirrorXDelegationOrdersQuery{MirrorXLinkId: "11"}); err == nil {
+		t.Error("missing start time accepted")
+	}
+	if _, err := cl.GetMirrorXDelegationOrders(&MirrorXDelegationOrdersQuery{MirrorXLinkId: "11", StartTime: start, EndTime: start.Add(-time.Second)}); err == nil {
+		t.Error("end before start accepted")
+	}
+	if _, err := cl.GetMirrorXAssetPositions(&MirrorXAssetPositionsQuery{MirrorXLinkId: "abc"}); err == nil {
+		t.Error("non numeric link id accepted")
+	}
+	if _, err := cl.GetMirrorXAvailableAmount(&MirrorXAvailableAmountQuery{MirrorXLinkId: "11", CoinSymbol: "USDT"}); err == nil {
+		t.Error("missing order type accepted")
+	}
+	if _, err := cl.CreateMirrorXOrder(&CreateMirrorXOrderReq{MirrorXLinkId: "11", OrderType: MirrorXOrderTypeDeposit, CoinSymbol: "USDT", Amount: "-1"}); err == nil {
+		t.Error("negative amount accepted")
+	}
+	if calls != 0 {
+		t.Fatalf("invalid requests were sent: %d", calls)
+	}
+}
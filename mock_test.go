@@ -0,0 +1,44 @@
+package ceffu
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newMockClient returns a client talking to a local test server serving handler.
+func newMockClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	cl, err := New("test-api-key", base64.StdEncoding.EncodeToString(der), server.Client(), nil, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cl
+}
+
+// newRouteClient returns a client whose test server answers each path with a fixed body.
+// Unknown paths get an empty successful page.
+func newRouteClient(t *testing.T, routes map[string]string) *Client {
+	t.Helper()
+	return newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			body = `{"code":"000000","message":"success","data":{"data":[],"totalPage":1,"pageNo":1,"pageLimit":25}}`
+		}
+		_, _ = w.Write([]byte(body))
+	})
+}
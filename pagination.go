@@ -0,0 +1,196 @@
+package ceffu
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// validateHistory checks the time range and paging of a history query
+func validateHistory(startTime time.Time, endTime time.Time, pageLimit int, pageNo int) error {
+	if startTime.IsZero() {
+		return errors.New("startTime is required")
+	}
+	if !endTime.IsZero() && endTime.Before(startTime) {
+		return errors.New("endTime must not be before startTime")
+	}
+	return validatePaging(pageLimit, pageNo)
+}
+
+// validatePaging checks the optional paging parameters of a history or list query.
+// Zero values are replaced by pageParams with the limits of the environment.
+func validatePaging(pageLimit int, pageNo int) error {
+	if pageLimit < 0 || pageNo < 0 {
+		return errors.New("pageLimit and pageNo must not be negative")
+	}
+	return nil
+}
+
+// pageParams returns the paging parameters of a validated query.
+// pageLimit defaults to the page limit of the environment and is capped at its maximum, pageNo defaults to 1.
+func (c *Client) pageParams(pageLimit int, pageNo int) map[string]string {
+	if pageNo == 0 {
+		pageNo = 1
+	}
+	return map[string]string{
+		"pageLimit": strconv.Itoa(c.pageLimit(pageLimit)),
+		"pageNo":    strconv.Itoa(pageNo),
+	}
+}
+
+func validateWithdrawStatus(status WithdrawStatus) error {
+	switch status {
+	case WithdrawStatusAll, WithdrawStatusPending, WithdrawStatusProcessing, WithdrawStatusSuccess, WithdrawStatusConfirmed, WithdrawStatusFailed:
+		return nil
+	}
+	return fmt.Errorf("invalid status %d", status)
+}
+
+// historyParams returns the time range and paging parameters of a validated history query.
+// endTime defaults to now, paging is set by pageParams.
+func (c *Client) historyParams(startTime time.Time, endTime time.Time, pageLimit int, pageNo int) map[string]string {
+	if endTime.IsZero() {
+		endTime = time.Now()
+	}
+	params := c.pageParams(pageLimit, pageNo)
+	params["startTime"] = strconv.FormatInt(startTime.UnixMilli(), 10)
+	params["endTime"] = strconv.FormatInt(endTime.UnixMilli(), 10)
+	return params
+}
+
+// millisTime converts an optional unix timestamp in milliseconds, 0 is the zero time
+func millisTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// forEachPage calls fetch for page 1, 2, ... until the last page reported by Ceffu.
+// fetch returns the totalPage of the response it got.
+func forEachPage(fetch func(pageNo int) (totalPage int, err error)) error {
+	for pageNo := 1; ; pageNo++ {
+		totalPage, err := fetch(pageNo)
+		if err != nil {
+			return err
+		}
+		if pageNo >= totalPage {
+			return nil
+		}
+	}
+}
+
+// listAllWallets returns every wallet of the organization
+func (c *Client) listAllWallets() ([]WalletInfo, error) {
+	var wallets []WalletInfo
+	err := forEachPage(func(pageNo int) (int, error) {
+		resp, err := c.GetWalletList(25, pageNo)
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		wallets = append(wallets, resp.Data.Data...)
+		return resp.Data.TotalPage, nil
+	})
+	return wallets, err
+}
+
+// listAllSubWallets returns the ids of every sub wallet under parentWalletId
+func (c *Client) listAllSubWallets(parentWalletId int64) ([]int64, error) {
+	var subWallets []int64
+	err := forEachPage(func(pageNo int) (int, error) {
+		resp, err := c.QueryAllSubWallet(&SubWalletListQuery{ParentWalletID: NewWalletID(parentWalletId), PageNo: pageNo})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		subWallets = append(subWallets, resp.Data.Data...)
+		return resp.Data.TotalPage, nil
+	})
+	return subWallets, err
+}
+
+// listAllAssets returns every asset balance of a wallet
+func (c *Client) listAllAssets(walletId WalletID) ([]AssetBalance, error) {
+	var assets []AssetBalance
+	err := forEachPage(func(pageNo int) (int, error) {
+		resp, err := c.GetAssetDetails("", "", walletId, 25, pageNo)
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		assets = append(assets, resp.Data.Data...)
+		return resp.Data.TotalPage, nil
+	})
+	return assets, err
+}
+
+// listAllSubWalletAssets returns every asset balance of a sub wallet
+func (c *Client) listAllSubWalletAssets(walletId int64) ([]AssetBalance, error) {
+	var assets []AssetBalance
+	err := forEachPage(func(pageNo int) (int, error) {
+		resp, err := c.GetSubWalletAssetDetails(NewWalletID(walletId), "", "", 25, pageNo)
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		for _, asset := range resp.Data.Data {
+			network, _ := asset.Network.(string)
+			assets = append(assets, AssetBalance{
+				CoinSymbol:      asset.CoinSymbol,
+				Network:         network,
+				Amount:          asset.Amount,
+				AvailableAmount: asset.AvailableAmount,
+			})
+		}
+		return resp.Data.TotalPage, nil
+	})
+	return assets, err
+}
+
+// listAllMirrorXLinks returns every MirrorX link of the organization
+func (c *Client) listAllMirrorXLinks() ([]MirrorXLink, error) {
+	var links []MirrorXLink
+	err := forEachPage(func(pageNo int) (int, error) {
+		resp, err := c.QueryMirrorXLinkList(&MirrorXLinkListQuery{PageNo: pageNo})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		links = append(links, resp.Data.Data...)
+		return resp.Data.TotalPage, nil
+	})
+	return links, err
+}
+
+// listAllMirrorXPositions returns every position of a MirrorX link
+func (c *Client) listAllMirrorXPositions(mirrorXLinkId MirrorXLinkID, excludeZeroAmount bool) ([]MirrorXPosition, error) {
+	var positions []MirrorXPosition
+	err := forEachPage(func(pageNo int) (int, error) {
+		resp, err := c.GetMirrorXAssetPositions(&MirrorXAssetPositionsQuery{
+			MirrorXLinkId:     mirrorXLinkId,
+			ExcludeZeroAmount: excludeZeroAmount,
+			PageNo:            pageNo,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		positions = append(positions, resp.Data.Data...)
+		return resp.Data.TotalPage, nil
+	})
+	return positions, err
+}
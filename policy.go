@@ -0,0 +1,83 @@
+package ceffu
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrWithdrawalPolicy is returned by Withdrawal for withdrawals refused by the WithdrawalPolicy of the client
+var ErrWithdrawalPolicy = errors.New("withdrawal refused by policy")
+
+// WithdrawalPolicy limits the withdrawals a client may make, the zero value allows everything
+type WithdrawalPolicy struct {
+	// MaxAmounts is the largest amount of a single withdrawal per coin symbol, decimal strings
+	MaxAmounts map[string]string `json:"maxAmounts,omitempty"`
+	// AllowedCoins refuses withdrawals of other coins if not empty
+	AllowedCoins []string `json:"allowedCoins,omitempty"`
+	// AllowedAddresses refuses withdrawals to other addresses if not empty
+	AllowedAddresses []string `json:"allowedAddresses,omitempty"`
+}
+
+// Validate checks the amounts of the policy
+func (p *WithdrawalPolicy) Validate() error {
+	for coin, max := range p.MaxAmounts {
+		amount, err := parseAmount(max)
+		if err != nil {
+			return fmt.Errorf("max amount of %s: %w", coin, err)
+		}
+		if amount.Sign() < 0 {
+			return fmt.Errorf("max amount of %s is negative", coin)
+		}
+	}
+	return nil
+}
+
+// check returns an error wrapping ErrWithdrawalPolicy if the withdrawal is not allowed
+func (p *WithdrawalPolicy) check(amount string, coinSymbol string, withdrawalAddress string) error {
+	if len(p.AllowedCoins) > 0 && !containsFold(p.AllowedCoins, coinSymbol) {
+		return fmt.Errorf("%w: coin %s is not allowed", ErrWithdrawalPolicy, coinSymbol)
+	}
+	for coin, max := range p.MaxAmounts {
+		if !strings.EqualFold(coin, coinSymbol) {
+			continue
+		}
+		value, err := parseAmount(amount)
+		if err != nil {
+			return err
+		}
+		limit, err := parseAmount(max)
+		if err != nil {
+			return err
+		}
+		if value.Cmp(limit) > 0 {
+			return fmt.Errorf("%w: %s %s exceeds the limit of %s", ErrWithdrawalPolicy, amount, coinSymbol, max)
+		}
+	}
+	if len(p.AllowedAddresses) > 0 {
+		address := normalizeAddress(withdrawalAddress)
+		for _, allowed := range p.AllowedAddresses {
+			if normalizeAddress(allowed) == address {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: address %s is not allowed", ErrWithdrawalPolicy, withdrawalAddress)
+	}
+	return nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithWithdrawalPolicy makes Withdrawal refuse withdrawals not allowed by policy before they are sent
+func WithWithdrawalPolicy(policy WithdrawalPolicy) Option {
+	return func(c *Client) {
+		c.withdrawalPolicy = &policy
+	}
+}
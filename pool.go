@@ -0,0 +1,309 @@
+package ceffu
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// DefaultPoolRateLimit is the calls per second of one account when PoolConfig.RateLimit is 0
+const DefaultPoolRateLimit = 5
+
+// ErrUnknownWallet is returned by ClientPool.ClientFor for a wallet id not owned by any account
+var ErrUnknownWallet = errors.New("wallet does not belong to any account of the pool")
+
+// PoolAccount is one Ceffu organisation of a ClientPool
+type PoolAccount struct {
+	Name       string `json:"name"`
+	ApiKey     string `json:"apiKey"`
+	PrivateKey string `json:"privateKey"` // base64 encoded PKCS8 RSA key, see New
+	BaseUrl    string `json:"baseUrl,omitempty"`
+}
+
+// PoolConfig lists the accounts of a ClientPool
+type PoolConfig struct {
+	Accounts []PoolAccount `json:"accounts"`
+	// RateLimit is the calls per second of one account, shared by accounts using the same API key, default DefaultPoolRateLimit
+	RateLimit float64 `json:"rateLimit,omitempty"`
+	RateBurst int     `json:"rateBurst,omitempty"`
+}
+
+// PoolWallet is a wallet of one account of a ClientPool
+type PoolWallet struct {
+	Account string `json:"account"`
+	WalletInfo
+}
+
+// PoolWalletSummary is the asset summary of one wallet of a ClientPool
+type PoolWalletSummary struct {
+	Account string `json:"account"`
+	AssetSummary
+}
+
+// PoolSummary is the reference value of every wallet of a ClientPool
+type PoolSummary struct {
+	Wallets []PoolWalletSummary `json:"wallets"`
+	// Totals per account, summed over its wallets
+	AccountTotalsInBTC map[string]string `json:"accountTotalsInBTC"`
+	AccountTotalsInUSD map[string]string `json:"accountTotalsInUSD"`
+	TotalAmountInBTC   string            `json:"totalAmountInBTC"`
+	TotalAmountInUSD   string            `json:"totalAmountInUSD"`
+}
+
+// ClientPool manages the clients of several Ceffu organisations and routes calls by wallet id.
+// It is safe for concurrent use.
+type ClientPool struct {
+	mu       sync.RWMutex
+	clients  map[string]*Client
+	names    []string
+	wallets  map[int64]string        // wallet id to account name
+	limiters map[string]*RateLimiter // account name to rate limiter
+
+	rateLimit float64
+	rateBurst int
+}
+
+// NewClientPool creates a client for every account of config.
+// client and logger are passed to New, opts are applied to every client.
+// Accounts configured with the same API key share one rate limiter, it is set when their client is created.
+func NewClientPool(config PoolConfig, client *http.Client, logger *log.Logger, opts ...Option) (*ClientPool, error) {
+	if config.RateLimit < 0 {
+		return nil, errors.New("rate limit must not be negative")
+	}
+	if config.RateLimit == 0 {
+		config.RateLimit = DefaultPoolRateLimit
+	}
+	if err := validateRateLimit(config.RateLimit); err != nil {
+		return nil, err
+	}
+	p := &ClientPool{
+		clients:   map[string]*Client{},
+		wallets:   map[int64]string{},
+		limiters:  map[string]*RateLimiter{},
+		rateLimit: config.RateLimit,
+		rateBurst: config.RateBurst,
+	}
+	byKey := map[string]string{} // configured api key to the first account using it
+	for _, account := range config.Accounts {
+		if account.ApiKey == "" || account.PrivateKey == "" {
+			return nil, fmt.Errorf("account %q: api key and private key are required", account.Name)
+		}
+		if account.Name == "" {
+			return nil, errors.New("account name is required")
+		}
+		first, ok := byKey[account.ApiKey]
+		if !ok {
+			first = account.Name
+			byKey[account.ApiKey] = first
+		}
+		limiter := p.RateLimiter(first)
+		p.limiters[account.Name] = limiter
+		clientOpts := append(append([]Option(nil), opts...), WithRateLimiter(limiter))
+		cl, err := New(account.ApiKey, account.PrivateKey, client, logger, account.BaseUrl, clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("account %q: %w", account.Name, err)
+		}
+		if err = p.Add(account.Name, cl); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// RateLimiter returns the rate limiter of the account name, creating it with the limits of the pool.
+// Pass it to WithRateLimiter when creating a client for Add, so it is paced like the clients of the pool.
+func (p *ClientPool) RateLimiter(name string) *RateLimiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	limiter, ok := p.limiters[name]
+	if !ok {
+		limiter = NewRateLimiter(p.rateLimit, p.rateBurst)
+		p.limiters[name] = limiter
+	}
+	return limiter
+}
+
+// Add adds a client under name. The client is not modified, it keeps the rate limiter it was created with.
+func (p *ClientPool) Add(name string, client *Client) error {
+	if name == "" {
+		return errors.New("account name is required")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.clients[name]; ok {
+		return fmt.Errorf("duplicate account %q", name)
+	}
+	p.clients[name] = client
+	p.names = append(p.names, name)
+	sort.Strings(p.names)
+	return nil
+}
+
+// Names returns the account names in sorted order
+func (p *ClientPool) Names() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]string(nil), p.names...)
+}
+
+// Client returns the client of an account
+func (p *ClientPool) Client(name string) (*Client, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	client, ok := p.clients[name]
+	return client, ok
+}
+
+// Refresh relearns which account owns each wallet from GetWalletList.
+// A wallet id listed by two accounts is an error, the previous routes are kept then.
+func (p *ClientPool) Refresh() error {
+	wallets, err := p.ListWallets()
+	if err != nil {
+		return err
+	}
+	routes := make(map[int64]string, len(wallets))
+	for _, wallet := range wallets {
+		if owner, ok := routes[wallet.WalletID]; ok && owner != wallet.Account {
+			return fmt.Errorf("wallet %d is listed by accounts %q and %q", wallet.WalletID, owner, wallet.Account)
+		}
+		routes[wallet.WalletID] = wallet.Account
+	}
+	p.mu.Lock()
+	p.wallets = routes
+	p.mu.Unlock()
+	return nil
+}
+
+// AccountOf returns the name of the account owning walletId as of the last Refresh
+func (p *ClientPool) AccountOf(walletId int64) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	name, ok := p.wallets[walletId]
+	return name, ok
+}
+
+// ClientFor returns the client of the account owning walletId.
+// Unknown wallets trigger a Refresh, ErrUnknownWallet is returned if it is still not found.
+func (p *ClientPool) ClientFor(walletId int64) (*Client, error) {
+	if name, ok := p.AccountOf(walletId); ok {
+		client, _ := p.Client(name)
+		return client, nil
+	}
+	if err := p.Refresh(); err != nil {
+		return nil, err
+	}
+	if name, ok := p.AccountOf(walletId); ok {
+		client, _ := p.Client(name)
+		return client, nil
+	}
+	return nil, fmt.Errorf("wallet %d: %w", walletId, ErrUnknownWallet)
+}
+
+// each calls fn for every account concurrently and joins the errors, prefixed with the account name
+func (p *ClientPool) each(fn func(name string, client *Client) error) error {
+	p.mu.RLock()
+	names := append([]string(nil), p.names...)
+	clients := make([]*Client, len(names))
+	for i, name := range names {
+		clients[i] = p.clients[name]
+	}
+	p.mu.RUnlock()
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := fn(names[i], clients[i]); err != nil {
+				errs[i] = fmt.Errorf("account %q: %w", names[i], err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// ListWallets returns the wallets of every account, sorted by account name.
+// If some accounts fail, the wallets of the others are returned together with the error.
+func (p *ClientPool) ListWallets() ([]PoolWallet, error) {
+	var mu sync.Mutex
+	var wallets []PoolWallet
+	err := p.each(func(name string, client *Client) error {
+		list, err := client.listAllWallets()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, wallet := range list {
+			wallets = append(wallets, PoolWallet{Account: name, WalletInfo: wallet})
+		}
+		return nil
+	})
+	sort.SliceStable(wallets, func(i, j int) bool {
+		if wallets[i].Account != wallets[j].Account {
+			return wallets[i].Account < wallets[j].Account
+		}
+		return wallets[i].WalletID < wallets[j].WalletID
+	})
+	return wallets, err
+}
+
+// Summary returns the asset summary of every wallet of every account with totals per account and overall.
+// If some accounts fail, the summary of the others is returned together with the error.
+func (p *ClientPool) Summary() (*PoolSummary, error) {
+	var mu sync.Mutex
+	summary := &PoolSummary{
+		AccountTotalsInBTC: map[string]string{},
+		AccountTotalsInUSD: map[string]string{},
+	}
+	totalBTC, totalUSD := new(big.Rat), new(big.Rat)
+	err := p.each(func(name string, client *Client) error {
+		wallets, err := client.listAllWallets()
+		if err != nil {
+			return err
+		}
+		accountBTC, accountUSD := new(big.Rat), new(big.Rat)
+		var summaries []PoolWalletSummary
+		for _, wallet := range wallets {
+			resp, err := client.GetAssetSummary(NewWalletID(wallet.WalletID))
+			if err != nil {
+				return err
+			}
+			data, err := resp.Unwrap()
+			if err != nil {
+				return fmt.Errorf("wallet %d: %w", wallet.WalletID, err)
+			}
+			btc, err := parseAmount(data.TotalAmountInBTC)
+			if err != nil {
+				return err
+			}
+			usd, err := parseAmount(data.TotalAmountInUSD)
+			if err != nil {
+				return err
+			}
+			accountBTC.Add(accountBTC, btc)
+			accountUSD.Add(accountUSD, usd)
+			summaries = append(summaries, PoolWalletSummary{Account: name, AssetSummary: data})
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		summary.Wallets = append(summary.Wallets, summaries...)
+		summary.AccountTotalsInBTC[name] = formatAmount(accountBTC)
+		summary.AccountTotalsInUSD[name] = formatAmount(accountUSD)
+		totalBTC.Add(totalBTC, accountBTC)
+		totalUSD.Add(totalUSD, accountUSD)
+		return nil
+	})
+	sort.SliceStable(summary.Wallets, func(i, j int) bool {
+		return summary.Wallets[i].Account < summary.Wallets[j].Account
+	})
+	summary.TotalAmountInBTC = formatAmount(totalBTC)
+	summary.TotalAmountInUSD = formatAmount(totalUSD)
+	return summary, err
+}
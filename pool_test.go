@@ -0,0 +1,90 @@
+package ceffu
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClientPool(t *testing.T) {
+	treasury := newRouteClient(t, map[string]string{
+		"/open-api/v1/wallet/list":          `{"code":"000000","data":{"data":[{"walletId":1,"walletName":"hot"},{"walletId":2,"walletName":"cold"}],"totalPage":1,"pageNo":1}}`,
+		"/open-api/v1/wallet/asset/summary": `{"code":"000000","data":{"totalAmountInBTC":"0.5","totalAmountInUSD":"30000.25"}}`,
+	})
+	trading := newRouteClient(t, map[string]string{
+		"/open-api/v1/wallet/list":          `{"code":"000000","data":{"data":[{"walletId":3,"walletName":"prime"}],"totalPage":1,"pageNo":1}}`,
+		"/open-api/v1/wallet/asset/summary": `{"code":"000000","data":{"totalAmountInBTC":"1","totalAmountInUSD":"60000"}}`,
+	})
+	other := newRouteClient(t, nil)
+	WithCredentials(StaticCredentials(&Credential{ApiKey: "other-api-key", Signer: other.credentials.Credentials()[0].Signer}))(other)
+
+	pool, err := NewClientPool(PoolConfig{RateLimit: 1000, RateBurst: 10}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, client := range map[string]*Client{"treasury": treasury, "trading": trading, "other": other} {
+		if err = pool.Add(name, client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = pool.Add("trading", trading); err == nil {
+		t.Fatal("duplicate account accepted")
+	}
+	if treasury.limiter != nil || other.limiter != nil {
+		t.Fatal("added clients were modified")
+	}
+
+	client, err := pool.ClientFor(3)
+	if err != nil || client != trading {
+		t.Fatalf("wallet 3 not routed to trading: %v", err)
+	}
+	if name, _ := pool.AccountOf(2); name != "treasury" {
+		t.Fatalf("wallet 2 routed to %q", name)
+	}
+	if _, err = pool.ClientFor(9); !errors.Is(err, ErrUnknownWallet) {
+		t.Fatalf("expected unknown wallet, got %v", err)
+	}
+
+	wallets, err := pool.ListWallets()
+	if err != nil || len(wallets) != 3 || wallets[0].Account != "trading" || wallets[2].WalletName != "cold" {
+		t.Fatalf("unexpected wallets %+v %v", wallets, err)
+	}
+
+	summary, err := pool.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.TotalAmountInBTC != "2" || summary.TotalAmountInUSD != "120000.5" || summary.AccountTotalsInUSD["treasury"] != "60000.5" ||
+		summary.AccountTotalsInBTC["other"] != "0" || len(summary.Wallets) != 3 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestClientPoolRateLimiters(t *testing.T) {
+	key := newTestKey(t)
+	pool, err := NewClientPool(PoolConfig{Accounts: []PoolAccount{
+		{Name: "treasury", ApiKey: "shared-api-key", PrivateKey: key, BaseUrl: "https://example.com"},
+		{Name: "trading", ApiKey: "shared-api-key", PrivateKey: key, BaseUrl: "https://example.com"},
+		{Name: "other", ApiKey: "other-api-key", PrivateKey: key, BaseUrl: "https://example.com"},
+	}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	treasury, _ := pool.Client("treasury")
+	trading, _ := pool.Client("trading")
+	other, _ := pool.Client("other")
+	if treasury.limiter == nil || treasury.limiter != trading.limiter || other.limiter == treasury.limiter {
+		t.Fatal("rate limiters not shared per api key")
+	}
+	// Limiters follow the account name, not the current api key
+	if pool.RateLimiter("trading") != trading.limiter || pool.RateLimiter("other") != other.limiter {
+		t.Fatal("rate limiter not kept per account")
+	}
+}
+
+func TestClientPoolInvalidRateLimit(t *testing.T) {
+	for _, rate := range []float64{1e10, 1e-12} {
+		if _, err := NewClientPool(PoolConfig{RateLimit: rate}, nil, nil); err == nil {
+			t.Errorf("rate limit %v accepted", rate)
+		}
+	}
+}
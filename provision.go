@@ -0,0 +1,374 @@
+package ceffu
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CoinNetwork is a coin on a specific network, e.g. USDT on ETH
+type CoinNetwork struct {
+	CoinSymbol string `json:"coinSymbol"`
+	Network    string `json:"network"`
+}
+
+// ProvisionCustomer is a customer that needs a sub wallet
+type ProvisionCustomer struct {
+	CustomerID string
+	WalletName string // optional, default CustomerID, max 20 char
+}
+
+// ProvisionConfig configures a Provisioner
+type ProvisionConfig struct {
+	// ParentWalletID is the prime wallet the sub wallets are created under, required
+	ParentWalletID int64
+	// Networks are the deposit addresses fetched for every sub wallet, required
+	Networks []CoinNetwork
+	// AutoCollection is passed to CreateSubWallet
+	AutoCollection bool
+	// RateLimiter paces all API calls, default 5 calls per second
+	RateLimiter *RateLimiter
+	// MaxRetries is how often a call rejected by ErrorRateLimitExceeded is retried, default 5
+	MaxRetries int
+	// StatePath is the file progress is saved to after every step. Running again with the
+	// same file resumes where a previous run stopped. Required.
+	StatePath string
+}
+
+type ProvisionedAddress struct {
+	CoinSymbol string `json:"coinSymbol"`
+	Network    string `json:"network"`
+	Address    string `json:"address"`
+	Memo       string `json:"memo,omitempty"`
+}
+
+// ProvisionedCustomer is the provisioning state of a single customer
+type ProvisionedCustomer struct {
+	CustomerID string `json:"customerId"`
+	RequestId  int64  `json:"requestId"` // requestId of CreateSubWallet, kept so a retry can't create a second wallet
+	// Pending marks a CreateSubWallet sent without its wallet id saved yet. PendingAfter is the
+	// highest sub wallet id under the parent before it was sent, the created wallet is looked up above it.
+	Pending      bool                 `json:"pending,omitempty"`
+	PendingAfter int64                `json:"pendingAfter,omitempty"`
+	WalletID     int64                `json:"walletId,omitempty"`
+	Addresses    []ProvisionedAddress `json:"addresses,omitempty"`
+	Error        string               `json:"error,omitempty"`
+}
+
+func (p *ProvisionedCustomer) address(network CoinNetwork) *ProvisionedAddress {
+	for i := range p.Addresses {
+		if p.Addresses[i].CoinSymbol == network.CoinSymbol && p.Addresses[i].Network == network.Network {
+			return &p.Addresses[i]
+		}
+	}
+	return nil
+}
+
+type ProvisionResult struct {
+	Customers []ProvisionedCustomer
+	Failed    int
+}
+
+// WriteCSV writes the customer to wallet id to address mapping, one row per address
+func (r *ProvisionResult) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"customerId", "walletId", "coinSymbol", "network", "address", "memo"})
+	if err != nil {
+		return err
+	}
+	for _, customer := range r.Customers {
+		for _, address := range customer.Addresses {
+			err = writer.Write([]string{
+				customer.CustomerID,
+				strconv.FormatInt(customer.WalletID, 10),
+				address.CoinSymbol,
+				address.Network,
+				address.Address,
+				address.Memo,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSON writes all customers including failures as a json array
+func (r *ProvisionResult) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r.Customers)
+}
+
+// Provisioner creates sub wallets and deposit addresses for many customers
+type Provisioner struct {
+	client *Client
+	config ProvisionConfig
+	mu     sync.Mutex
+	state  map[string]*ProvisionedCustomer
+	// highest is the highest sub wallet id under the parent, loaded before the first create
+	highest *int64
+}
+
+func NewProvisioner(client *Client, config ProvisionConfig) (*Provisioner, error) {
+	if config.ParentWalletID == 0 {
+		return nil, errors.New("parent wallet id is required")
+	}
+	if len(config.Networks) == 0 {
+		return nil, errors.New("at least one coin network is required")
+	}
+	if config.StatePath == "" {
+		return nil, errors.New("state path is required")
+	}
+	if config.RateLimiter == nil {
+		config.RateLimiter = NewRateLimiter(5, 1)
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = 5
+	}
+	p := &Provisioner{
+		client: client,
+		config: config,
+		state:  map[string]*ProvisionedCustomer{},
+	}
+	encoded, err := os.ReadFile(config.StatePath)
+	if err == nil {
+		err = json.Unmarshal(encoded, &p.state)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Provisioner) save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	encoded, err := json.Marshal(p.state)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(p.config.StatePath+".tmp", encoded, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(p.config.StatePath+".tmp", p.config.StatePath)
+}
+
+// call runs fn after waiting for the rate limiter, retrying while Ceffu reports ErrorRateLimitExceeded
+func (p *Provisioner) call(fn func() (code string, err error)) error {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		p.config.RateLimiter.Wait()
+		code, err := fn()
+		if err != nil || code != ErrorRateLimitExceeded || attempt >= p.config.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Run provisions every customer. Customers completed by an earlier run with the same
+// StatePath are skipped, partially provisioned customers are completed.
+// Per customer failures are recorded in the result, only state file errors abort the run.
+func (p *Provisioner) Run(customers []ProvisionCustomer) (*ProvisionResult, error) {
+	result := &ProvisionResult{}
+	for _, customer := range customers {
+		state, err := p.provision(customer)
+		if err != nil {
+			state.Error = err.Error()
+			result.Failed++
+		} else {
+			state.Error = ""
+		}
+		err = p.save()
+		if err != nil {
+			return nil, err
+		}
+		result.Customers = append(result.Customers, *state)
+	}
+	return result, nil
+}
+
+func (p *Provisioner) provision(customer ProvisionCustomer) (*ProvisionedCustomer, error) {
+	if customer.CustomerID == "" {
+		return &ProvisionedCustomer{}, errors.New("customer id is required")
+	}
+	p.mu.Lock()
+	state, ok := p.state[customer.CustomerID]
+	if !ok {
+		state = &ProvisionedCustomer{CustomerID: customer.CustomerID}
+		p.state[customer.CustomerID] = state
+	}
+	p.mu.Unlock()
+
+	if state.WalletID == 0 {
+		if state.RequestId == 0 {
+			highest, err := p.highestSubWallet()
+			if err != nil {
+				return state, err
+			}
+			// Persist the requestId before sending, so a crash can't lead to a second sub wallet
+			state.RequestId = GetReqId()
+			state.Pending = true
+			state.PendingAfter = highest
+			err = p.save()
+			if err != nil {
+				return state, err
+			}
+		}
+		name := customer.WalletName
+		if name == "" {
+			name = customer.CustomerID
+		}
+		var resp *CreateSubWalletResp
+		err := p.call(func() (string, error) {
+			var err error
+			resp, err = p.client.CreateSubWallet(NewWalletID(p.config.ParentWalletID), name, p.config.AutoCollection, state.RequestId)
+			if err != nil {
+				return "", err
+			}
+			return resp.Code, nil
+		})
+		if err != nil {
+			return state, err
+		}
+		var walletId int64
+		if resp.Code == ErrorDuplicateReqID {
+			// Created by an earlier run which stopped before the wallet id was saved
+			walletId, err = p.recoverWallet(state)
+		} else {
+			err = checkCode(resp.Code, resp.Message)
+			walletId = resp.Data.WalletID
+		}
+		if err != nil {
+			return state, err
+		}
+		p.mu.Lock()
+		state.WalletID = walletId
+		state.Pending = false
+		state.PendingAfter = 0
+		if p.highest != nil && *p.highest < walletId {
+			*p.highest = walletId
+		}
+		p.mu.Unlock()
+		err = p.save()
+		if err != nil {
+			return state, err
+		}
+	}
+
+	for _, network := range p.config.Networks {
+		if state.address(network) != nil {
+			continue
+		}
+		var resp *GetSubWalletDepositAddressResp
+		err := p.call(func() (string, error) {
+			var err error
+			resp, err = p.client.GetSubWalletDepositAddress(NewWalletID(state.WalletID), network.CoinSymbol, network.Network)
+			if err != nil {
+				return "", err
+			}
+			return resp.Code, nil
+		})
+		if err != nil {
+			return state, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return state, fmt.Errorf("%s on %s: %w", network.CoinSymbol, network.Network, err)
+		}
+		state.Addresses = append(state.Addresses, ProvisionedAddress{
+			CoinSymbol: network.CoinSymbol,
+			Network:    network.Network,
+			Address:    resp.Data.WalletAddress,
+			Memo:       resp.Data.Memo,
+		})
+	}
+	return state, nil
+}
+
+// highestSubWallet returns the highest sub wallet id under the parent, listing them on first use
+func (p *Provisioner) highestSubWallet() (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.highest != nil {
+		return *p.highest, nil
+	}
+	subWallets, err := p.listSubWallets()
+	if err != nil {
+		return 0, err
+	}
+	var highest int64
+	for _, walletId := range subWallets {
+		if walletId > highest {
+			highest = walletId
+		}
+	}
+	p.highest = &highest
+	return highest, nil
+}
+
+// listSubWallets lists all sub wallets under the parent through the rate limiter
+func (p *Provisioner) listSubWallets() ([]int64, error) {
+	var subWallets []int64
+	err := forEachPage(func(pageNo int) (int, error) {
+		var resp *GetAllSubWalletResp
+		err := p.call(func() (string, error) {
+			var err error
+			resp, err = p.client.GetAllSubWallet(NewWalletID(p.config.ParentWalletID), 0, pageNo)
+			if err != nil {
+				return "", err
+			}
+			return resp.Code, nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		subWallets = append(subWallets, resp.Data.Data...)
+		return resp.Data.TotalPage, nil
+	})
+	return subWallets, err
+}
+
+// recoverWallet finds the sub wallet created for a pending customer: the only sub wallet above
+// PendingAfter which is not assigned to another customer. Ambiguous cases are left to the operator.
+func (p *Provisioner) recoverWallet(state *ProvisionedCustomer) (int64, error) {
+	if !state.Pending {
+		return 0, fmt.Errorf("sub wallet for %s was already requested with requestId %d but its wallet id is unknown", state.CustomerID, state.RequestId)
+	}
+	subWallets, err := p.listSubWallets()
+	if err != nil {
+		return 0, err
+	}
+	p.mu.Lock()
+	assigned := map[int64]bool{}
+	for _, other := range p.state {
+		if other.WalletID != 0 {
+			assigned[other.WalletID] = true
+		}
+	}
+	p.mu.Unlock()
+	var candidates []int64
+	for _, walletId := range subWallets {
+		if walletId > state.PendingAfter && !assigned[walletId] {
+			candidates = append(candidates, walletId)
+		}
+	}
+	if len(candidates) != 1 {
+		return 0, fmt.Errorf("sub wallet for %s was already requested with requestId %d, %d unassigned sub wallets %v were created since, set its walletId in the state file",
+			state.CustomerID, state.RequestId, len(candidates), candidates)
+	}
+	return candidates[0], nil
+}
@@ -0,0 +1,119 @@
+package ceffu
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProvisionerResume(t *testing.T) {
+	created := 0
+	failBSC := true
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/subwallet/create":
+			created++
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"walletId":100,"parentWalletId":1}}`))
+		case "/open-api/v1/subwallet/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[],"totalPage":1}}`))
+		case "/open-api/v1/subwallet/deposit/address":
+			network := r.URL.Query().Get("network")
+			if network == "BSC" && failBSC {
+				_, _ = w.Write([]byte(`{"code":"G20025","message":"address is not activated"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"walletAddress":"addr-` + network + `"}}`))
+		}
+	})
+	config := ProvisionConfig{
+		ParentWalletID: 1,
+		Networks:       []CoinNetwork{{"USDT", "ETH"}, {"USDT", "BSC"}},
+		RateLimiter:    NewRateLimiter(1000, 10),
+		StatePath:      filepath.Join(t.TempDir(), "state.json"),
+	}
+	provisioner, err := NewProvisioner(cl, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := provisioner.Run([]ProvisionCustomer{{CustomerID: "c1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != 1 || result.Customers[0].WalletID != 100 || len(result.Customers[0].Addresses) != 1 {
+		t.Fatalf("unexpected first run %+v", result)
+	}
+
+	// A new process resumes from the state file without creating another wallet
+	failBSC = false
+	provisioner, err = NewProvisioner(cl, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = provisioner.Run([]ProvisionCustomer{{CustomerID: "c1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != 0 || created != 1 {
+		t.Fatalf("unexpected resume %+v, created %d", result, created)
+	}
+	var buf bytes.Buffer
+	_ = result.WriteCSV(&buf)
+	if !strings.Contains(buf.String(), "c1,100,USDT,BSC,addr-BSC,") {
+		t.Fatalf("unexpected mapping %s", buf.String())
+	}
+}
+
+func TestProvisionerRecoversCreatedWallet(t *testing.T) {
+	subWallets := "50"
+	crash := true
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/subwallet/create":
+			if crash {
+				// Ceffu creates the wallet, but the response never arrives
+				subWallets = "50,101,7"
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(`{"code":"G20015","message":"duplicate request id"}`))
+		case "/open-api/v1/subwallet/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[` + subWallets + `],"totalPage":1}}`))
+		case "/open-api/v1/subwallet/deposit/address":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"walletAddress":"addr"}}`))
+		}
+	})
+	config := ProvisionConfig{
+		ParentWalletID: 1,
+		Networks:       []CoinNetwork{{"USDT", "ETH"}},
+		RateLimiter:    NewRateLimiter(1000, 10),
+		StatePath:      filepath.Join(t.TempDir(), "state.json"),
+	}
+	provisioner, err := NewProvisioner(cl, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := provisioner.Run([]ProvisionCustomer{{CustomerID: "c1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != 1 || !result.Customers[0].Pending || result.Customers[0].PendingAfter != 50 {
+		t.Fatalf("unexpected first run %+v", result)
+	}
+
+	// The next run gets a duplicate requestId and finds the wallet created above the marker
+	crash = false
+	provisioner, err = NewProvisioner(cl, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = provisioner.Run([]ProvisionCustomer{{CustomerID: "c1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	customer := result.Customers[0]
+	if result.Failed != 0 || customer.WalletID != 101 || customer.Pending || len(customer.Addresses) != 1 {
+		t.Fatalf("wallet not recovered %+v", result)
+	}
+}
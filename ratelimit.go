@@ -0,0 +1,75 @@
+package ceffu
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting how fast API calls are made. It is safe for concurrent use.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	tokens   float64
+	last     time.Time
+}
+
+// validateRateLimit checks that perSecond calls per second give an interval between 1ns and math.MaxInt64
+func validateRateLimit(perSecond float64) error {
+	interval := float64(time.Second) / perSecond
+	if !(perSecond > 0) || interval < 1 || interval > math.MaxInt64 {
+		return fmt.Errorf("invalid rate limit of %v calls per second", perSecond)
+	}
+	return nil
+}
+
+// NewRateLimiter allows perSecond calls on average with bursts of up to burst calls.
+// burst is at least 1. It panics unless perSecond is positive and at most one call per nanosecond,
+// see TryNewRateLimiter for untrusted input.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	limiter, err := TryNewRateLimiter(perSecond, burst)
+	if err != nil {
+		panic("ceffu: " + err.Error())
+	}
+	return limiter
+}
+
+// TryNewRateLimiter is NewRateLimiter returning an error instead of panicking on an invalid rate
+func TryNewRateLimiter(perSecond float64, burst int) (*RateLimiter, error) {
+	if err := validateRateLimit(perSecond); err != nil {
+		return nil, err
+	}
+	interval := float64(time.Second) / perSecond
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		interval: time.Duration(interval),
+		burst:    burst,
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}, nil
+}
+
+// Wait blocks until a call may be made
+func (l *RateLimiter) Wait() {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		// Reserve the token, the caller sleeps until it has been refilled
+		wait = time.Duration(-l.tokens * float64(l.interval))
+	}
+	l.mu.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,33 @@
+package ceffu
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRateLimiterRejectsInvalidRate(t *testing.T) {
+	for _, perSecond := range []float64{0, -1, math.NaN(), math.Inf(1), 1e-12} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("rate %v accepted", perSecond)
+				}
+			}()
+			NewRateLimiter(perSecond, 1)
+		}()
+	}
+	limiter := NewRateLimiter(1e9, 1)
+	limiter.Wait()
+	limiter.Wait()
+}
+
+func TestTryNewRateLimiter(t *testing.T) {
+	for _, perSecond := range []float64{0, -1, math.NaN(), 2e9, 1e-12} {
+		if _, err := TryNewRateLimiter(perSecond, 1); err == nil {
+			t.Errorf("rate %v accepted", perSecond)
+		}
+	}
+	if limiter, err := TryNewRateLimiter(1e9, 0); err != nil || limiter.burst != 1 {
+		t.Fatalf("unexpected limiter %v %v", limiter, err)
+	}
+}
@@ -0,0 +1,419 @@
+package ceffu
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LedgerEntry is an amount our own books expect for a wallet and coin
+type LedgerEntry struct {
+	WalletID   int64
+	CoinSymbol string
+	Amount     string // decimal string
+}
+
+// Ledger is the expected side of a reconciliation, usually backed by internal accounting.
+// Wallets or coins missing from the result are expected to be zero.
+type Ledger interface {
+	// Balances returns the expected balance of every wallet and coin at the given time
+	Balances(at time.Time) ([]LedgerEntry, error)
+	// NetFlows returns the expected inflow minus outflow of every wallet and coin between start and end
+	NetFlows(start time.Time, end time.Time) ([]LedgerEntry, error)
+}
+
+// ReconciliationLine compares Ceffu with the ledger for a single wallet and coin.
+// Diffs are Ceffu minus ledger.
+type ReconciliationLine struct {
+	WalletID       int64
+	ParentWalletID int64 // 0 for top level wallets
+	CoinSymbol     string
+	CeffuBalance   string
+	LedgerBalance  string
+	BalanceDiff    string
+	CeffuNetFlow   string
+	LedgerNetFlow  string
+	FlowDiff       string
+	Matched        bool
+}
+
+type ReconciliationReport struct {
+	Start        time.Time
+	End          time.Time
+	SnapshotTime time.Time
+	Lines        []ReconciliationLine
+}
+
+// Discrepancies returns the lines where Ceffu and the ledger disagree
+func (r *ReconciliationReport) Discrepancies() []ReconciliationLine {
+	var lines []ReconciliationLine
+	for _, line := range r.Lines {
+		if !line.Matched {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// WriteCSV writes the report as csv with a header row
+func (r *ReconciliationReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"walletId", "parentWalletId", "coinSymbol", "ceffuBalance", "ledgerBalance", "balanceDiff", "ceffuNetFlow", "ledgerNetFlow", "flowDiff", "matched"})
+	if err != nil {
+		return err
+	}
+	for _, line := range r.Lines {
+		err = writer.Write([]string{
+			strconv.FormatInt(line.WalletID, 10),
+			strconv.FormatInt(line.ParentWalletID, 10),
+			line.CoinSymbol,
+			line.CeffuBalance,
+			line.LedgerBalance,
+			line.BalanceDiff,
+			line.CeffuNetFlow,
+			line.LedgerNetFlow,
+			line.FlowDiff,
+			strconv.FormatBool(line.Matched),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Reconciler compares balances and movements on Ceffu with a Ledger.
+type Reconciler struct {
+	client *Client
+	ledger Ledger
+	// Tolerance is the absolute difference still considered a match, decimal string. Default exact match.
+	Tolerance string
+}
+
+func NewReconciler(client *Client, ledger Ledger) *Reconciler {
+	return &Reconciler{
+		client: client,
+		ledger: ledger,
+	}
+}
+
+type reconcileKey struct {
+	walletId int64
+	coin     string
+}
+
+type reconcileState struct {
+	parents  map[int64]int64
+	balances map[reconcileKey]*big.Rat
+	flows    map[reconcileKey]*big.Rat
+}
+
+func (s *reconcileState) add(target map[reconcileKey]*big.Rat, walletId int64, coin string, amount string, negate bool) error {
+	r, err := parseAmount(amount)
+	if err != nil {
+		return err
+	}
+	if negate {
+		r.Neg(r)
+	}
+	key := reconcileKey{walletId: walletId, coin: coin}
+	if target[key] == nil {
+		target[key] = new(big.Rat)
+	}
+	target[key].Add(target[key], r)
+	return nil
+}
+
+// Reconcile snapshots the current balance of every wallet and sub wallet, replays
+// deposits, withdrawals, exchange transfers and sub wallet transfers between start and end,
+// and compares both with the ledger.
+// Only settled movements (status success or confirmed) are replayed, withdrawal fees paid in
+// the withdrawn coin count as outflow.
+func (r *Reconciler) Reconcile(start time.Time, end time.Time) (*ReconciliationReport, error) {
+	tolerance, err := parseAmount(r.Tolerance)
+	if err != nil {
+		return nil, err
+	}
+	state := &reconcileState{
+		parents:  map[int64]int64{},
+		balances: map[reconcileKey]*big.Rat{},
+		flows:    map[reconcileKey]*big.Rat{},
+	}
+	snapshotTime := time.Now()
+	wallets, err := r.client.listAllWallets()
+	if err != nil {
+		return nil, err
+	}
+	for _, wallet := range wallets {
+		err = r.snapshotWallet(state, wallet.WalletID)
+		if err != nil {
+			return nil, err
+		}
+		err = r.replayWallet(state, wallet.WalletID, start, end)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ledgerBalances, err := r.ledger.Balances(snapshotTime)
+	if err != nil {
+		return nil, err
+	}
+	ledgerFlows, err := r.ledger.NetFlows(start, end)
+	if err != nil {
+		return nil, err
+	}
+	expectedBalances := map[reconcileKey]*big.Rat{}
+	expectedFlows := map[reconcileKey]*big.Rat{}
+	for _, entry := range ledgerBalances {
+		err = state.add(expectedBalances, entry.WalletID, entry.CoinSymbol, entry.Amount, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range ledgerFlows {
+		err = state.add(expectedFlows, entry.WalletID, entry.CoinSymbol, entry.Amount, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keys := map[reconcileKey]bool{}
+	for _, m := range []map[reconcileKey]*big.Rat{state.balances, state.flows, expectedBalances, expectedFlows} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+	report := &ReconciliationReport{
+		Start:        start,
+		End:          end,
+		SnapshotTime: snapshotTime,
+	}
+	for key := range keys {
+		ceffuBalance, ledgerBalance := ratOrZero(state.balances[key]), ratOrZero(expectedBalances[key])
+		ceffuFlow, ledgerFlow := ratOrZero(state.flows[key]), ratOrZero(expectedFlows[key])
+		balanceDiff := new(big.Rat).Sub(ceffuBalance, ledgerBalance)
+		flowDiff := new(big.Rat).Sub(ceffuFlow, ledgerFlow)
+		report.Lines = append(report.Lines, ReconciliationLine{
+			WalletID:       key.walletId,
+			ParentWalletID: state.parents[key.walletId],
+			CoinSymbol:     key.coin,
+			CeffuBalance:   formatAmount(ceffuBalance),
+			LedgerBalance:  formatAmount(ledgerBalance),
+			BalanceDiff:    formatAmount(balanceDiff),
+			CeffuNetFlow:   formatAmount(ceffuFlow),
+			LedgerNetFlow:  formatAmount(ledgerFlow),
+			FlowDiff:       formatAmount(flowDiff),
+			Matched:        new(big.Rat).Abs(balanceDiff).Cmp(tolerance) <= 0 && new(big.Rat).Abs(flowDiff).Cmp(tolerance) <= 0,
+		})
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		if report.Lines[i].WalletID != report.Lines[j].WalletID {
+			return report.Lines[i].WalletID < report.Lines[j].WalletID
+		}
+		return report.Lines[i].CoinSymbol < report.Lines[j].CoinSymbol
+	})
+	return report, nil
+}
+
+func ratOrZero(r *big.Rat) *big.Rat {
+	if r == nil {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// isSettled reports whether a movement status is final and successful
+func isSettled(status int) bool {
+	return status == int(WithdrawStatusSuccess) || status == int(WithdrawStatusConfirmed)
+}
+
+// isAPIError reports whether err is an *APIError with one of codes
+func isAPIError(err error, codes ...string) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reconciler) snapshotWallet(state *reconcileState, walletId int64) error {
+	assets, err := r.client.listAllAssets(NewWalletID(walletId))
+	if err != nil {
+		return err
+	}
+	for _, asset := range assets {
+		err = state.add(state.balances, walletId, asset.CoinSymbol, asset.Amount, false)
+		if err != nil {
+			return err
+		}
+	}
+	subWallets, err := r.client.listAllSubWallets(walletId)
+	if isAPIError(err, ErrorWalletTypeNotSupported, ErrorWalletRelationship) {
+		// Wallet can't have sub wallets
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, subWalletId := range subWallets {
+		state.parents[subWalletId] = walletId
+		assets, err = r.client.listAllSubWalletAssets(subWalletId)
+		if err != nil {
+			return err
+		}
+		for _, asset := range assets {
+			err = state.add(state.balances, subWalletId, asset.CoinSymbol, asset.Amount, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Reconciler) replayWallet(state *reconcileState, walletId int64, start time.Time, end time.Time) error {
+	id := NewWalletID(walletId)
+	// Deposits
+	err := forEachPage(func(pageNo int) (int, error) {
+		resp, err := r.client.QueryDepositHistory(&DepositHistoryQuery{WalletID: id, StartTime: start, EndTime: end, PageNo: pageNo})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		for _, deposit := range resp.Data.Data {
+			if isSettled(deposit.Status) {
+				if err = state.add(state.flows, walletId, deposit.CoinSymbol, deposit.Amount, false); err != nil {
+					return 0, err
+				}
+			}
+		}
+		return resp.Data.TotalPage, nil
+	})
+	if err != nil {
+		return err
+	}
+	// Withdrawals
+	err = forEachPage(func(pageNo int) (int, error) {
+		resp, err := r.client.QueryWithdrawalHistory(&WithdrawalHistoryQuery{WalletID: id, StartTime: start, EndTime: end, PageNo: pageNo})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		for _, withdrawal := range resp.Data.Data {
+			if !isSettled(withdrawal.Status) {
+				continue
+			}
+			if err = state.add(state.flows, walletId, withdrawal.CoinSymbol, withdrawal.Amount, true); err != nil {
+				return 0, err
+			}
+			if withdrawal.FeeSymbol == withdrawal.CoinSymbol {
+				if err = state.add(state.flows, walletId, withdrawal.CoinSymbol, withdrawal.FeeAmount, true); err != nil {
+					return 0, err
+				}
+			}
+		}
+		return resp.Data.TotalPage, nil
+	})
+	if err != nil {
+		return err
+	}
+	// Transfers with exchange
+	err = forEachPage(func(pageNo int) (int, error) {
+		resp, err := r.client.QueryTransferHistoryWithExchange(&ExchangeTransferHistoryQuery{WalletID: id, StartTime: start, EndTime: end, PageNo: pageNo})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		for _, transfer := range resp.Data.Data {
+			if isSettled(transfer.Status) {
+				outflow := TransferDirection(transfer.Direction) == TransferDirectionIntWithdraw
+				if err = state.add(state.flows, walletId, transfer.CoinSymbol, transfer.Amount, outflow); err != nil {
+					return 0, err
+				}
+			}
+		}
+		return resp.Data.TotalPage, nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(state.subWalletsOf(walletId)) == 0 {
+		return nil
+	}
+	// Transfers between the parent and its sub wallets
+	err = forEachPage(func(pageNo int) (int, error) {
+		resp, err := r.client.QueryTransferHistory(&SubWalletTransferHistoryQuery{WalletID: id, StartTime: start, EndTime: end, PageNo: pageNo})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		for _, transfer := range resp.Data.Data {
+			if !isSettled(transfer.Status) {
+				continue
+			}
+			if err = state.add(state.flows, transfer.FromWalletId, transfer.CoinSymbol, transfer.Amount, true); err != nil {
+				return 0, err
+			}
+			if err = state.add(state.flows, transfer.ToWalletId, transfer.CoinSymbol, transfer.Amount, false); err != nil {
+				return 0, err
+			}
+		}
+		return resp.Data.TotalPage, nil
+	})
+	if err != nil {
+		return err
+	}
+	// Deposits into sub wallets, this endpoint has no time filter
+	startMs, endMs := start.UnixMilli(), end.UnixMilli()
+	return forEachPage(func(pageNo int) (int, error) {
+		resp, err := r.client.QueryAllSubWalletDepositHistory(&AllSubWalletDepositHistoryQuery{ParentWalletID: id, PageNo: pageNo})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		for _, deposit := range resp.Data.Data {
+			if !isSettled(deposit.Status) || deposit.TxTime < startMs || deposit.TxTime >= endMs {
+				continue
+			}
+			subWalletId, err := strconv.ParseInt(deposit.WalletIdStr, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			if err = state.add(state.flows, subWalletId, deposit.CoinSymbol, deposit.Amount, false); err != nil {
+				return 0, err
+			}
+		}
+		return resp.Data.TotalPage, nil
+	})
+}
+
+func (s *reconcileState) subWalletsOf(parentWalletId int64) []int64 {
+	var subWallets []int64
+	for subWalletId, parent := range s.parents {
+		if parent == parentWalletId {
+			subWallets = append(subWallets, subWalletId)
+		}
+	}
+	return subWallets
+}
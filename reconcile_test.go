@@ -0,0 +1,60 @@
+package ceffu
+
+import (
+	"testing"
+	"time"
+)
+
+type staticLedger struct {
+	balances []LedgerEntry
+	flows    []LedgerEntry
+}
+
+func (l *staticLedger) Balances(time.Time) ([]LedgerEntry, error) {
+	return l.balances, nil
+}
+
+func (l *staticLedger) NetFlows(time.Time, time.Time) ([]LedgerEntry, error) {
+	return l.flows, nil
+}
+
+func TestReconcile(t *testing.T) {
+	now := time.Now()
+	cl := newRouteClient(t, map[string]string{
+		"/open-api/v1/wallet/list":                `{"code":"000000","data":{"data":[{"walletId":1,"walletName":"prime","walletType":20}],"totalPage":1}}`,
+		"/open-api/v1/wallet/asset/list":          `{"code":"000000","data":{"data":[{"coinSymbol":"USDT","network":"ETH","amount":"60"},{"coinSymbol":"USDT","network":"BSC","amount":"40"}],"totalPage":1}}`,
+		"/open-api/v1/subwallet/list":             `{"code":"000000","data":{"data":[2],"totalPage":1}}`,
+		"/open-api/v1/subwallet/asset/details":    `{"code":"000000","data":{"data":[{"coinSymbol":"USDT","network":null,"amount":"5"}],"totalPage":1}}`,
+		"/open-api/v1/wallet/deposit/history":     `{"code":"000000","data":{"data":[{"coinSymbol":"USDT","amount":"150","status":30},{"coinSymbol":"USDT","amount":"999","status":99}],"totalPage":1}}`,
+		"/open-api/v1/wallet/withdrawal/history":  `{"code":"000000","data":{"data":[{"coinSymbol":"USDT","amount":"40","feeSymbol":"USDT","feeAmount":"1","status":30}],"totalPage":1}}`,
+		"/open-api/v1/subwallet/transfer/history": `{"code":"000000","data":{"data":[{"fromWalletId":1,"toWalletId":2,"coinSymbol":"USDT","amount":"5","status":30}],"totalPage":1}}`,
+		"/open-api/v2/subwallet/deposit/history":  `{"code":"000000","data":{"data":[{"walletIdStr":"2","coinSymbol":"USDT","amount":"3","status":30,"txTime":1}],"totalPage":1}}`,
+	})
+	ledger := &staticLedger{
+		balances: []LedgerEntry{
+			{WalletID: 1, CoinSymbol: "USDT", Amount: "100"},
+			{WalletID: 2, CoinSymbol: "USDT", Amount: "4"},
+		},
+		flows: []LedgerEntry{
+			{WalletID: 1, CoinSymbol: "USDT", Amount: "104"},
+			{WalletID: 2, CoinSymbol: "USDT", Amount: "5"},
+		},
+	}
+	report, err := NewReconciler(cl, ledger).Reconcile(now.Add(-24*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Lines) != 2 {
+		t.Fatalf("expected 2 lines, got %+v", report.Lines)
+	}
+	parent, sub := report.Lines[0], report.Lines[1]
+	if !parent.Matched || parent.CeffuBalance != "100" || parent.CeffuNetFlow != "104" {
+		t.Fatalf("unexpected parent line %+v", parent)
+	}
+	if sub.Matched || sub.ParentWalletID != 1 || sub.BalanceDiff != "1" || sub.FlowDiff != "0" {
+		t.Fatalf("unexpected sub wallet line %+v", sub)
+	}
+	if len(report.Discrepancies()) != 1 {
+		t.Fatalf("expected one discrepancy")
+	}
+}
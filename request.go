@@ -2,48 +2,40 @@ package ceffu
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"math/rand"
 	"net/http"
+	"sort"
 	"time"
 )
 
 func (c *Client) post(endpoint string, message map[string]interface{}) ([]byte, error) {
-	// Encode message to JSON
-	// Check if timestamp is present
-	if _, ok := message["timestamp"]; !ok {
-		message["timestamp"] = time.Now().UnixMilli()
-	}
-	encoded, err := json.Marshal(message)
-	if err != nil {
+	return c.postVersion(c.env.VersionPath, endpoint, message)
+}
+
+func (c *Client) postV2(endpoint string, message map[string]interface{}) ([]byte, error) {
+	return c.postVersion(c.env.Version2Path, endpoint, message)
+}
+
+func (c *Client) get(endpoint string, params map[string]string) ([]byte, error) {
+	return c.getVersion(c.env.VersionPath, endpoint, params)
+}
+
+func (c *Client) getV2(endpoint string, params map[string]string) ([]byte, error) {
+	return c.getVersion(c.env.Version2Path, endpoint, params)
+}
+
+func (c *Client) postVersion(versionPath string, endpoint string, message map[string]interface{}) ([]byte, error) {
+	if err := c.checkMutation(); err != nil {
 		return nil, err
 	}
-	// Sign message
-	signature, err := c.SignString(string(encoded))
-	// Assemble request
-	requestPath := fmt.Sprintf("%s%s%s", c.baseUrl, CeffuVersionPath, endpoint)
-	// Add http header
-	request, err := http.NewRequest(http.MethodPost, requestPath, bytes.NewReader(encoded))
-	if err != nil {
+	if err := c.resolveBodyWallets(message); err != nil {
 		return nil, err
 	}
-	request.Header.Add("Content-Type", "application/json")
-	request.Header.Add("signature", signature)
-	request.Header.Add("open-apikey", c.apiKey)
-	request.Header.Add("User-Agent", "ceffu-go-sdk/0.0.0")
-	// Send request
-	response, err := c.http.Do(request)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-	// Read response
-	return io.ReadAll(response.Body)
-}
-
-func (c *Client) postV2(endpoint string, message map[string]interface{}) ([]byte, error) {
 	// Encode message to JSON
 	// Check if timestamp is present
 	if _, ok := message["timestamp"]; !ok {
@@ -53,102 +45,287 @@ func (c *Client) postV2(endpoint string, message map[string]interface{}) ([]byte
 	if err != nil {
 		return nil, err
 	}
-	// Sign message
-	signature, err := c.SignString(string(encoded))
 	// Assemble request
-	requestPath := fmt.Sprintf("%s%s%s", c.baseUrl, CeffuVersion2Path, endpoint)
-	// Add http header
-	request, err := http.NewRequest(http.MethodPost, requestPath, bytes.NewReader(encoded))
-	if err != nil {
-		return nil, err
+	requestPath := fmt.Sprintf("%s%s%s", c.env.BaseUrl, versionPath, endpoint)
+	newRequest := func(ctx context.Context, apiKey string, signature string) (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, requestPath, bytes.NewReader(encoded))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("signature", signature)
+		request.Header.Add("open-apikey", apiKey)
+		request.Header.Add("User-Agent", "ceffu-go-sdk/0.0.0")
+		return request, nil
 	}
-	request.Header.Add("Content-Type", "application/json")
-	request.Header.Add("signature", signature)
-	request.Header.Add("open-apikey", c.apiKey)
-	request.Header.Add("User-Agent", "ceffu-go-sdk/0.0.0")
-	// Send request
-	response, err := c.http.Do(request)
-	if err != nil {
-		return nil, err
+	requestId := ""
+	if id, ok := message["requestId"]; ok {
+		requestId = fmt.Sprint(id)
 	}
-	defer response.Body.Close()
-	// Read response
-	return io.ReadAll(response.Body)
+	walletId := ""
+	for _, key := range walletIdParams {
+		if id, ok := message[key]; ok {
+			walletId = fmt.Sprint(id)
+			break
+		}
+	}
+	return c.signAndSend(newRequest, &signedRequest{
+		Method:    http.MethodPost,
+		Version:   versionPath,
+		Endpoint:  versionPath + endpoint,
+		Payload:   string(encoded),
+		RequestId: requestId,
+		WalletId:  walletId,
+	})
 }
 
-func (c *Client) get(endpoint string, params map[string]string) ([]byte, error) {
-	// Assemble query string
+func (c *Client) getVersion(versionPath string, endpoint string, params map[string]string) ([]byte, error) {
+	if err := c.resolveQueryWallets(params); err != nil {
+		return nil, err
+	}
+	// Assemble query string, sorted so the signed payload is stable
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 	queryString := ""
-	// todo: sort params - although it's not required, it's better to do so
-	for key, value := range params {
-		queryString += fmt.Sprintf("%s=%s&", key, value)
+	for _, key := range keys {
+		queryString += fmt.Sprintf("%s=%s&", key, params[key])
 	}
 	if _, ok := params["timestamp"]; !ok {
 		queryString += fmt.Sprintf("timestamp=%d", time.Now().UnixMilli())
 	}
 	// Assemble request
-	requestPath := fmt.Sprintf("%s%s%s?%s", c.baseUrl, CeffuVersionPath, endpoint, queryString)
-	// Add http header
-	request, err := http.NewRequest(http.MethodGet, requestPath, nil)
-	if err != nil {
-		return nil, err
+	requestPath := fmt.Sprintf("%s%s%s?%s", c.env.BaseUrl, versionPath, endpoint, queryString)
+	newRequest := func(ctx context.Context, apiKey string, signature string) (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestPath, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Add("signature", signature)
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("open-apikey", apiKey)
+		request.Header.Add("User-Agent", "ceffu-go-sdk/0.0.0")
+		return request, nil
 	}
-	// Sign query params
-	signature, err := c.SignString(queryString)
-	if err != nil {
-		return nil, err
+	walletId := ""
+	for _, key := range walletIdParams {
+		if id, ok := params[key]; ok {
+			walletId = id
+			break
+		}
 	}
-	request.Header.Add("signature", signature)
-	request.Header.Add("Content-Type", "application/json")
-	request.Header.Add("open-apikey", c.apiKey)
-	request.Header.Add("User-Agent", "ceffu-go-sdk/0.0.0")
-	// Send request
-	response, err := c.http.Do(request)
-	if err != nil {
-		return nil, err
+	return c.signAndSend(newRequest, &signedRequest{
+		Method:    http.MethodGet,
+		Version:   versionPath,
+		Endpoint:  versionPath + endpoint,
+		Payload:   queryString,
+		RequestId: params["requestId"],
+		WalletId:  walletId,
+	})
+}
+
+// signedRequest describes a request after signing, used for auditing and tracing
+type signedRequest struct {
+	Method    string
+	Version   string // version path, e.g. /open-api/v1/
+	Endpoint  string
+	Payload   string
+	Signature string
+	RequestId string
+	WalletId  string
+	Attempts  int // HTTP requests sent so far for this call
+	Status    int // HTTP status of the last attempt
+}
+
+// requestBuilder builds the http request of a call for an api key and its signature
+type requestBuilder func(ctx context.Context, apiKey string, signature string) (*http.Request, error)
+
+// signAndSend signs the payload of signed and sends the request built by newRequest.
+// If Ceffu rejects the key, the request is signed again with the next credential of the client.
+// An expired key makes a CredentialReloader reload, the request is retried once if that changed the credentials.
+// A configured tracer gets one span for the whole call, covering every attempt.
+func (c *Client) signAndSend(newRequest requestBuilder, signed *signedRequest) ([]byte, error) {
+	ctx := c.Context()
+	if c.tracer == nil {
+		return c.signAndSendContext(ctx, newRequest, signed)
 	}
-	defer response.Body.Close()
-	// Read response
-	return io.ReadAll(response.Body)
+	ctx, span := c.tracer.Start(ctx, signed.Method+" "+signed.Endpoint)
+	defer span.End()
+	body, err := c.signAndSendContext(ctx, newRequest, signed)
+	traceCall(span, signed, responseCode(body), err)
+	return body, err
 }
 
-func (c *Client) getV2(endpoint string, params map[string]string) ([]byte, error) {
-	// Assemble query string
-	queryString := ""
-	// todo: sort params - although it's not required, it's better to do so
-	for key, value := range params {
-		queryString += fmt.Sprintf("%s=%s&", key, value)
+func (c *Client) signAndSendContext(ctx context.Context, newRequest requestBuilder, signed *signedRequest) ([]byte, error) {
+	body, err := c.sendWithCredentials(ctx, c.credentials.Credentials(), newRequest, signed)
+	if err != nil || responseCode(body) != ErrorApiKeyExpired {
+		return body, err
 	}
-	if _, ok := params["timestamp"]; !ok {
-		queryString += fmt.Sprintf("timestamp=%d", time.Now().UnixMilli())
+	reloader, ok := c.credentials.(CredentialReloader)
+	if !ok {
+		return body, nil
 	}
-	// Assemble request
-	requestPath := fmt.Sprintf("%s%s%s?%s", c.baseUrl, CeffuVersion2Path, endpoint, queryString)
-	// Add http header
-	request, err := http.NewRequest(http.MethodGet, requestPath, nil)
-	if err != nil {
-		return nil, err
+	changed, reloadErr := reloader.Reload()
+	if reloadErr != nil {
+		c.Logf("reloading credentials after expired api key failed: %v", reloadErr)
+		return body, nil
+	}
+	if !changed {
+		return body, nil
+	}
+	return c.sendWithCredentials(ctx, reloader.Credentials(), newRequest, signed)
+}
+
+func (c *Client) sendWithCredentials(ctx context.Context, credentials []*Credential, newRequest requestBuilder, signed *signedRequest) ([]byte, error) {
+	if len(credentials) == 0 {
+		return nil, ErrNoCredentials
+	}
+	var body []byte
+	for i, credential := range credentials {
+		signature, err := credential.sign(signed.Payload)
+		if err != nil {
+			return nil, err
+		}
+		request, err := newRequest(ctx, credential.ApiKey, signature)
+		if err != nil {
+			return nil, err
+		}
+		signed.Signature = signature
+		body, err = c.send(request, signed)
+		code := responseCode(body)
+		if err != nil || !isKeyRejected(code) {
+			return body, err
+		}
+		if i < len(credentials)-1 {
+			c.Logf("api key %s rejected with code %s, retrying with the previous key", maskApiKey(credential.ApiKey), code)
+		}
+	}
+	return body, nil
+}
+
+// send executes a signed request and returns the response body
+func (c *Client) send(request *http.Request, signed *signedRequest) ([]byte, error) {
+	start := time.Now()
+	if c.limiter != nil {
+		c.limiter.Wait()
+	}
+	retries := 0
+	signed.Attempts++
+	body, status, err := c.roundTrip(request, signed.Endpoint)
+	for err != nil && retries < c.maxRetries && shouldRetry(request, err) {
+		retry := retryRequest(request)
+		if retry == nil {
+			break
+		}
+		select {
+		case <-request.Context().Done():
+		case <-time.After(c.retryBackoff << retries):
+		}
+		if request.Context().Err() != nil {
+			break
+		}
+		retries++
+		if c.limiter != nil {
+			c.limiter.Wait()
+		}
+		signed.Attempts++
+		body, status, err = c.roundTrip(retry, signed.Endpoint)
+	}
+	signed.Status = status
+	code := responseCode(body)
+	if c.audit != nil {
+		c.recordAudit(signed, start, status, body, err)
+	}
+	if c.slog != nil {
+		c.logRequest(request.Context(), signed, status, code, time.Since(start), body, err)
+	}
+	if c.metrics != nil {
+		c.metrics.observe(signed.Method, signed.Endpoint, status, code, time.Since(start), err)
+	}
+	return body, err
+}
+
+func traceCall(span Span, signed *signedRequest, code string, err error) {
+	span.SetAttribute(AttrHTTPMethod, signed.Method)
+	span.SetAttribute(AttrEndpoint, signed.Endpoint)
+	span.SetAttribute(AttrAPIVersion, apiVersion(signed.Version))
+	if signed.WalletId != "" {
+		span.SetAttribute(AttrWalletID, signed.WalletId)
+	}
+	if signed.RequestId != "" {
+		span.SetAttribute(AttrRequestID, signed.RequestId)
+	}
+	retries := 0
+	if signed.Attempts > 1 {
+		retries = signed.Attempts - 1
+	}
+	span.SetAttribute(AttrRetryCount, retries)
+	if signed.Status != 0 {
+		span.SetAttribute(AttrHTTPStatus, signed.Status)
+	}
+	if code != "" {
+		span.SetAttribute(AttrCode, code)
 	}
-	// Sign query params
-	signature, err := c.SignString(queryString)
 	if err != nil {
-		return nil, err
+		span.RecordError(err)
+	} else if code != "" && code != CodeSuccess {
+		span.RecordError(checkCode(code, ""))
 	}
-	request.Header.Add("signature", signature)
-	request.Header.Add("Content-Type", "application/json")
-	request.Header.Add("open-apikey", c.apiKey)
-	request.Header.Add("User-Agent", "ceffu-go-sdk/0.0.0")
+}
+
+// responseCode returns the Ceffu code of a response body, empty if it is not a Ceffu response
+func responseCode(body []byte) string {
+	var envelope struct {
+		Code string `json:"code"`
+	}
+	if json.Unmarshal(body, &envelope) != nil {
+		return ""
+	}
+	return envelope.Code
+}
+
+func (c *Client) roundTrip(request *http.Request, endpoint string) ([]byte, int, error) {
 	// Send request
 	response, err := c.http.Do(request)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer response.Body.Close()
-	// Read response
-	return io.ReadAll(response.Body)
+	// Read response, capped so a misbehaving proxy can't exhaust memory
+	limit := c.maxResponseSize
+	if limit <= 0 {
+		limit = DefaultMaxResponseSize
+	}
+	body, err := readBody(response.Body, limit)
+	if errors.Is(err, ErrResponseTooLarge) {
+		return nil, response.StatusCode, &TransportError{
+			Endpoint:   endpoint,
+			StatusCode: response.StatusCode,
+			Header:     response.Header,
+			Err:        err,
+		}
+	}
+	if err != nil {
+		return nil, response.StatusCode, err
+	}
+	return body, response.StatusCode, classifyResponse(endpoint, response, body)
 }
 
+// GetReqId generates a positive request id from 63 bits of crypto/rand,
+// so ids from different processes or restarts do not collide in practice.
 func GetReqId() int64 {
-	// generate int64 using random
-	return rand.Int63()
+	var random [8]byte
+	for {
+		_, err := rand.Read(random[:])
+		if err != nil {
+			// crypto/rand never fails on supported platforms
+			panic(err)
+		}
+		id := int64(binary.BigEndian.Uint64(random[:]) >> 1)
+		if id != 0 {
+			return id
+		}
+	}
 }
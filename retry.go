@@ -0,0 +1,47 @@
+package ceffu
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// WithRetry resends GET requests that failed with http 429, 502, 503, 504 or a network error up to
+// maxRetries times, waiting backoff, then twice as long for every further retry.
+// It acts on the transport errors classified in transport.go: a malformed or oversized response,
+// any other http status and errors reported by Ceffu are returned at once.
+// Signed POST requests are never resent, use an IdempotencyManager to repeat mutations safely.
+func WithRetry(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryBackoff = backoff
+	}
+}
+
+// shouldRetry reports whether a failed attempt of request may be sent again, only GET requests are
+func shouldRetry(request *http.Request, err error) bool {
+	if request.Method != http.MethodGet || request.Context().Err() != nil {
+		return false
+	}
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return transportErr.Temporary()
+	}
+	return networkError(err)
+}
+
+// retryRequest returns a copy of request with a fresh body, nil if the body can't be replayed
+func retryRequest(request *http.Request) *http.Request {
+	retry := request.Clone(request.Context())
+	if request.Body != nil {
+		if request.GetBody == nil {
+			return nil
+		}
+		body, err := request.GetBody()
+		if err != nil {
+			return nil
+		}
+		retry.Body = body
+	}
+	return retry
+}
@@ -0,0 +1,465 @@
+package ceffu
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	HoldingSourceWallet    = "wallet"
+	HoldingSourceSubWallet = "subwallet"
+	HoldingSourceMirrorX   = "mirrorx"
+)
+
+// Holding is the balance of a single coin in a wallet, sub wallet or MirrorX link
+type Holding struct {
+	Source          string `json:"source"` // See HoldingSource*
+	WalletID        int64  `json:"walletId"`
+	ParentWalletID  int64  `json:"parentWalletId,omitempty"`
+	WalletName      string `json:"walletName,omitempty"`
+	MirrorXLinkId   string `json:"mirrorXLinkId,omitempty"`
+	CoinSymbol      string `json:"coinSymbol"`
+	Network         string `json:"network,omitempty"`
+	Amount          string `json:"amount"`
+	AvailableAmount string `json:"availableAmount,omitempty"`
+}
+
+func (h *Holding) key() string {
+	return fmt.Sprintf("%s/%d/%s/%s/%s", h.Source, h.WalletID, h.MirrorXLinkId, h.CoinSymbol, h.Network)
+}
+
+// WalletValuation is the reference value of a wallet as reported by GetAssetSummary or GetSubWalletSummary
+type WalletValuation struct {
+	WalletID         int64  `json:"walletId"`
+	ParentWalletID   int64  `json:"parentWalletId,omitempty"`
+	TotalAmountInBTC string `json:"totalAmountInBTC"`
+	TotalAmountInUSD string `json:"totalAmountInUSD"`
+}
+
+// PortfolioSnapshot is every holding of the organization at a point in time
+type PortfolioSnapshot struct {
+	Time       time.Time
+	Holdings   []Holding
+	Valuations []WalletValuation
+}
+
+// TakePortfolioSnapshot walks all wallets, their sub wallets and all MirrorX links and collects their holdings
+func (c *Client) TakePortfolioSnapshot() (*PortfolioSnapshot, error) {
+	snapshot := &PortfolioSnapshot{Time: time.Now().UTC()}
+	wallets, err := c.listAllWallets()
+	if err != nil {
+		return nil, err
+	}
+	for _, wallet := range wallets {
+		walletId := NewWalletID(wallet.WalletID)
+		assets, err := c.listAllAssets(walletId)
+		if err != nil {
+			return nil, err
+		}
+		for _, asset := range assets {
+			snapshot.Holdings = append(snapshot.Holdings, Holding{
+				Source:          HoldingSourceWallet,
+				WalletID:        wallet.WalletID,
+				WalletName:      wallet.WalletName,
+				CoinSymbol:      asset.CoinSymbol,
+				Network:         asset.Network,
+				Amount:          asset.Amount,
+				AvailableAmount: asset.AvailableAmount,
+			})
+		}
+		summary, err := c.GetAssetSummary(walletId)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkCode(summary.Code, summary.Message); err != nil {
+			return nil, err
+		}
+		snapshot.Valuations = append(snapshot.Valuations, WalletValuation{
+			WalletID:         wallet.WalletID,
+			TotalAmountInBTC: summary.Data.TotalAmountInBTC,
+			TotalAmountInUSD: summary.Data.TotalAmountInUSD,
+		})
+
+		subWallets, err := c.listAllSubWallets(wallet.WalletID)
+		if isAPIError(err, ErrorWalletTypeNotSupported, ErrorWalletRelationship) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(subWallets) == 0 {
+			continue
+		}
+		for _, subWalletId := range subWallets {
+			assets, err = c.listAllSubWalletAssets(subWalletId)
+			if err != nil {
+				return nil, err
+			}
+			for _, asset := range assets {
+				snapshot.Holdings = append(snapshot.Holdings, Holding{
+					Source:          HoldingSourceSubWallet,
+					WalletID:        subWalletId,
+					ParentWalletID:  wallet.WalletID,
+					CoinSymbol:      asset.CoinSymbol,
+					Network:         asset.Network,
+					Amount:          asset.Amount,
+					AvailableAmount: asset.AvailableAmount,
+				})
+			}
+		}
+		subSummary, err := c.GetSubWalletSummary(walletId)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkCode(subSummary.Code, subSummary.Message); err != nil {
+			return nil, err
+		}
+		for _, sub := range subSummary.Data.Data {
+			subWalletId, err := strconv.ParseInt(sub.WalletIDStr, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			snapshot.Valuations = append(snapshot.Valuations, WalletValuation{
+				WalletID:         subWalletId,
+				ParentWalletID:   wallet.WalletID,
+				TotalAmountInBTC: sub.SubTotalAmountInBTC,
+				TotalAmountInUSD: sub.SubTotalAmountInUSD,
+			})
+		}
+	}
+
+	links, err := c.listAllMirrorXLinks()
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		positions, err := c.listAllMirrorXPositions(link.MirrorXLinkId, true)
+		if err != nil {
+			return nil, err
+		}
+		walletId, _ := strconv.ParseInt(link.WalletIdStr, 10, 64)
+		for _, position := range positions {
+			snapshot.Holdings = append(snapshot.Holdings, Holding{
+				Source:        HoldingSourceMirrorX,
+				WalletID:      walletId,
+				WalletName:    link.Label,
+				MirrorXLinkId: link.MirrorXLinkId.String(),
+				CoinSymbol:    position.CoinSymbol,
+				Amount:        position.MirrorXBalance,
+			})
+		}
+	}
+	return snapshot, nil
+}
+
+type SnapshotFormat string
+
+const (
+	SnapshotFormatCSV        SnapshotFormat = "csv"
+	SnapshotFormatJSONLines  SnapshotFormat = "jsonl"
+	SnapshotFormatColumnarGz SnapshotFormat = "col.gz"
+)
+
+// Export writes the snapshot into dir, named after the snapshot time, and returns the file path.
+// The csv format only contains holdings, use WriteValuationsCSV for valuations.
+func (s *PortfolioSnapshot) Export(dir string, format SnapshotFormat) (string, error) {
+	var write func(io.Writer) error
+	switch format {
+	case SnapshotFormatCSV:
+		write = s.WriteHoldingsCSV
+	case SnapshotFormatJSONLines:
+		write = s.WriteJSONLines
+	case SnapshotFormatColumnarGz:
+		write = s.WriteColumnar
+	default:
+		return "", fmt.Errorf("unknown snapshot format %q", format)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("portfolio-%s.%s", s.Time.UTC().Format("20060102T150405Z"), format))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+var holdingsCSVHeader = []string{"snapshotTime", "source", "walletId", "parentWalletId", "walletName", "mirrorXLinkId", "coinSymbol", "network", "amount", "availableAmount"}
+
+// WriteHoldingsCSV writes one row per holding with a header row
+func (s *PortfolioSnapshot) WriteHoldingsCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(holdingsCSVHeader)
+	if err != nil {
+		return err
+	}
+	snapshotTime := s.Time.UTC().Format(time.RFC3339)
+	for _, h := range s.Holdings {
+		err = writer.Write([]string{
+			snapshotTime,
+			h.Source,
+			strconv.FormatInt(h.WalletID, 10),
+			strconv.FormatInt(h.ParentWalletID, 10),
+			h.WalletName,
+			h.MirrorXLinkId,
+			h.CoinSymbol,
+			h.Network,
+			h.Amount,
+			h.AvailableAmount,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteValuationsCSV writes one row per wallet valuation with a header row
+func (s *PortfolioSnapshot) WriteValuationsCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"snapshotTime", "walletId", "parentWalletId", "totalAmountInBTC", "totalAmountInUSD"})
+	if err != nil {
+		return err
+	}
+	snapshotTime := s.Time.UTC().Format(time.RFC3339)
+	for _, v := range s.Valuations {
+		err = writer.Write([]string{
+			snapshotTime,
+			strconv.FormatInt(v.WalletID, 10),
+			strconv.FormatInt(v.ParentWalletID, 10),
+			v.TotalAmountInBTC,
+			v.TotalAmountInUSD,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// snapshotLine is a single json lines record, exactly one of the pointers is set
+type snapshotLine struct {
+	Type      string           `json:"type"`
+	Time      int64            `json:"time"` // unix timestamp in milliseconds
+	Holding   *Holding         `json:"holding,omitempty"`
+	Valuation *WalletValuation `json:"valuation,omitempty"`
+}
+
+// WriteJSONLines writes one json object per holding and valuation
+func (s *PortfolioSnapshot) WriteJSONLines(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	ms := s.Time.UnixMilli()
+	for i := range s.Holdings {
+		err := encoder.Encode(&snapshotLine{Type: "holding", Time: ms, Holding: &s.Holdings[i]})
+		if err != nil {
+			return err
+		}
+	}
+	for i := range s.Valuations {
+		err := encoder.Encode(&snapshotLine{Type: "valuation", Time: ms, Valuation: &s.Valuations[i]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSnapshotJSONLines reads a snapshot written by WriteJSONLines
+func ReadSnapshotJSONLines(r io.Reader) (*PortfolioSnapshot, error) {
+	snapshot := &PortfolioSnapshot{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := &snapshotLine{}
+		err := json.Unmarshal(scanner.Bytes(), line)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Time = time.UnixMilli(line.Time).UTC()
+		switch {
+		case line.Holding != nil:
+			snapshot.Holdings = append(snapshot.Holdings, *line.Holding)
+		case line.Valuation != nil:
+			snapshot.Valuations = append(snapshot.Valuations, *line.Valuation)
+		}
+	}
+	return snapshot, scanner.Err()
+}
+
+// columnarSnapshot stores every field as its own array, which compresses far better than rows
+type columnarSnapshot struct {
+	Version  int   `json:"version"`
+	Time     int64 `json:"time"`
+	Holdings struct {
+		Source          []string `json:"source"`
+		WalletID        []int64  `json:"walletId"`
+		ParentWalletID  []int64  `json:"parentWalletId"`
+		WalletName      []string `json:"walletName"`
+		MirrorXLinkId   []string `json:"mirrorXLinkId"`
+		CoinSymbol      []string `json:"coinSymbol"`
+		Network         []string `json:"network"`
+		Amount          []string `json:"amount"`
+		AvailableAmount []string `json:"availableAmount"`
+	} `json:"holdings"`
+	Valuations struct {
+		WalletID         []int64  `json:"walletId"`
+		ParentWalletID   []int64  `json:"parentWalletId"`
+		TotalAmountInBTC []string `json:"totalAmountInBTC"`
+		TotalAmountInUSD []string `json:"totalAmountInUSD"`
+	} `json:"valuations"`
+}
+
+// WriteColumnar writes the snapshot as gzip compressed columnar json
+func (s *PortfolioSnapshot) WriteColumnar(w io.Writer) error {
+	col := &columnarSnapshot{Version: 1, Time: s.Time.UnixMilli()}
+	for _, h := range s.Holdings {
+		col.Holdings.Source = append(col.Holdings.Source, h.Source)
+		col.Holdings.WalletID = append(col.Holdings.WalletID, h.WalletID)
+		col.Holdings.ParentWalletID = append(col.Holdings.ParentWalletID, h.ParentWalletID)
+		col.Holdings.WalletName = append(col.Holdings.WalletName, h.WalletName)
+		col.Holdings.MirrorXLinkId = append(col.Holdings.MirrorXLinkId, h.MirrorXLinkId)
+		col.Holdings.CoinSymbol = append(col.Holdings.CoinSymbol, h.CoinSymbol)
+		col.Holdings.Network = append(col.Holdings.Network, h.Network)
+		col.Holdings.Amount = append(col.Holdings.Amount, h.Amount)
+		col.Holdings.AvailableAmount = append(col.Holdings.AvailableAmount, h.AvailableAmount)
+	}
+	for _, v := range s.Valuations {
+		col.Valuations.WalletID = append(col.Valuations.WalletID, v.WalletID)
+		col.Valuations.ParentWalletID = append(col.Valuations.ParentWalletID, v.ParentWalletID)
+		col.Valuations.TotalAmountInBTC = append(col.Valuations.TotalAmountInBTC, v.TotalAmountInBTC)
+		col.Valuations.TotalAmountInUSD = append(col.Valuations.TotalAmountInUSD, v.TotalAmountInUSD)
+	}
+	zw := gzip.NewWriter(w)
+	err := json.NewEncoder(zw).Encode(col)
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadSnapshotColumnar reads a snapshot written by WriteColumnar
+func ReadSnapshotColumnar(r io.Reader) (*PortfolioSnapshot, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	col := &columnarSnapshot{}
+	err = json.NewDecoder(zr).Decode(col)
+	if err != nil {
+		return nil, err
+	}
+	if col.Version != 1 {
+		return nil, fmt.Errorf("unsupported columnar snapshot version %d", col.Version)
+	}
+	h := &col.Holdings
+	n := len(h.Source)
+	for _, length := range []int{len(h.WalletID), len(h.ParentWalletID), len(h.WalletName), len(h.MirrorXLinkId), len(h.CoinSymbol), len(h.Network), len(h.Amount), len(h.AvailableAmount)} {
+		if length != n {
+			return nil, errors.New("columnar snapshot holdings columns differ in length")
+		}
+	}
+	v := &col.Valuations
+	m := len(v.WalletID)
+	if len(v.ParentWalletID) != m || len(v.TotalAmountInBTC) != m || len(v.TotalAmountInUSD) != m {
+		return nil, errors.New("columnar snapshot valuations columns differ in length")
+	}
+	snapshot := &PortfolioSnapshot{Time: time.UnixMilli(col.Time).UTC()}
+	for i := 0; i < n; i++ {
+		snapshot.Holdings = append(snapshot.Holdings, Holding{
+			Source:          h.Source[i],
+			WalletID:        h.WalletID[i],
+			ParentWalletID:  h.ParentWalletID[i],
+			WalletName:      h.WalletName[i],
+			MirrorXLinkId:   h.MirrorXLinkId[i],
+			CoinSymbol:      h.CoinSymbol[i],
+			Network:         h.Network[i],
+			Amount:          h.Amount[i],
+			AvailableAmount: h.AvailableAmount[i],
+		})
+	}
+	for i := 0; i < m; i++ {
+		snapshot.Valuations = append(snapshot.Valuations, WalletValuation{
+			WalletID:         v.WalletID[i],
+			ParentWalletID:   v.ParentWalletID[i],
+			TotalAmountInBTC: v.TotalAmountInBTC[i],
+			TotalAmountInUSD: v.TotalAmountInUSD[i],
+		})
+	}
+	return snapshot, nil
+}
+
+// HoldingChange is the difference of one holding between two snapshots.
+// Old or New is nil if the holding only exists in one of them.
+type HoldingChange struct {
+	Old   *Holding
+	New   *Holding
+	Delta string // new amount minus old amount
+}
+
+// DiffSnapshots returns every holding whose amount changed between oldSnapshot and newSnapshot
+func DiffSnapshots(oldSnapshot *PortfolioSnapshot, newSnapshot *PortfolioSnapshot) ([]HoldingChange, error) {
+	changes := map[string]*HoldingChange{}
+	for i := range oldSnapshot.Holdings {
+		h := &oldSnapshot.Holdings[i]
+		changes[h.key()] = &HoldingChange{Old: h}
+	}
+	for i := range newSnapshot.Holdings {
+		h := &newSnapshot.Holdings[i]
+		if change, ok := changes[h.key()]; ok {
+			change.New = h
+		} else {
+			changes[h.key()] = &HoldingChange{New: h}
+		}
+	}
+	var result []HoldingChange
+	for _, change := range changes {
+		oldAmount, newAmount := new(big.Rat), new(big.Rat)
+		var err error
+		if change.Old != nil {
+			if oldAmount, err = parseAmount(change.Old.Amount); err != nil {
+				return nil, err
+			}
+		}
+		if change.New != nil {
+			if newAmount, err = parseAmount(change.New.Amount); err != nil {
+				return nil, err
+			}
+		}
+		delta := new(big.Rat).Sub(newAmount, oldAmount)
+		if delta.Sign() == 0 && change.Old != nil && change.New != nil {
+			continue
+		}
+		change.Delta = formatAmount(delta)
+		result = append(result, *change)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return changeKey(&result[i]) < changeKey(&result[j])
+	})
+	return result, nil
+}
+
+func changeKey(change *HoldingChange) string {
+	if change.New != nil {
+		return change.New.key()
+	}
+	return change.Old.key()
+}
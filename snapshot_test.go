@@ -0,0 +1,67 @@
+package ceffu
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPortfolioSnapshotExport(t *testing.T) {
+	cl := newRouteClient(t, map[string]string{
+		"/open-api/v1/wallet/list":                `{"code":"000000","data":{"data":[{"walletId":1,"walletName":"prime","walletType":20}],"totalPage":1}}`,
+		"/open-api/v1/wallet/asset/list":          `{"code":"000000","data":{"data":[{"coinSymbol":"USDT","network":"ETH","amount":"60","availableAmount":"60"}],"totalPage":1}}`,
+		"/open-api/v1/wallet/asset/summary":       `{"code":"000000","data":{"walletIdStr":"1","totalAmountInBTC":"0.001","totalAmountInUSD":"65"}}`,
+		"/open-api/v1/subwallet/list":             `{"code":"000000","data":{"data":[2],"totalPage":1}}`,
+		"/open-api/v1/subwallet/asset/details":    `{"code":"000000","data":{"data":[{"coinSymbol":"USDT","network":null,"amount":"5"}],"totalPage":1}}`,
+		"/open-api/v1/subwallet/asset/summary":    `{"code":"000000","data":{"data":[{"walletIdStr":"2","subTotalAmountInBTC":"0","subTotalAmountInUSD":"5"}]}}`,
+		"/open-api/v1/mirrorX/mirrorXLinkId/list": `{"code":"000000","data":{"data":[{"mirrorXLinkId":"11","walletIdStr":"1","label":"binance"}],"totalPage":1}}`,
+		"/open-api/v1/mirrorX/positions/list":     `{"code":"000000","data":{"data":[{"mirrorXLinkId":"11","coinSymbol":"BTC","mirrorXBalance":"0.5"}],"totalPage":1}}`,
+	})
+	snapshot, err := cl.TakePortfolioSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Holdings) != 3 || len(snapshot.Valuations) != 2 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	var buf bytes.Buffer
+	if err = snapshot.WriteColumnar(&buf); err != nil {
+		t.Fatal(err)
+	}
+	columnar, err := ReadSnapshotColumnar(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err = snapshot.WriteJSONLines(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := ReadSnapshotJSONLines(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(columnar, lines) || !reflect.DeepEqual(columnar.Holdings, snapshot.Holdings) {
+		t.Fatalf("round trip mismatch:\n%+v\n%+v", columnar, lines)
+	}
+
+	next := *lines
+	next.Holdings = append([]Holding{}, lines.Holdings...)
+	next.Holdings[0].Amount = "70"
+	next.Holdings = next.Holdings[:2]
+	changes, err := DiffSnapshots(lines, &next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	for _, change := range changes {
+		switch {
+		case change.New == nil && change.Delta != "-0.5":
+			t.Fatalf("unexpected removed holding %+v", change)
+		case change.New != nil && change.Delta != "10":
+			t.Fatalf("unexpected changed holding %+v", change)
+		}
+	}
+}
@@ -1,115 +1,99 @@
 package ceffu
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 )
 
-type GetSubWalletAssetDetailsResp struct {
-	Data struct {
-		Data []struct {
-			CoinSymbol      string      `json:"coinSymbol"`
-			Network         interface{} `json:"network"`
-			Amount          string      `json:"amount"`
-			AvailableAmount string      `json:"availableAmount"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+type SubWalletAssetBalance struct {
+	CoinSymbol      string      `json:"coinSymbol"`
+	Network         interface{} `json:"network"`
+	Amount          string      `json:"amount"`
+	AvailableAmount string      `json:"availableAmount"`
 }
 
-// GetSubWalletAssetDetails gets asset details of a sub wallet
-// coinSymbol: optional
-// network: optional
-// pageLimit: optional, default 25 max 25
-// pageNo: optional, default 1
-// walletId: required
-func (c *Client) GetSubWalletAssetDetails(walletId int64, coinSymbol string, network string, pageLimit int, pageNo int) (*GetSubWalletAssetDetailsResp, error) {
-	if pageLimit == 0 || pageLimit > 25 {
-		pageLimit = 25
-	}
-	if pageNo == 0 {
-		pageNo = 1
+type GetSubWalletAssetDetailsResp = Envelope[Page[SubWalletAssetBalance]]
+
+// SubWalletAssetDetailsQuery filters QuerySubWalletAssetDetails
+type SubWalletAssetDetailsQuery struct {
+	WalletID   WalletID // required
+	CoinSymbol string   // optional, all coins if empty
+	Network    string   // optional, all networks if empty
+	PageLimit  int      // optional, default 25, max 25
+	PageNo     int      // optional, default 1
+}
+
+func (q *SubWalletAssetDetailsQuery) Validate() error {
+	if q.WalletID == "" {
+		return errors.New("walletId is required")
 	}
-	params := map[string]string{
-		"walletId":  strconv.FormatInt(walletId, 10),
-		"pageLimit": strconv.Itoa(pageLimit),
-		"pageNo":    strconv.Itoa(pageNo),
+	return validatePaging(q.PageLimit, q.PageNo)
+}
+
+// QuerySubWalletAssetDetails gets asset details of a sub wallet
+func (c *Client) QuerySubWalletAssetDetails(query *SubWalletAssetDetailsQuery) (*GetSubWalletAssetDetailsResp, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
 	}
-	if coinSymbol != "" {
-		params["coinSymbol"] = coinSymbol
+	params := c.pageParams(query.PageLimit, query.PageNo)
+	params["walletId"] = query.WalletID.String()
+	if query.CoinSymbol != "" {
+		params["coinSymbol"] = query.CoinSymbol
 	}
-	if network != "" {
-		params["network"] = network
+	if query.Network != "" {
+		params["network"] = query.Network
 	}
-
 	get, err := c.get("subwallet/asset/details", params)
 	if err != nil {
 		return nil, err
 	}
-	response := &GetSubWalletAssetDetailsResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return decodeEnvelope[Page[SubWalletAssetBalance]](get)
 }
 
-type GetSubWalletSummaryResp struct {
-	Data struct {
-		WalletIDStr      string `json:"walletIdStr"`
-		TotalAmountInBTC string `json:"totalAmountInBTC"`
-		TotalAmountInUSD string `json:"totalAmountInUSD"`
-		Data             []struct {
-			WalletIDStr         string `json:"walletIdStr"`
-			SubTotalAmountInBTC string `json:"subTotalAmountInBTC"`
-			SubTotalAmountInUSD string `json:"subTotalAmountInUSD"`
-		} `json:"data"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+// GetSubWalletAssetDetails gets asset details of a sub wallet, see QuerySubWalletAssetDetails
+// coinSymbol: optional
+// network: optional
+// pageLimit: optional, default 25 max 25
+// pageNo: optional, default 1
+// walletId: required
+func (c *Client) GetSubWalletAssetDetails(walletId WalletID, coinSymbol string, network string, pageLimit int, pageNo int) (*GetSubWalletAssetDetailsResp, error) {
+	return c.QuerySubWalletAssetDetails(&SubWalletAssetDetailsQuery{
+		WalletID:   walletId,
+		CoinSymbol: coinSymbol,
+		Network:    network,
+		PageLimit:  pageLimit,
+		PageNo:     pageNo,
+	})
 }
 
+type GetSubWalletSummaryResp = Envelope[AssetSummary]
+
 // GetSubWalletSummary return asset summary for subaccounts in certain prime/qualified account
 // walletIdStr: prime or qualified account id
-func (c *Client) GetSubWalletSummary(walletIdStr string) (*GetSubWalletSummaryResp, error) {
+func (c *Client) GetSubWalletSummary(walletIdStr WalletID) (*GetSubWalletSummaryResp, error) {
 	params := map[string]string{
-		"walletIdStr": walletIdStr,
+		"walletIdStr": walletIdStr.String(),
 	}
 
 	get, err := c.get("subwallet/asset/summary", params)
 	if err != nil {
 		return nil, err
 	}
-	response := &GetSubWalletSummaryResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return decodeEnvelope[AssetSummary](get)
 
 }
 
-type GetSubWalletDepositAddressResp struct {
-	Data struct {
-		WalletAddress string `json:"walletAddress"`
-		Memo          string `json:"memo"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
+type GetSubWalletDepositAddressResp = Envelope[DepositAddress]
 
 // GetSubWalletDepositAddress gets deposit address for a sub wallet
 // coinSymbol: required for prime, not required for qualified
 // network: required
 // walletId: required, sub wallet id
-func (c *Client) GetSubWalletDepositAddress(walletId int64, coinSymbol string, network string) (*GetSubWalletDepositAddressResp, error) {
+func (c *Client) GetSubWalletDepositAddress(walletId WalletID, coinSymbol string, network string) (*GetSubWalletDepositAddressResp, error) {
 	params := map[string]string{
-		"walletId": strconv.FormatInt(walletId, 10),
+		"walletId": walletId.String(),
 		"network":  network,
 	}
 	if coinSymbol != "" {
@@ -120,41 +104,71 @@ func (c *Client) GetSubWalletDepositAddress(walletId int64, coinSymbol string, n
 	if err != nil {
 		return nil, err
 	}
-	response := &GetSubWalletDepositAddressResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
+	return decodeEnvelope[DepositAddress](get)
+}
+
+type SubWalletDepositHistoryRecord struct {
+	Direction           int          `json:"direction"`
+	Network             string       `json:"network"`
+	Memo                interface{}  `json:"memo"` // String or null
+	CoinSymbol          string       `json:"coinSymbol"`
+	Amount              string       `json:"amount"`
+	FeeSymbol           string       `json:"feeSymbol"`
+	FeeAmount           string       `json:"feeAmount"`
+	WalletID            int64        `json:"walletId"`
+	FromAddress         string       `json:"fromAddress"`
+	ToAddress           string       `json:"toAddress"`
+	OrderViewID         string       `json:"orderViewId"`
+	TransferType        TransferType `json:"transferType"`
+	Status              int          `json:"status"`
+	TxID                string       `json:"txId"`
+	TxTime              int64        `json:"txTime"`
+	ConfirmedBlockCount int          `json:"confirmedBlockCount"`
+	MaxConfirmedBlock   interface{}  `json:"maxConfirmedBlock"` // int or null
+	UnlockConfirm       interface{}  `json:"unlockConfirm"`     // int or null
+}
+
+type GetSubWalletDepositHistoryResp = Envelope[Page[SubWalletDepositHistoryRecord]]
+
+// SubWalletDepositHistoryQuery filters QuerySubWalletDepositHistory
+type SubWalletDepositHistoryQuery struct {
+	WalletID   WalletID  // required, sub wallet id
+	CoinSymbol string    // optional, all coins if empty
+	Network    string    // optional, all networks if empty
+	StartTime  time.Time // required
+	EndTime    time.Time // optional, default now
+	PageLimit  int       // optional, default 25, max 25
+	PageNo     int       // optional, default 1
+}
+
+func (q *SubWalletDepositHistoryQuery) Validate() error {
+	if q.WalletID == "" {
+		return errors.New("walletId is required")
 	}
-	return response, nil
+	return validateHistory(q.StartTime, q.EndTime, q.PageLimit, q.PageNo)
 }
 
-type GetSubWalletDepositHistoryResp struct {
-	Data []struct {
-		Direction           int     `json:"direction"`
-		Network             string  `json:"network"`
-		Memo                int     `json:"memo"`
-		CoinSymbol          string  `json:"coinSymbol"`
-		Amount              float64 `json:"amount"`
-		FeeSymbol           string  `json:"feeSymbol"`
-		FeeAmount           float64 `json:"feeAmount"`
-		WalletID            int64   `json:"walletId"`
-		FromAddress         string  `json:"fromAddress"`
-		ToAddress           string  `json:"toAddress"`
-		OrderViewID         int64   `json:"orderViewId"`
-		TransferType        int     `json:"transferType"`
-		Status              int     `json:"status"`
-		TxID                string  `json:"txId"`
-		TxTime              int64   `json:"txTime"`
-		ConfirmedBlockCount int     `json:"confirmedBlockCount"`
-		MaxConfirmedBlock   string  `json:"maxConfirmedBlock"`
-		UnlockConfirm       string  `json:"unlockConfirm"`
-	} `json:"data"`
-	PageLimit int `json:"pageLimit"`
-	PageNo    int `json:"pageNo"`
-	TotalPage int `json:"totalPage"`
+// QuerySubWalletDepositHistory gets deposit history for a sub wallet, v2 api
+func (c *Client) QuerySubWalletDepositHistory(query *SubWalletDepositHistoryQuery) (*GetSubWalletDepositHistoryResp, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	params := c.historyParams(query.StartTime, query.EndTime, query.PageLimit, query.PageNo)
+	params["walletId"] = query.WalletID.String()
+	if query.CoinSymbol != "" {
+		params["coinSymbol"] = query.CoinSymbol
+	}
+	if query.Network != "" {
+		params["network"] = query.Network
+	}
+	get, err := c.get("subwallet/deposit/history", params)
+	if err != nil {
+		return nil, err
+	}
+	return decodeEnvelope[Page[SubWalletDepositHistoryRecord]](get)
 }
 
-// GetSubWalletDepositHistory gets deposit history for a sub wallet, v2 api
+// GetSubWalletDepositHistory gets deposit history for a sub wallet, see QuerySubWalletDepositHistory
 // walletId: sub wallet id
 // coinSymbol: optional
 // network: optional
@@ -162,211 +176,256 @@ type GetSubWalletDepositHistoryResp struct {
 // endTime: optional, unix timestamp in millisecond, default now
 // pageLimit: optional, default 25 max 25
 // pageNo: optional, default 1
-func (c *Client) GetSubWalletDepositHistory(walletId int64, coinSymbol string, network string, startTime int64, endTime int64, pageLimit int, pageNo int) (*GetSubWalletDepositHistoryResp, error) {
-	if pageLimit == 0 || pageLimit > 25 {
-		pageLimit = 25
-	}
-	if pageNo == 0 {
-		pageNo = 1
-	}
-	params := map[string]string{
-		"walletId":   strconv.FormatInt(walletId, 10),
-		"startTime":  strconv.FormatInt(startTime, 10),
-		"pageLimit":  strconv.Itoa(pageLimit),
-		"pageNo":     strconv.Itoa(pageNo),
-		"network":    network,
-		"coinSymbol": coinSymbol,
-	}
-	if endTime != 0 {
-		params["endTime"] = strconv.FormatInt(endTime, 10)
-	} else {
-		params["endTime"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
+func (c *Client) GetSubWalletDepositHistory(walletId WalletID, coinSymbol string, network string, startTime int64, endTime int64, pageLimit int, pageNo int) (*GetSubWalletDepositHistoryResp, error) {
+	return c.QuerySubWalletDepositHistory(&SubWalletDepositHistoryQuery{
+		WalletID:   walletId,
+		CoinSymbol: coinSymbol,
+		Network:    network,
+		StartTime:  millisTime(startTime),
+		EndTime:    millisTime(endTime),
+		PageLimit:  pageLimit,
+		PageNo:     pageNo,
+	})
+}
+
+type SubWalletDepositRecord struct {
+	OrderViewId         interface{} `json:"orderViewId"`
+	TxId                *string     `json:"txId"`
+	TransferType        int         `json:"transferType"`
+	Direction           int         `json:"direction"`
+	FromAddress         string      `json:"fromAddress"`
+	ToAddress           string      `json:"toAddress"`
+	Network             *string     `json:"network"`
+	CoinSymbol          string      `json:"coinSymbol"`
+	Amount              string      `json:"amount"`
+	FeeSymbol           interface{} `json:"feeSymbol"`
+	FeeAmount           string      `json:"feeAmount"`
+	Status              int         `json:"status"`
+	ConfirmedBlockCount interface{} `json:"confirmedBlockCount"`
+	UnlockConfirm       interface{} `json:"unlockConfirm"`
+	MaxConfirmBlock     interface{} `json:"maxConfirmBlock"`
+	Memo                interface{} `json:"memo"`
+	TxTime              int64       `json:"txTime"`
+	WalletIdStr         string      `json:"walletIdStr"`
+	RequestId           interface{} `json:"requestId"`
+}
+
+type GetAllSubWalletDepositHistoryResp = Envelope[Page[SubWalletDepositRecord]]
+
+// AllSubWalletDepositHistoryQuery filters QueryAllSubWalletDepositHistory
+type AllSubWalletDepositHistoryQuery struct {
+	ParentWalletID WalletID // required, prime or qualified account id
+	CoinSymbol     string   // optional, all coins if empty
+	Network        string   // optional, all networks if empty
+	PageLimit      int      // optional, default 25, max 25
+	PageNo         int      // optional, default 1
+}
+
+func (q *AllSubWalletDepositHistoryQuery) Validate() error {
+	if q.ParentWalletID == "" {
+		return errors.New("parentWalletId is required")
 	}
+	return validatePaging(q.PageLimit, q.PageNo)
+}
 
-	get, err := c.get("subwallet/deposit/history", params)
-	if err != nil {
+// QueryAllSubWalletDepositHistory gets deposit history for all sub wallets
+func (c *Client) QueryAllSubWalletDepositHistory(query *AllSubWalletDepositHistoryQuery) (*GetAllSubWalletDepositHistoryResp, error) {
+	if err := query.Validate(); err != nil {
 		return nil, err
 	}
-	response := &GetSubWalletDepositHistoryResp{}
-	err = json.Unmarshal(get, response)
+	params := c.pageParams(query.PageLimit, query.PageNo)
+	params["parentWalletId"] = query.ParentWalletID.String()
+	if query.CoinSymbol != "" {
+		params["coinSymbol"] = query.CoinSymbol
+	}
+	if query.Network != "" {
+		params["network"] = query.Network
+	}
+	get, err := c.getV2("subwallet/deposit/history", params)
 	if err != nil {
 		return nil, err
 	}
-	return response, nil
-}
-
-type GetAllSubWalletDepositHistoryResp struct {
-	Data struct {
-		Data []struct {
-			OrderViewId         interface{} `json:"orderViewId"`
-			TxId                *string     `json:"txId"`
-			TransferType        int         `json:"transferType"`
-			Direction           int         `json:"direction"`
-			FromAddress         string      `json:"fromAddress"`
-			ToAddress           string      `json:"toAddress"`
-			Network             *string     `json:"network"`
-			CoinSymbol          string      `json:"coinSymbol"`
-			Amount              string      `json:"amount"`
-			FeeSymbol           interface{} `json:"feeSymbol"`
-			FeeAmount           string      `json:"feeAmount"`
-			Status              int         `json:"status"`
-			ConfirmedBlockCount interface{} `json:"confirmedBlockCount"`
-			UnlockConfirm       interface{} `json:"unlockConfirm"`
-			MaxConfirmBlock     interface{} `json:"maxConfirmBlock"`
-			Memo                interface{} `json:"memo"`
-			TxTime              int64       `json:"txTime"`
-			WalletIdStr         string      `json:"walletIdStr"`
-			RequestId           interface{} `json:"requestId"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	return decodeEnvelope[Page[SubWalletDepositRecord]](get)
 }
 
-// GetAllSubWalletDepositHistory gets deposit history for all sub wallets
+// GetAllSubWalletDepositHistory gets deposit history for all sub wallets, see QueryAllSubWalletDepositHistory
 // parentWalletId required, prime or qualified account id
 // coinSymbol: optional
 // network: optional
 // pageLimit: optional, default 25 max 25
 // pageNo: optional, default 1
-func (c *Client) GetAllSubWalletDepositHistory(parentWalletId int64, coinSymbol string, network string, pageLimit int, pageNo int) (*GetAllSubWalletDepositHistoryResp, error) {
-	if pageLimit == 0 || pageLimit > 25 {
-		pageLimit = 25
-	}
-	if pageNo == 0 {
-		pageNo = 1
+func (c *Client) GetAllSubWalletDepositHistory(parentWalletId WalletID, coinSymbol string, network string, pageLimit int, pageNo int) (*GetAllSubWalletDepositHistoryResp, error) {
+	return c.QueryAllSubWalletDepositHistory(&AllSubWalletDepositHistoryQuery{
+		ParentWalletID: parentWalletId,
+		CoinSymbol:     coinSymbol,
+		Network:        network,
+		PageLimit:      pageLimit,
+		PageNo:         pageNo,
+	})
+}
+
+type SubWalletDepositAddress struct {
+	WalletAddress string `json:"walletAddress"`
+	Memo          string `json:"memo"`
+	WalletID      int64  `json:"walletId"`
+}
+
+type GetAllSubWalletDepositAddressResp = Envelope[Page[SubWalletDepositAddress]]
+
+// AllSubWalletDepositAddressQuery filters QueryAllSubWalletDepositAddress
+type AllSubWalletDepositAddressQuery struct {
+	ParentWalletID WalletID // required, prime account id
+	CoinSymbol     string   // required
+	Network        string   // required
+	PageLimit      int      // optional, default 25, max 25
+	PageNo         int      // optional, default 1
+}
+
+func (q *AllSubWalletDepositAddressQuery) Validate() error {
+	if q.ParentWalletID == "" {
+		return errors.New("parentWalletId is required")
 	}
-	params := map[string]string{
-		"parentWalletId": strconv.FormatInt(parentWalletId, 10),
-		"pageLimit":      strconv.Itoa(pageLimit),
-		"pageNo":         strconv.Itoa(pageNo),
-		"network":        network,
-		"coinSymbol":     coinSymbol,
+	if q.CoinSymbol == "" || q.Network == "" {
+		return errors.New("coinSymbol and network are required")
 	}
+	return validatePaging(q.PageLimit, q.PageNo)
+}
 
-	get, err := c.getV2("subwallet/deposit/history", params)
-	if err != nil {
+// QueryAllSubWalletDepositAddress get All sub wallet deposit address under the requested Parent Wallet ID (Prime), coinSymbol and network. (Only applicable to Parent Wallet Id(Prime))
+func (c *Client) QueryAllSubWalletDepositAddress(query *AllSubWalletDepositAddressQuery) (*GetAllSubWalletDepositAddressResp, error) {
+	if err := query.Validate(); err != nil {
 		return nil, err
 	}
-	response := &GetAllSubWalletDepositHistoryResp{}
-	err = json.Unmarshal(get, response)
+	params := c.pageParams(query.PageLimit, query.PageNo)
+	params["parentWalletId"] = query.ParentWalletID.String()
+	params["coinSymbol"] = query.CoinSymbol
+	params["network"] = query.Network
+	get, err := c.get("subwallet/deposit/address", params)
 	if err != nil {
 		return nil, err
 	}
-	return response, nil
-}
-
-type GetAllSubWalletDepositAddressResp struct {
-	Data struct {
-		Data []struct {
-			WalletAddress string `json:"walletAddress"`
-			Memo          string `json:"memo"`
-			WalletID      int64  `json:"walletId"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	return decodeEnvelope[Page[SubWalletDepositAddress]](get)
 }
 
-// GetAllSubWalletDepositAddress get All sub wallet deposit address under the requested Parent Wallet ID (Prime), coinSymbol and network. (Only applicable to Parent Wallet Id(Prime))
+// GetAllSubWalletDepositAddress get All sub wallet deposit address, see QueryAllSubWalletDepositAddress
 // parentWalletId: prime account id
 // coinSymbol: required
 // network: required
 // pageLimit: optional, default 25 max 25
 // pageNo: optional, default 1
-func (c *Client) GetAllSubWalletDepositAddress(parentWalletId int64, coinSymbol string, network string, pageLimit int, pageNo int) (*GetAllSubWalletDepositAddressResp, error) {
-	if pageLimit == 0 || pageLimit > 25 {
-		pageLimit = 25
-	}
-	if pageNo == 0 {
-		pageNo = 1
-	}
-	params := map[string]string{
-		"parentWalletId": strconv.FormatInt(parentWalletId, 10),
-		"pageLimit":      strconv.Itoa(pageLimit),
-		"pageNo":         strconv.Itoa(pageNo),
-		"network":        network,
-		"coinSymbol":     coinSymbol,
+func (c *Client) GetAllSubWalletDepositAddress(parentWalletId WalletID, coinSymbol string, network string, pageLimit int, pageNo int) (*GetAllSubWalletDepositAddressResp, error) {
+	return c.QueryAllSubWalletDepositAddress(&AllSubWalletDepositAddressQuery{
+		ParentWalletID: parentWalletId,
+		CoinSymbol:     coinSymbol,
+		Network:        network,
+		PageLimit:      pageLimit,
+		PageNo:         pageNo,
+	})
+}
+
+type GetAllSubWalletResp = Envelope[Page[int64]]
+
+// SubWalletListQuery pages QueryAllSubWallet
+type SubWalletListQuery struct {
+	ParentWalletID WalletID // required, prime account id
+	PageLimit      int      // optional, default 25, max 25
+	PageNo         int      // optional, default 1
+}
+
+func (q *SubWalletListQuery) Validate() error {
+	if q.ParentWalletID == "" {
+		return errors.New("parentWalletId is required")
 	}
+	return validatePaging(q.PageLimit, q.PageNo)
+}
 
-	get, err := c.get("subwallet/deposit/address", params)
-	if err != nil {
+// QueryAllSubWallet gets all sub wallets under a prime account
+func (c *Client) QueryAllSubWallet(query *SubWalletListQuery) (*GetAllSubWalletResp, error) {
+	if err := query.Validate(); err != nil {
 		return nil, err
 	}
-	response := &GetAllSubWalletDepositAddressResp{}
-	err = json.Unmarshal(get, response)
+	params := c.pageParams(query.PageLimit, query.PageNo)
+	params["parentWalletId"] = query.ParentWalletID.String()
+	get, err := c.get("subwallet/list", params)
 	if err != nil {
 		return nil, err
 	}
-	return response, nil
+	return decodeEnvelope[Page[int64]](get)
 }
 
-type GetAllSubWalletResp struct {
-	Data struct {
-		Data      []int64 `json:"data"`
-		TotalPage int     `json:"totalPage"`
-		PageNo    int     `json:"pageNo"`
-		PageLimit int     `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
-
-// GetAllSubWallet gets all sub wallets under a prime account
+// GetAllSubWallet gets all sub wallets under a prime account, see QueryAllSubWallet
 // parentWalletId: prime account id
 // pageLimit: optional, default 25 max 25
 // pageNo: optional, default 1
-func (c *Client) GetAllSubWallet(parentWalletId int64, pageLimit int, pageNo int) (*GetAllSubWalletResp, error) {
-	if pageLimit == 0 || pageLimit > 25 {
-		pageLimit = 25
+func (c *Client) GetAllSubWallet(parentWalletId WalletID, pageLimit int, pageNo int) (*GetAllSubWalletResp, error) {
+	return c.QueryAllSubWallet(&SubWalletListQuery{ParentWalletID: parentWalletId, PageLimit: pageLimit, PageNo: pageNo})
+}
+
+type SubWalletTransferRecord struct {
+	OrderViewId  string `json:"orderViewId"`
+	Direction    int    `json:"direction"`
+	FromWalletId int64  `json:"fromWalletId"`
+	ToWalletId   int64  `json:"toWalletId"`
+	CoinSymbol   string `json:"coinSymbol"`
+	Amount       string `json:"amount"`
+	Status       int    `json:"status"`
+}
+
+type GetSubWalletTransferHistoryResp = Envelope[Page[SubWalletTransferRecord]]
+
+// SubWalletTransferHistoryQuery filters QueryTransferHistory
+type SubWalletTransferHistoryQuery struct {
+	WalletID   WalletID                // required, prime wallet id
+	CoinSymbol string                  // optional, all coins if empty
+	Direction  SubWalletTransferType   // optional, SubWalletNotFiltered by default
+	Status     SubWalletTransferStatus // optional, SubWalletTransferStatusAll by default
+	StartTime  time.Time               // required
+	EndTime    time.Time               // optional, default now
+	PageLimit  int                     // optional, default 25, max 25
+	PageNo     int                     // optional, default 1
+}
+
+func (q *SubWalletTransferHistoryQuery) Validate() error {
+	if q.WalletID == "" {
+		return errors.New("walletId is required")
 	}
-	if pageNo == 0 {
-		pageNo = 1
+	switch q.Direction {
+	case SubWalletNotFiltered, SubWalletParentToSub, SubWalletSubToParent, SubWalletSubToSub:
+	default:
+		return fmt.Errorf("invalid direction %d", q.Direction)
 	}
-	params := map[string]string{
-		"parentWalletId": strconv.FormatInt(parentWalletId, 10),
-		"pageLimit":      strconv.Itoa(pageLimit),
-		"pageNo":         strconv.Itoa(pageNo),
+	switch q.Status {
+	case SubWalletTransferStatusAll, SubWalletTransferStatusPending, SubWalletTransferStatusProcessing, SubWalletTransferStatusSuccess, SubWalletTransferStatusFailed:
+	default:
+		return fmt.Errorf("invalid status %d", q.Status)
 	}
+	return validateHistory(q.StartTime, q.EndTime, q.PageLimit, q.PageNo)
+}
 
-	get, err := c.get("subwallet/list", params)
-	if err != nil {
+// QueryTransferHistory gets transfer history between sub wallet and prime wallet
+func (c *Client) QueryTransferHistory(query *SubWalletTransferHistoryQuery) (*GetSubWalletTransferHistoryResp, error) {
+	if err := query.Validate(); err != nil {
 		return nil, err
 	}
-	response := &GetAllSubWalletResp{}
-	err = json.Unmarshal(get, response)
+	params := c.historyParams(query.StartTime, query.EndTime, query.PageLimit, query.PageNo)
+	params["walletId"] = query.WalletID.String()
+	if query.CoinSymbol != "" {
+		params["coinSymbol"] = query.CoinSymbol
+	}
+	if query.Direction != SubWalletNotFiltered {
+		params["direction"] = strconv.Itoa(int(query.Direction))
+	}
+	if query.Status != SubWalletTransferStatusAll {
+		params["status"] = strconv.Itoa(int(query.Status))
+	}
+	get, err := c.get("subwallet/transfer/history", params)
 	if err != nil {
 		return nil, err
 	}
-	return response, nil
-}
-
-type GetSubWalletTransferHistoryResp struct {
-	Data struct {
-		Data []struct {
-			OrderViewId  string `json:"orderViewId"`
-			Direction    int    `json:"direction"`
-			FromWalletId int64  `json:"fromWalletId"`
-			ToWalletId   int64  `json:"toWalletId"`
-			CoinSymbol   string `json:"coinSymbol"`
-			Amount       string `json:"amount"`
-			Status       int    `json:"status"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	return decodeEnvelope[Page[SubWalletTransferRecord]](get)
 }
 
-// GetTransferHistory gets transfer history between sub wallet and prime wallet
+// GetTransferHistory gets transfer history between sub wallet and prime wallet, see QueryTransferHistory
 // walletId: required, prime wallet id
 // coinSymbol: optional, to filter txs.
 // direction: optional, transfer direction
@@ -375,43 +434,15 @@ type GetSubWalletTransferHistoryResp struct {
 // endTime: optional, unix timestamp in millisecond, default now
 // pageLimit: default 25 max 25
 // pageNo: default 1
-func (c *Client) GetTransferHistory(walletId int64, coinSymbol string, direction SubWalletTransferType, status SubWalletTransferStatus, startTime int64, endTime int64, pageLimit int, pageNo int) (*GetSubWalletTransferHistoryResp, error) {
-	params := map[string]string{
-		"walletId":  strconv.FormatInt(walletId, 10),
-		"startTime": strconv.FormatInt(startTime, 10),
-	}
-	// optional params
-	if coinSymbol != "" {
-		params["coinSymbol"] = coinSymbol
-	}
-	if direction != 0 {
-		params["direction"] = strconv.Itoa(int(direction))
-	}
-	if status != 0 {
-		params["status"] = strconv.Itoa(int(status))
-	}
-	if endTime != 0 {
-		params["endTime"] = strconv.FormatInt(endTime, 10)
-	} else {
-		params["endTime"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
-	}
-	if pageLimit == 0 || pageLimit > 25 {
-		pageLimit = 25
-	}
-	params["pageLimit"] = strconv.FormatInt(int64(pageLimit), 10)
-	if pageNo == 0 {
-		pageNo = 1
-	}
-	params["pageNo"] = strconv.FormatInt(int64(pageNo), 10)
-	// request
-	get, err := c.get("subwallet/transfer/history", params)
-	if err != nil {
-		return nil, err
-	}
-	response := &GetSubWalletTransferHistoryResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+func (c *Client) GetTransferHistory(walletId WalletID, coinSymbol string, direction SubWalletTransferType, status SubWalletTransferStatus, startTime int64, endTime int64, pageLimit int, pageNo int) (*GetSubWalletTransferHistoryResp, error) {
+	return c.QueryTransferHistory(&SubWalletTransferHistoryQuery{
+		WalletID:   walletId,
+		CoinSymbol: coinSymbol,
+		Direction:  direction,
+		Status:     status,
+		StartTime:  millisTime(startTime),
+		EndTime:    millisTime(endTime),
+		PageLimit:  pageLimit,
+		PageNo:     pageNo,
+	})
 }
@@ -1,28 +1,34 @@
 package ceffu
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+)
 
-type CreateSubWalletResp struct {
-	Data struct {
-		WalletID       int64  `json:"walletId"`
-		WalletName     string `json:"walletName"`
-		WalletType     int    `json:"walletType"`
-		ParentWalletID int64  `json:"parentWalletId"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+// decimalAmount matches amounts that are valid JSON numbers without exponent
+var decimalAmount = regexp.MustCompile(`^(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+type SubWalletResult struct {
+	WalletID       int64  `json:"walletId"`
+	WalletName     string `json:"walletName"`
+	WalletType     int    `json:"walletType"`
+	ParentWalletID int64  `json:"parentWalletId"`
 }
 
+type CreateSubWalletResp = Envelope[SubWalletResult]
+
 // CreateSubWallet creates a sub wallet for certain organization
 // parentWalletId: required
 // walletName: required, max 20 char
 // autoCollection: optional, default false(0)
 // requestId: optional, default random
-func (c *Client) CreateSubWallet(parentWalletId int64, walletName string, autoCollection bool, requestId ...int64) (*CreateSubWalletResp, error) {
+func (c *Client) CreateSubWallet(parentWalletId WalletID, walletName string, autoCollection bool, requestId ...int64) (*CreateSubWalletResp, error) {
 	params := map[string]interface{}{
 		"parentWalletId": parentWalletId,
 		"walletName":     walletName,
-		"autoCollection": false,
+		"autoCollection": autoCollection,
 	}
 	if len(requestId) > 0 {
 		params["requestId"] = requestId[0]
@@ -34,15 +40,19 @@ func (c *Client) CreateSubWallet(parentWalletId int64, walletName string, autoCo
 	if err != nil {
 		return nil, err
 	}
-	response := &CreateSubWalletResp{}
-	err = json.Unmarshal(post, response)
-	if err != nil {
-		return nil, err
+	resp, err := decodeEnvelope[SubWalletResult](post)
+	if err == nil && resp.Code == CodeSuccess {
+		c.directory.put(WalletEntry{
+			WalletID:       resp.Data.WalletID,
+			Name:           resp.Data.WalletName,
+			Type:           resp.Data.WalletType,
+			ParentWalletID: resp.Data.ParentWalletID,
+		})
 	}
-	return response, nil
+	return resp, err
 }
 
-type UpdateSubWalletResp struct {
+type UpdatedSubWallet struct {
 	ParentWalletID int    `json:"parentWalletId"`
 	WalletID       int    `json:"walletId"`
 	WalletName     string `json:"walletName"`
@@ -50,12 +60,14 @@ type UpdateSubWalletResp struct {
 	AutoCollection int    `json:"autoCollection"`
 }
 
+type UpdateSubWalletResp = Envelope[UpdatedSubWallet]
+
 // UpdateSubWallet updates a sub wallet for certain organization
 // autoCollection: optional, default false(0)
 // walletId: required
 // walletName: optional, max 20 char
 // requestId: optional, default random
-func (c *Client) UpdateSubWallet(autoCollection bool, walletId int64, walletName string, requestId ...int64) (*UpdateSubWalletResp, error) {
+func (c *Client) UpdateSubWallet(autoCollection bool, walletId WalletID, walletName string, requestId ...int64) (*UpdateSubWalletResp, error) {
 	params := map[string]interface{}{
 		"walletId":       walletId,
 		"walletName":     walletName,
@@ -71,34 +83,46 @@ func (c *Client) UpdateSubWallet(autoCollection bool, walletId int64, walletName
 	if err != nil {
 		return nil, err
 	}
-	response := &UpdateSubWalletResp{}
-	err = json.Unmarshal(post, response)
-	if err != nil {
-		return nil, err
+	resp, err := decodeEnvelope[UpdatedSubWallet](post)
+	if err == nil && resp.Code == CodeSuccess {
+		c.directory.put(WalletEntry{
+			WalletID:       int64(resp.Data.WalletID),
+			Name:           resp.Data.WalletName,
+			Type:           resp.Data.WalletType,
+			ParentWalletID: int64(resp.Data.ParentWalletID),
+		})
 	}
-	return response, nil
+	return resp, err
 }
 
-type TransferWithSubWalletResp struct {
-	Data struct {
-		OrderViewID string `json:"orderViewId"`
-		Status      int    `json:"status"`
-		Direction   int    `json:"direction"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+type SubWalletTransferResult struct {
+	OrderViewID string `json:"orderViewId"`
+	Status      int    `json:"status"`
+	Direction   int    `json:"direction"`
 }
 
+type TransferWithSubWalletResp = Envelope[SubWalletTransferResult]
+
 // TransferWithSubWallet transfer assets between sub wallets and main wallet
 // coinSymbol: required
-// amount: required
+// amount: required, use TransferWithSubWalletAmount to send exact decimal amounts
 // fromWalletId: required
 // toWalletId: required
 // requestId: optional, default random
-func (c *Client) TransferWithSubWallet(coinSymbol string, amount float64, fromWalletId int64, toWalletId int64, requestId ...int64) (*TransferWithSubWalletResp, error) {
+func (c *Client) TransferWithSubWallet(coinSymbol string, amount float64, fromWalletId WalletID, toWalletId WalletID, requestId ...int64) (*TransferWithSubWalletResp, error) {
+	return c.TransferWithSubWalletAmount(coinSymbol, strconv.FormatFloat(amount, 'f', -1, 64), fromWalletId, toWalletId, requestId...)
+}
+
+// TransferWithSubWalletAmount is TransferWithSubWallet with a decimal string amount,
+// which is sent as JSON number without going through float64
+// amount: required, positive decimal string, example: "0.123456789"
+func (c *Client) TransferWithSubWalletAmount(coinSymbol string, amount string, fromWalletId WalletID, toWalletId WalletID, requestId ...int64) (*TransferWithSubWalletResp, error) {
+	if !decimalAmount.MatchString(amount) {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
 	params := map[string]interface{}{
 		"coinSymbol":   coinSymbol,
-		"amount":       amount,
+		"amount":       json.Number(amount),
 		"fromWalletId": fromWalletId,
 		"toWalletId":   toWalletId,
 	}
@@ -112,10 +136,5 @@ func (c *Client) TransferWithSubWallet(coinSymbol string, amount float64, fromWa
 	if err != nil {
 		return nil, err
 	}
-	response := &TransferWithSubWalletResp{}
-	err = json.Unmarshal(post, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return decodeEnvelope[SubWalletTransferResult](post)
 }
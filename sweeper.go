@@ -0,0 +1,326 @@
+package ceffu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SweepConfig configures a Sweeper
+type SweepConfig struct {
+	// ParentWalletID is the prime wallet whose sub wallets are swept and which receives the funds, required
+	ParentWalletID int64
+	// Thresholds maps coin symbols to decimal amounts, available balances above the threshold are swept.
+	// Coins without a threshold are never swept. Required.
+	Thresholds map[string]string
+	// Retain maps coin symbols to decimal amounts left in the sub wallet after sweeping, optional
+	Retain map[string]string
+	// Decimals is the number of decimals swept amounts are truncated to, default 8
+	Decimals int
+	// BatchSize is the number of transfers per batch, default 25
+	BatchSize int
+	// BatchInterval is the pause between batches, optional
+	BatchInterval time.Duration
+	// Concurrency is the number of transfers sent in parallel within a batch, default 1
+	Concurrency int
+	// DryRun only plans the transfers without sending them
+	DryRun bool
+	// Idempotency is optional, if set together with SweepID every transfer gets a stable requestId,
+	// so running the same sweep again after a crash does not transfer twice
+	Idempotency *IdempotencyManager
+	// SweepID identifies a sweep run, e.g. the date for a daily sweep. Required with Idempotency.
+	SweepID string
+}
+
+// SweepTransfer is a single planned or executed transfer from a sub wallet to its parent
+type SweepTransfer struct {
+	SubWalletID int64
+	CoinSymbol  string
+	Amount      string
+	RequestId   int64
+	OrderViewID string
+	Status      int
+	Skipped     bool // Transfer was sent by an earlier run with the same SweepID, OrderViewID and Status are its own
+	Err         error
+}
+
+type SweepReport struct {
+	DryRun     bool
+	Started    time.Time
+	Finished   time.Time
+	SubWallets int // number of sub wallets scanned
+	Transfers  []SweepTransfer
+	Failed     int
+	Totals     map[string]string // coin symbol to total amount swept by this run (or planned in dry run)
+}
+
+// Sweeper collects sub wallet balances above per coin thresholds back into the parent wallet
+type Sweeper struct {
+	client *Client
+	config SweepConfig
+}
+
+func NewSweeper(client *Client, config SweepConfig) (*Sweeper, error) {
+	if config.ParentWalletID == 0 {
+		return nil, errors.New("parent wallet id is required")
+	}
+	if len(config.Thresholds) == 0 {
+		return nil, errors.New("at least one threshold is required")
+	}
+	for coin, threshold := range config.Thresholds {
+		if _, err := parseAmount(threshold); err != nil {
+			return nil, fmt.Errorf("threshold for %s: %w", coin, err)
+		}
+	}
+	for coin, retain := range config.Retain {
+		if _, err := parseAmount(retain); err != nil {
+			return nil, fmt.Errorf("retain for %s: %w", coin, err)
+		}
+	}
+	if config.Idempotency != nil && config.SweepID == "" {
+		return nil, errors.New("sweep id is required when idempotency is enabled")
+	}
+	if config.Decimals <= 0 {
+		config.Decimals = 8
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 25
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	return &Sweeper{
+		client: client,
+		config: config,
+	}, nil
+}
+
+// Plan scans all sub wallets and returns the transfers a sweep would make
+func (s *Sweeper) Plan() ([]SweepTransfer, int, error) {
+	subWallets, err := s.client.listAllSubWallets(s.config.ParentWalletID)
+	if err != nil {
+		return nil, 0, err
+	}
+	var plan []SweepTransfer
+	for _, subWalletId := range subWallets {
+		assets, err := s.client.listAllSubWalletAssets(subWalletId)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Sum networks per coin
+		available := map[string]*big.Rat{}
+		for _, asset := range assets {
+			if _, ok := s.config.Thresholds[asset.CoinSymbol]; !ok {
+				continue
+			}
+			amount, err := parseAmount(asset.AvailableAmount)
+			if err != nil {
+				return nil, 0, err
+			}
+			if available[asset.CoinSymbol] == nil {
+				available[asset.CoinSymbol] = new(big.Rat)
+			}
+			available[asset.CoinSymbol].Add(available[asset.CoinSymbol], amount)
+		}
+		for coin, amount := range available {
+			threshold, _ := parseAmount(s.config.Thresholds[coin])
+			if amount.Cmp(threshold) <= 0 {
+				continue
+			}
+			retain, _ := parseAmount(s.config.Retain[coin])
+			sweep := truncateAmount(new(big.Rat).Sub(amount, retain), s.config.Decimals)
+			if sweep.Sign() <= 0 {
+				continue
+			}
+			plan = append(plan, SweepTransfer{
+				SubWalletID: subWalletId,
+				CoinSymbol:  coin,
+				Amount:      formatAmount(sweep),
+			})
+		}
+	}
+	sort.Slice(plan, func(i, j int) bool {
+		if plan[i].SubWalletID != plan[j].SubWalletID {
+			return plan[i].SubWalletID < plan[j].SubWalletID
+		}
+		return plan[i].CoinSymbol < plan[j].CoinSymbol
+	})
+	return plan, len(subWallets), nil
+}
+
+// Run plans a sweep and executes it, unless DryRun is set.
+// Failed transfers are reported in the result instead of aborting the sweep.
+func (s *Sweeper) Run() (*SweepReport, error) {
+	report := &SweepReport{
+		DryRun:  s.config.DryRun,
+		Started: time.Now(),
+	}
+	plan, scanned, err := s.Plan()
+	if err != nil {
+		return nil, err
+	}
+	report.SubWallets = scanned
+	if !s.config.DryRun {
+		for start := 0; start < len(plan); start += s.config.BatchSize {
+			if start > 0 && s.config.BatchInterval > 0 {
+				time.Sleep(s.config.BatchInterval)
+			}
+			end := start + s.config.BatchSize
+			if end > len(plan) {
+				end = len(plan)
+			}
+			s.runBatch(plan[start:end])
+		}
+	}
+	totals := map[string]*big.Rat{}
+	for _, transfer := range plan {
+		if transfer.Err != nil {
+			report.Failed++
+			continue
+		}
+		if transfer.Skipped {
+			// Counted by the run that executed it
+			continue
+		}
+		amount, _ := parseAmount(transfer.Amount)
+		if totals[transfer.CoinSymbol] == nil {
+			totals[transfer.CoinSymbol] = new(big.Rat)
+		}
+		totals[transfer.CoinSymbol].Add(totals[transfer.CoinSymbol], amount)
+	}
+	report.Totals = map[string]string{}
+	for coin, total := range totals {
+		report.Totals[coin] = formatAmount(total)
+	}
+	report.Transfers = plan
+	report.Finished = time.Now()
+	return report, nil
+}
+
+func (s *Sweeper) runBatch(batch []SweepTransfer) {
+	work := make(chan *SweepTransfer)
+	var wg sync.WaitGroup
+	for i := 0; i < s.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for transfer := range work {
+				s.execute(transfer)
+			}
+		}()
+	}
+	for i := range batch {
+		work <- &batch[i]
+	}
+	close(work)
+	wg.Wait()
+}
+
+func (s *Sweeper) execute(transfer *SweepTransfer) {
+	var key string
+	var record *IdempotencyRecord
+	since := time.Now().Add(-idempotencyLookback)
+	if s.config.Idempotency != nil {
+		key = fmt.Sprintf("sweep/%s/%d/%s", s.config.SweepID, transfer.SubWalletID, transfer.CoinSymbol)
+		record, transfer.Err = s.config.Idempotency.record(key)
+		if transfer.Err != nil {
+			return
+		}
+		transfer.RequestId = record.RequestId
+		since = record.since()
+		if record.Completed {
+			// Sent by an earlier run, report the transfer it made
+			resp := &TransferWithSubWalletResp{}
+			if transfer.Err = json.Unmarshal(record.Result, resp); transfer.Err != nil {
+				return
+			}
+			transfer.Skipped = true
+			transfer.OrderViewID = resp.Data.OrderViewID
+			transfer.Status = resp.Data.Status
+			return
+		}
+	} else {
+		transfer.RequestId = GetReqId()
+	}
+	resp, err := s.client.TransferWithSubWalletAmount(transfer.CoinSymbol, transfer.Amount, NewWalletID(transfer.SubWalletID), NewWalletID(s.config.ParentWalletID), transfer.RequestId)
+	if err != nil {
+		transfer.Err = err
+		return
+	}
+	if resp.Code == ErrorDuplicateReqID {
+		// The response of an earlier attempt was lost, look its transfer up
+		original, err := s.findTransfer(transfer, since)
+		if err != nil {
+			transfer.Err = err
+			return
+		}
+		transfer.Skipped = true
+		transfer.OrderViewID = original.OrderViewId
+		transfer.Status = original.Status
+		if original.Status == int(SubWalletTransferStatusFailed) {
+			transfer.Err = fmt.Errorf("transfer %s of an earlier run failed", original.OrderViewId)
+			return
+		}
+		resp.Code = CodeSuccess
+		resp.Data = SubWalletTransferResult{OrderViewID: original.OrderViewId, Status: original.Status, Direction: original.Direction}
+	} else {
+		transfer.Err = checkCode(resp.Code, resp.Message)
+		transfer.OrderViewID = resp.Data.OrderViewID
+		transfer.Status = resp.Data.Status
+	}
+	if record != nil && transfer.Err == nil {
+		transfer.Err = s.config.Idempotency.complete(key, record, resp)
+	}
+}
+
+// findTransfer searches the transfers from the sub wallet to the parent wallet made since start for
+// the one sent for transfer by an earlier attempt. Ceffu does not list request ids, so it has to be the
+// only transfer of the coin and amount, otherwise an error is returned.
+func (s *Sweeper) findTransfer(transfer *SweepTransfer, start time.Time) (*SubWalletTransferRecord, error) {
+	var found []SubWalletTransferRecord
+	err := forEachPage(func(pageNo int) (int, error) {
+		resp, err := s.client.QueryTransferHistory(&SubWalletTransferHistoryQuery{
+			WalletID:   NewWalletID(s.config.ParentWalletID),
+			CoinSymbol: transfer.CoinSymbol,
+			Direction:  SubWalletSubToParent,
+			StartTime:  start,
+			PageNo:     pageNo,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if err = checkCode(resp.Code, resp.Message); err != nil {
+			return 0, err
+		}
+		for _, record := range resp.Data.Data {
+			if record.FromWalletId == transfer.SubWalletID && record.ToWalletId == s.config.ParentWalletID &&
+				record.CoinSymbol == transfer.CoinSymbol && sameAmount(record.Amount, transfer.Amount) {
+				found = append(found, record)
+			}
+		}
+		return resp.Data.TotalPage, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 1:
+		return &found[0], nil
+	case 0:
+		return nil, fmt.Errorf("transfer with requestId %d was sent earlier but is not in the transfer history", transfer.RequestId)
+	default:
+		return nil, fmt.Errorf("transfer with requestId %d was sent earlier, %d transfers of the same amount match it", transfer.RequestId, len(found))
+	}
+}
+
+// truncateAmount rounds r towards zero to the given number of decimals
+func truncateAmount(r *big.Rat, decimals int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	scaled := new(big.Int).Mul(r.Num(), scale)
+	scaled.Quo(scaled, r.Denom())
+	return new(big.Rat).SetFrac(scaled, scale)
+}
@@ -0,0 +1,136 @@
+package ceffu
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSweeper(t *testing.T) {
+	var mu sync.Mutex
+	var transfers []map[string]interface{}
+	duplicate := false
+	history := `[]`
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/open-api/v1/subwallet/transfer/history":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":` + history + `,"totalPage":1}}`))
+		case "/open-api/v1/subwallet/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[2,3],"totalPage":1}}`))
+		case "/open-api/v1/subwallet/asset/details":
+			if r.URL.Query().Get("walletId") == "2" {
+				_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"coinSymbol":"USDT","availableAmount":"150.123456789"},{"coinSymbol":"DOGE","availableAmount":"1000"}],"totalPage":1}}`))
+			} else {
+				_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"coinSymbol":"USDT","availableAmount":"50"}],"totalPage":1}}`))
+			}
+		case "/open-api/v1/subwallet/transfer":
+			body := map[string]interface{}{}
+			decoder := json.NewDecoder(r.Body)
+			decoder.UseNumber()
+			_ = decoder.Decode(&body)
+			mu.Lock()
+			transfers = append(transfers, body)
+			mu.Unlock()
+			if duplicate {
+				_, _ = w.Write([]byte(`{"code":"G20015","message":"duplicate request id"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"orderViewId":"o1","status":10}}`))
+		}
+	})
+	config := SweepConfig{
+		ParentWalletID: 1,
+		Thresholds:     map[string]string{"USDT": "100"},
+		Retain:         map[string]string{"USDT": "10"},
+		DryRun:         true,
+	}
+	sweeper, err := NewSweeper(cl, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := sweeper.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Transfers) != 1 || report.Totals["USDT"] != "140.12345678" || len(transfers) != 0 {
+		t.Fatalf("unexpected dry run %+v", report)
+	}
+
+	config.DryRun = false
+	config.Idempotency = NewIdempotencyManager(cl, NewMemoryIdempotencyStore())
+	config.SweepID = "2026-10-19"
+	sweeper, _ = NewSweeper(cl, config)
+	report, err = sweeper.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed != 0 || len(transfers) != 1 || report.Transfers[0].OrderViewID != "o1" {
+		t.Fatalf("unexpected sweep %+v", report)
+	}
+	sent := transfers[0]
+	if sent["fromWalletId"] != json.Number("2") || sent["toWalletId"] != json.Number("1") || sent["amount"] != json.Number("140.12345678") {
+		t.Fatalf("unexpected transfer %+v", sent)
+	}
+	requestId, _ := config.Idempotency.RequestId("sweep/2026-10-19/2/USDT")
+	if report.Transfers[0].RequestId != requestId {
+		t.Fatalf("transfer does not use idempotent request id")
+	}
+
+	// Running the same sweep again reports the transfer of the first run without sending it again
+	report, err = sweeper.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer := report.Transfers[0]; !transfer.Skipped || transfer.OrderViewID != "o1" || len(report.Totals) != 0 || report.Failed != 0 || len(transfers) != 1 {
+		t.Fatalf("unexpected repeated sweep %+v", report)
+	}
+
+	// The response of the first attempt was lost, the original transfer is looked up
+	duplicate = true
+	config.SweepID = "lost"
+	sweeper, _ = NewSweeper(cl, config)
+	history = `[{"orderViewId":"other","fromWalletId":3,"toWalletId":1,"coinSymbol":"USDT","amount":"140.12345678","status":30},
+		{"orderViewId":"o0","fromWalletId":2,"toWalletId":1,"coinSymbol":"USDT","amount":"140.12345678","status":99}]`
+	report, err = sweeper.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer := report.Transfers[0]; transfer.OrderViewID != "o0" || transfer.Err == nil || report.Failed != 1 {
+		t.Fatalf("failed original reported as swept: %+v", transfer)
+	}
+	history = strings.Replace(history, `"status":99`, `"status":30`, 1)
+	report, err = sweeper.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer := report.Transfers[0]; !transfer.Skipped || transfer.OrderViewID != "o0" || transfer.Err != nil || report.Failed != 0 || len(report.Totals) != 0 {
+		t.Fatalf("unexpected recovered transfer: %+v", transfer)
+	}
+	// Not found, the transfer is not assumed to be done
+	config.SweepID = "unknown"
+	sweeper, _ = NewSweeper(cl, config)
+	history = `[]`
+	if report, err = sweeper.Run(); err != nil || report.Failed != 1 || report.Transfers[0].Skipped {
+		t.Fatalf("unresolved duplicate not reported: %+v %v", report, err)
+	}
+}
+
+func TestTransferWithSubWalletAmount(t *testing.T) {
+	var raw string
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]json.RawMessage{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		raw = string(body["amount"])
+		_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+	})
+	if _, err := cl.TransferWithSubWalletAmount("BTC", "12345678901.123456789", "2", "1"); err != nil || raw != "12345678901.123456789" {
+		t.Fatalf("amount not sent exactly: %s %v", raw, err)
+	}
+	for _, amount := range []string{"1e5", "1/3", "-1", ".5", ""} {
+		if _, err := cl.TransferWithSubWalletAmount("BTC", amount, "2", "1"); err == nil {
+			t.Errorf("amount %q accepted", amount)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package ceffu
+
+import (
+	"context"
+	"strings"
+)
+
+// Span attribute keys set on every API call
+const (
+	AttrHTTPMethod = "http.method"
+	AttrHTTPStatus = "http.status_code"
+	AttrEndpoint   = "ceffu.endpoint"
+	AttrAPIVersion = "ceffu.api_version"
+	AttrWalletID   = "ceffu.wallet_id"
+	AttrRequestID  = "ceffu.request_id"
+	AttrCode       = "ceffu.code"
+	AttrRetryCount = "ceffu.retry_count"
+)
+
+// Span is a single traced API call, modelled after OpenTelemetry's trace.Span
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts spans, bridge it to OpenTelemetry by wrapping a trace.Tracer.
+// The returned context is used for the http request, so an instrumented http.Client
+// can propagate the span to Ceffu.
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// WithTracer traces every API call made by the client with tracer
+func WithTracer(tracer Tracer) Option {
+	return func(c *Client) {
+		c.tracer = tracer
+	}
+}
+
+// WithContext returns a shallow copy of the client whose calls use ctx, for cancellation and
+// as parent of their spans. The copy shares credentials, http client, audit log, metrics and
+// the wallet directory cache, wallets loaded to resolve names use ctx as well.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	copied := *c
+	copied.ctx = ctx
+	if c.directory != nil {
+		copied.directory = c.directory.withClient(&copied)
+	}
+	return &copied
+}
+
+// Context returns the context set by WithContext, context.Background() if none was set
+func (c *Client) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// walletIdParams are the request parameters holding wallet ids. The first one present is used for tracing.
+var walletIdParams = []string{"walletId", "walletIdStr", "fromWalletId", "parentWalletId", "toWalletId"}
+
+// apiVersion turns a version path like /open-api/v1/ into v1
+func apiVersion(versionPath string) string {
+	trimmed := strings.Trim(versionPath, "/")
+	return trimmed[strings.LastIndex(trimmed, "/")+1:]
+}
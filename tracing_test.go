@@ -0,0 +1,178 @@
+package ceffu
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type recordedSpan struct {
+	name       string
+	parent     interface{}
+	attributes map[string]interface{}
+	errs       []error
+	ended      bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *recordedSpan) RecordError(err error)                      { s.errs = append(s.errs, err) }
+func (s *recordedSpan) End()                                       { s.ended = true }
+
+type traceKey struct{}
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, spanName string) (context.Context, Span) {
+	span := &recordedSpan{name: spanName, parent: ctx.Value(traceKey{}), attributes: map[string]interface{}{}}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, traceKey{}, spanName), span
+}
+
+func TestTracing(t *testing.T) {
+	var propagated interface{}
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/open-api/v2/wallet/withdrawal" {
+			_, _ = w.Write([]byte(`{"code":"G20015","message":"duplicate request id"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+	})
+	tracer := &recordingTracer{}
+	WithTracer(tracer)(cl)
+	// Capture the context handed to the transport
+	transport := cl.http.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	cl.http = &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		propagated = r.Context().Value(traceKey{})
+		return transport.RoundTrip(r)
+	})}
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "caller")
+	_, err := cl.WithContext(ctx).GetAssetSummary("7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Withdrawal("1", "USDT", "", "ETH", "8", "0xabc", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(tracer.spans))
+	}
+	get := tracer.spans[0]
+	if get.name != "GET /open-api/v1/wallet/asset/summary" || get.parent != "caller" || !get.ended || propagated == nil {
+		t.Fatalf("unexpected span %+v", get)
+	}
+	if get.attributes[AttrWalletID] != "7" || get.attributes[AttrAPIVersion] != "v1" || get.attributes[AttrHTTPStatus] != 200 || get.attributes[AttrCode] != CodeSuccess {
+		t.Fatalf("unexpected attributes %v", get.attributes)
+	}
+	post := tracer.spans[1]
+	if post.attributes[AttrWalletID] != "8" || post.attributes[AttrRequestID] != "42" || post.attributes[AttrAPIVersion] != "v2" {
+		t.Fatalf("unexpected attributes %v", post.attributes)
+	}
+	var apiErr *APIError
+	if len(post.errs) != 1 || !errors.As(post.errs[0], &apiErr) || apiErr.Code != ErrorDuplicateReqID {
+		t.Fatalf("api error not recorded: %v", post.errs)
+	}
+}
+
+func TestWithContextCancel(t *testing.T) {
+	cl := newRouteClient(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cl.WithContext(ctx).GetAssetSummary("7"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	if _, err := cl.GetAssetSummary("7"); err != nil {
+		t.Fatalf("original client affected: %v", err)
+	}
+}
+
+func TestWithContextDirectory(t *testing.T) {
+	requests := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/open-api/v1/wallet/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[{"walletId":7,"walletName":"treasury","walletType":10}],"totalPage":1,"pageNo":1}}`))
+		case "/open-api/v1/subwallet/list":
+			_, _ = w.Write([]byte(`{"code":"000000","data":{"data":[],"totalPage":1,"pageNo":1}}`))
+		default:
+			_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+		}
+	})
+	// Loading the wallets to resolve a name uses the context of the copy
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cl.WithContext(ctx).GetAssetSummary("treasury"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("cancelled copy sent %d requests", requests)
+	}
+	// The cache is shared with the original client
+	if _, err := cl.WithContext(context.Background()).GetAssetSummary("treasury"); err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := cl.Directory().Get(7); !ok || entry.Name != "treasury" {
+		t.Fatalf("wallets loaded by the copy not cached: %+v", entry)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTracingRetryCount(t *testing.T) {
+	calls := 0
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch {
+		case calls == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.Header.Get("open-apikey") == "new-key-0001":
+			_, _ = w.Write([]byte(`{"code":"` + ErrorInvalidApiKey + `","message":"rejected"}`))
+		default:
+			_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+		}
+	})
+	old, err := NewCredential("old-key-0001", newTestKey(t), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := NewCredential("new-key-0001", newTestKey(t), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotating, err := NewRotatingCredentials(old, RotationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rotating.Rotate(next); err != nil {
+		t.Fatal(err)
+	}
+	tracer := &recordingTracer{}
+	WithCredentials(rotating)(cl)
+	WithTracer(tracer)(cl)
+	WithRetry(1, time.Millisecond)(cl)
+
+	// The new key gets a 503 then a rejection, the old key succeeds
+	if _, err = cl.GetAssetSummary("7"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || len(tracer.spans) != 1 {
+		t.Fatalf("expected 3 attempts in 1 span, got %d in %d", calls, len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	if span.attributes[AttrRetryCount] != 2 || span.attributes[AttrHTTPStatus] != 200 || span.attributes[AttrCode] != CodeSuccess || len(span.errs) != 0 {
+		t.Fatalf("unexpected span %+v", span)
+	}
+}
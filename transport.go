@@ -0,0 +1,124 @@
+package ceffu
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// DefaultMaxResponseSize is the largest response body read, larger bodies fail with ErrResponseTooLarge
+const DefaultMaxResponseSize = 10 << 20
+
+// maxErrorBody is the number of bytes of a body kept in a TransportError
+const maxErrorBody = 512
+
+var (
+	ErrResponseTooLarge = errors.New("response body too large")
+	ErrEmptyResponse    = errors.New("empty response body")
+	ErrNotJSON          = errors.New("response is not json")
+	ErrHTTPStatus       = errors.New("unexpected http status")
+)
+
+// TransportError is returned when a response is not a Ceffu json response,
+// e.g. an html error page from a gateway, an empty body or an oversized body.
+// Err is one of ErrResponseTooLarge, ErrEmptyResponse, ErrNotJSON or ErrHTTPStatus.
+type TransportError struct {
+	Endpoint   string
+	StatusCode int
+	Header     http.Header
+	Body       string // truncated
+	Err        error
+}
+
+func (e *TransportError) Error() string {
+	message := fmt.Sprintf("ceffu: %s: http %d: %s", e.Endpoint, e.StatusCode, e.Err)
+	if e.Body != "" {
+		message += ": " + e.Body
+	}
+	return message
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the request was rejected before Ceffu processed it
+// (too many requests or service unavailable), so sending it again is safe
+func (e *TransportError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable
+}
+
+// Temporary reports whether the request failed at a gateway or was rejected before Ceffu processed it,
+// i.e. http 429, 502, 503 or 504
+func (e *TransportError) Temporary() bool {
+	return e.Retryable() || e.StatusCode == http.StatusBadGateway || e.StatusCode == http.StatusGatewayTimeout
+}
+
+// networkError reports whether err is a failure to reach Ceffu or to read its response,
+// rather than a response sent by Ceffu or a request that could not be built
+func networkError(err error) bool {
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// WithMaxResponseSize limits how many bytes of a response body are read, default DefaultMaxResponseSize
+func WithMaxResponseSize(size int64) Option {
+	return func(c *Client) {
+		c.maxResponseSize = size
+	}
+}
+
+// classifyResponse returns a *TransportError unless the response carries a json body.
+// Non 2xx responses with a json body are passed on, Ceffu reports errors in their code.
+func classifyResponse(endpoint string, response *http.Response, body []byte) error {
+	transportError := func(err error) error {
+		truncated := body
+		if len(truncated) > maxErrorBody {
+			truncated = truncated[:maxErrorBody]
+		}
+		return &TransportError{
+			Endpoint:   endpoint,
+			StatusCode: response.StatusCode,
+			Header:     response.Header,
+			Body:       string(truncated),
+			Err:        err,
+		}
+	}
+	trimmed := bytes.TrimSpace(body)
+	isJSON := len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+	if contentType := response.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if mediaType != "application/json" && mediaType != "text/plain" {
+			isJSON = false
+		}
+	}
+	success := response.StatusCode >= 200 && response.StatusCode < 300
+	switch {
+	case isJSON:
+		return nil
+	case !success:
+		return transportError(ErrHTTPStatus)
+	case len(trimmed) == 0:
+		return transportError(ErrEmptyResponse)
+	default:
+		return transportError(ErrNotJSON)
+	}
+}
+
+// readBody reads at most limit bytes of body
+func readBody(body io.Reader, limit int64) ([]byte, error) {
+	read, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(read)) > limit {
+		return read[:limit], ErrResponseTooLarge
+	}
+	return read, nil
+}
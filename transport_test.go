@@ -0,0 +1,110 @@
+package ceffu
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransportErrors(t *testing.T) {
+	var status int
+	var contentType, body string
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	})
+	WithMaxResponseSize(1024)(cl)
+
+	status, contentType, body = http.StatusBadGateway, "text/html", "<html>"+strings.Repeat("x", 1000)+"</html>"
+	_, err := cl.GetAssetSummary("7")
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) || !errors.Is(err, ErrHTTPStatus) {
+		t.Fatalf("expected http status error, got %v", err)
+	}
+	if transportErr.StatusCode != http.StatusBadGateway || transportErr.Endpoint != "/open-api/v1/wallet/asset/summary" ||
+		len(transportErr.Body) != maxErrorBody || transportErr.Header.Get("Content-Type") != "text/html" {
+		t.Fatalf("unexpected error %+v", transportErr)
+	}
+
+	status, contentType, body = http.StatusOK, "", ""
+	if _, err = cl.GetAssetSummary("7"); !errors.Is(err, ErrEmptyResponse) {
+		t.Fatalf("expected empty response error, got %v", err)
+	}
+	status, contentType, body = http.StatusOK, "text/html", "<html></html>"
+	if _, err = cl.GetAssetSummary("7"); !errors.Is(err, ErrNotJSON) {
+		t.Fatalf("expected not json error, got %v", err)
+	}
+	status, contentType, body = http.StatusOK, "application/json", `{"code":"000000","data":"`+strings.Repeat("x", 2000)+`"}`
+	if _, err = cl.GetAssetSummary("7"); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("expected too large error, got %v", err)
+	}
+	// Ceffu errors sent with an error status are decoded as usual
+	status, contentType, body = http.StatusBadRequest, "application/json;charset=UTF-8", `{"code":"G20001","message":"bad"}`
+	resp, err := cl.GetAssetSummary("7")
+	if err != nil || resp.Code != "G20001" {
+		t.Fatalf("expected ceffu error code, got %v %v", resp, err)
+	}
+}
+
+func TestTransportRetry(t *testing.T) {
+	calls := map[string]int{}
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls[r.Method]++
+		if r.Method == http.MethodGet && calls[r.Method] <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+	})
+	tracer := &recordingTracer{}
+	WithTracer(tracer)(cl)
+	WithRetry(3, time.Millisecond)(cl)
+
+	if _, err := cl.GetAssetSummary("7"); err != nil {
+		t.Fatal(err)
+	}
+	if calls[http.MethodGet] != 3 || tracer.spans[0].attributes[AttrRetryCount] != 2 {
+		t.Fatalf("expected 2 retries, got %d calls and %v", calls[http.MethodGet], tracer.spans[0].attributes)
+	}
+	// Signed posts are not resent, even when Ceffu did not process them
+	if _, err := cl.CreateWallet("w", int(WalletTypeIntPrime), 1); !errors.Is(err, ErrHTTPStatus) {
+		t.Fatalf("expected http status error, got %v", err)
+	}
+	if calls[http.MethodPost] != 1 {
+		t.Fatalf("post was retried %d times", calls[http.MethodPost]-1)
+	}
+}
+
+func TestTransportShouldRetry(t *testing.T) {
+	get, _ := http.NewRequest(http.MethodGet, "https://open-api.ceffu.com/open-api/v1/wallet/list", nil)
+	post, _ := http.NewRequest(http.MethodPost, "https://open-api.ceffu.com/open-api/v1/wallet/create", nil)
+	networkErr := &url.Error{Op: "Get", URL: get.URL.String(), Err: errors.New("connection refused")}
+	cases := []struct {
+		request *http.Request
+		err     error
+		retry   bool
+	}{
+		{get, networkErr, true},
+		{get, &TransportError{StatusCode: http.StatusBadGateway, Err: ErrHTTPStatus}, true},
+		{get, &TransportError{StatusCode: http.StatusServiceUnavailable, Err: ErrHTTPStatus}, true},
+		{get, &TransportError{StatusCode: http.StatusInternalServerError, Err: ErrHTTPStatus}, false},
+		{get, &TransportError{StatusCode: http.StatusOK, Err: ErrResponseTooLarge}, false},
+		{get, errors.New("ceffu: invalid request"), false},
+		{post, networkErr, false},
+	}
+	for i, c := range cases {
+		if shouldRetry(c.request, c.err) != c.retry {
+			t.Errorf("case %d: shouldRetry(%s, %v) = %v", i, c.request.Method, c.err, !c.retry)
+		}
+	}
+}
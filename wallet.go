@@ -2,226 +2,211 @@ package ceffu
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 )
 
-type GetPrimeSupportedCoinListResp struct {
-	Data []struct {
-		CoinID            int    `json:"coinId"`
-		CoinSymbol        string `json:"coinSymbol"`
-		CoinFullName      string `json:"coinFullName"`
-		NetworkConfigList []struct {
-			CoinSymbol       string `json:"coinSymbol"`
-			CoinFullName     string `json:"coinFullName"`
-			Network          string `json:"network"`
-			DepositEnable    bool   `json:"depositEnable"`
-			WithdrawalEnable bool   `json:"withdrawalEnable"`
-			WithdrawalMin    string `json:"withdrawalMin"`
-			WithdrawalMax    string `json:"withdrawalMax"`
-			Precision        int    `json:"precision"`
-			WithdrawalFee    string `json:"withdrawalFee"`
-			AddressRegex     string `json:"addressRegex"`
-		} `json:"networkConfigList"`
-		DepositEnable    bool `json:"depositEnable"`
-		WithdrawalEnable bool `json:"withdrawalEnable"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+type PrimeCoin struct {
+	CoinID            int    `json:"coinId"`
+	CoinSymbol        string `json:"coinSymbol"`
+	CoinFullName      string `json:"coinFullName"`
+	NetworkConfigList []struct {
+		CoinSymbol       string `json:"coinSymbol"`
+		CoinFullName     string `json:"coinFullName"`
+		Network          string `json:"network"`
+		DepositEnable    bool   `json:"depositEnable"`
+		WithdrawalEnable bool   `json:"withdrawalEnable"`
+		WithdrawalMin    string `json:"withdrawalMin"`
+		WithdrawalMax    string `json:"withdrawalMax"`
+		Precision        int    `json:"precision"`
+		WithdrawalFee    string `json:"withdrawalFee"`
+		AddressRegex     string `json:"addressRegex"`
+	} `json:"networkConfigList"`
+	DepositEnable    bool `json:"depositEnable"`
+	WithdrawalEnable bool `json:"withdrawalEnable"`
 }
 
+type GetPrimeSupportedCoinListResp = Envelope[[]PrimeCoin]
+
 // GetPrimeSupportedCoinList returns the list of supported coins
 func (c *Client) GetPrimeSupportedCoinList() (*GetPrimeSupportedCoinListResp, error) {
 	get, err := c.get("wallet/shared/coin", map[string]string{})
 	if err != nil {
 		return nil, err
 	}
-	response := &GetPrimeSupportedCoinListResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
-}
-
-type GetQualifiedSupportedCoinListResp struct {
-	Data []struct {
-		CoinID           int         `json:"coinId"`
-		CoinSymbol       string      `json:"coinSymbol"`
-		CoinFullName     interface{} `json:"coinFullName"`
-		Network          string      `json:"network"`
-		Protocol         interface{} `json:"protocol"`
-		DepositEnable    bool        `json:"depositEnable"`
-		WithdrawalEnable bool        `json:"withdrawalEnable"`
-		WithdrawalMin    string      `json:"withdrawalMin"`
-		WithdrawalMax    interface{} `json:"withdrawalMax"`
-		Precision        int         `json:"precision"`
-		AddressRegex     string      `json:"addressRegex"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	return decodeEnvelope[[]PrimeCoin](get)
 }
 
+type QualifiedCoin struct {
+	CoinID           int         `json:"coinId"`
+	CoinSymbol       string      `json:"coinSymbol"`
+	CoinFullName     interface{} `json:"coinFullName"`
+	Network          string      `json:"network"`
+	Protocol         interface{} `json:"protocol"`
+	DepositEnable    bool        `json:"depositEnable"`
+	WithdrawalEnable bool        `json:"withdrawalEnable"`
+	WithdrawalMin    string      `json:"withdrawalMin"`
+	WithdrawalMax    interface{} `json:"withdrawalMax"`
+	Precision        int         `json:"precision"`
+	AddressRegex     string      `json:"addressRegex"`
+}
+
+type GetQualifiedSupportedCoinListResp = Envelope[[]QualifiedCoin]
+
 // GetQualifiedSupportedCoinList returns the list of coins that are supported by Ceffu's qualified wallet
 func (c *Client) GetQualifiedSupportedCoinList() (*GetQualifiedSupportedCoinListResp, error) {
 	get, err := c.get("wallet/qualified/coin", map[string]string{})
 	if err != nil {
 		return nil, err
 	}
-	response := &GetQualifiedSupportedCoinListResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return decodeEnvelope[[]QualifiedCoin](get)
 }
 
-type GetWalletListResp struct {
-	Data struct {
-		Data []struct {
-			WalletID    int64  `json:"walletId"`
-			WalletName  string `json:"walletName"`
-			WalletType  int    `json:"walletType"`
-			WalletIDStr string `json:"walletIdStr"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+type WalletInfo struct {
+	WalletID    int64  `json:"walletId"`
+	WalletName  string `json:"walletName"`
+	WalletType  int    `json:"walletType"`
+	WalletIDStr string `json:"walletIdStr"`
 }
 
-// GetWalletList returns the list of wallets for certain organization
-// pageLimit: optional, default 25, max 25
-// pageNo: optional, default 1
-func (c *Client) GetWalletList(pageLimit int, pageNo int) (*GetWalletListResp, error) {
-	if pageLimit > 25 || pageLimit == 0 {
-		pageLimit = 25
-	}
-	if pageNo == 0 {
-		pageNo = 1
-	}
-	get, err := c.get("wallet/list", map[string]string{
-		"pageLimit": strconv.Itoa(pageLimit),
-		"pageNo":    strconv.Itoa(pageNo),
-	})
-	if err != nil {
+type GetWalletListResp = Envelope[Page[WalletInfo]]
+
+// WalletListQuery pages QueryWalletList
+type WalletListQuery struct {
+	PageLimit int // optional, default 25, max 25
+	PageNo    int // optional, default 1
+}
+
+func (q *WalletListQuery) Validate() error {
+	return validatePaging(q.PageLimit, q.PageNo)
+}
+
+// QueryWalletList returns the list of wallets for certain organization
+func (c *Client) QueryWalletList(query *WalletListQuery) (*GetWalletListResp, error) {
+	if err := query.Validate(); err != nil {
 		return nil, err
 	}
-	response := &GetWalletListResp{}
-	err = json.Unmarshal(get, response)
+	get, err := c.get("wallet/list", c.pageParams(query.PageLimit, query.PageNo))
 	if err != nil {
 		return nil, err
 	}
-	return response, nil
-}
-
-type GetAssetDetailsResp struct {
-	Data struct {
-		Data []struct {
-			CoinSymbol      string `json:"coinSymbol"`
-			Network         string `json:"network"`
-			Amount          string `json:"amount"`
-			AvailableAmount string `json:"availableAmount"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	return decodeEnvelope[Page[WalletInfo]](get)
 }
 
-// GetAssetDetails returns the asset details of a wallet
-// coinSymbol: optional, if not provided, all coins will be returned
-// network: optional, if not provided, all networks will be returned
-// walletId: required
+// GetWalletList returns the list of wallets for certain organization, see QueryWalletList
 // pageLimit: optional, default 25, max 25
 // pageNo: optional, default 1
-func (c *Client) GetAssetDetails(coinSymbol string, network string, walletId string, pageLimit int, pageNo int) (*GetAssetDetailsResp, error) {
-	if pageLimit > 25 || pageLimit == 0 {
-		pageLimit = 25
-	}
-	if pageNo == 0 {
-		pageNo = 1
+func (c *Client) GetWalletList(pageLimit int, pageNo int) (*GetWalletListResp, error) {
+	return c.QueryWalletList(&WalletListQuery{PageLimit: pageLimit, PageNo: pageNo})
+}
+
+type AssetBalance struct {
+	CoinSymbol      string `json:"coinSymbol"`
+	Network         string `json:"network"`
+	Amount          string `json:"amount"`
+	AvailableAmount string `json:"availableAmount"`
+}
+
+type GetAssetDetailsResp = Envelope[Page[AssetBalance]]
+
+// AssetDetailsQuery filters QueryAssetDetails
+type AssetDetailsQuery struct {
+	WalletID   WalletID // required
+	CoinSymbol string   // optional, all coins if empty
+	Network    string   // optional, all networks if empty
+	PageLimit  int      // optional, default 25, max 25
+	PageNo     int      // optional, default 1
+}
+
+func (q *AssetDetailsQuery) Validate() error {
+	if q.WalletID == "" {
+		return errors.New("walletId is required")
 	}
-	params := map[string]string{
-		"pageLimit": strconv.Itoa(pageLimit),
-		"pageNo":    strconv.Itoa(pageNo),
-		"walletId":  walletId,
+	return validatePaging(q.PageLimit, q.PageNo)
+}
+
+// QueryAssetDetails returns the asset details of a wallet
+func (c *Client) QueryAssetDetails(query *AssetDetailsQuery) (*GetAssetDetailsResp, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
 	}
-	if coinSymbol != "" {
-		params["coinSymbol"] = coinSymbol
+	params := c.pageParams(query.PageLimit, query.PageNo)
+	params["walletId"] = query.WalletID.String()
+	if query.CoinSymbol != "" {
+		params["coinSymbol"] = query.CoinSymbol
 	}
-	if network != "" {
-		params["network"] = network
+	if query.Network != "" {
+		params["network"] = query.Network
 	}
 	get, err := c.get("wallet/asset/list", params)
 	if err != nil {
 		return nil, err
 	}
-	response := &GetAssetDetailsResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return decodeEnvelope[Page[AssetBalance]](get)
+}
+
+// GetAssetDetails returns the asset details of a wallet, see QueryAssetDetails
+// coinSymbol: optional, if not provided, all coins will be returned
+// network: optional, if not provided, all networks will be returned
+// walletId: required
+// pageLimit: optional, default 25, max 25
+// pageNo: optional, default 1
+func (c *Client) GetAssetDetails(coinSymbol string, network string, walletId WalletID, pageLimit int, pageNo int) (*GetAssetDetailsResp, error) {
+	return c.QueryAssetDetails(&AssetDetailsQuery{
+		WalletID:   walletId,
+		CoinSymbol: coinSymbol,
+		Network:    network,
+		PageLimit:  pageLimit,
+		PageNo:     pageNo,
+	})
 }
 
-type GetAssetSummaryResp struct {
-	Data struct {
-		WalletIDStr      string `json:"walletIdStr"`
-		TotalAmountInBTC string `json:"totalAmountInBTC"`
-		TotalAmountInUSD string `json:"totalAmountInUSD"`
-		Data             []struct {
-			WalletIDStr         string `json:"walletIdStr"`
-			SubTotalAmountInBTC string `json:"subTotalAmountInBTC"`
-			SubTotalAmountInUSD string `json:"subTotalAmountInUSD"`
-		} `json:"data"`
+type AssetSummary struct {
+	WalletIDStr      string `json:"walletIdStr"`
+	TotalAmountInBTC string `json:"totalAmountInBTC"`
+	TotalAmountInUSD string `json:"totalAmountInUSD"`
+	Data             []struct {
+		WalletIDStr         string `json:"walletIdStr"`
+		SubTotalAmountInBTC string `json:"subTotalAmountInBTC"`
+		SubTotalAmountInUSD string `json:"subTotalAmountInUSD"`
 	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
 }
 
+type GetAssetSummaryResp = Envelope[AssetSummary]
+
 // GetAssetSummary This method allows you to fetch the specified wallet's asset summary,
 //
 //	represented in its equivalent BTC & USD value.
 //	Please note that this equivalent value is provided for reference only and is based on our internal calculation.
 //
 // WalletId required
-func (c *Client) GetAssetSummary(walletId string) (*GetAssetSummaryResp, error) {
+func (c *Client) GetAssetSummary(walletId WalletID) (*GetAssetSummaryResp, error) {
 	get, err := c.get("wallet/asset/summary", map[string]string{
-		"walletIdStr": walletId,
+		"walletIdStr": walletId.String(),
 	})
 	if err != nil {
 		return nil, err
 	}
-	response := &GetAssetSummaryResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return decodeEnvelope[AssetSummary](get)
 }
 
-type GetWithdrawalFeeResp struct {
-	Data struct {
-		FeeAmount string `json:"feeAmount"`
-		FeeSymbol string `json:"feeSymbol"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+type WithdrawalFee struct {
+	FeeAmount string `json:"feeAmount"`
+	FeeSymbol string `json:"feeSymbol"`
 }
 
+type GetWithdrawalFeeResp = Envelope[WithdrawalFee]
+
 // GetWithdrawalFee returns the withdrawal fee of a coin
 // walletId: required
 // coinSymbol: required
 // network: required, network symbol in capital letters
 // amount: optional, if not provided, the minimum withdrawal amount will be returned
-func (c *Client) GetWithdrawalFee(walletId string, coinSymbol string, network string, amount string) (*GetWithdrawalFeeResp, error) {
+func (c *Client) GetWithdrawalFee(walletId WalletID, coinSymbol string, network string, amount string) (*GetWithdrawalFeeResp, error) {
 	params := map[string]string{
-		"walletId":   walletId,
+		"walletId":   walletId.String(),
 		"coinSymbol": coinSymbol,
 		"network":    network,
 	}
@@ -232,75 +217,94 @@ func (c *Client) GetWithdrawalFee(walletId string, coinSymbol string, network st
 	if err != nil {
 		return nil, err
 	}
-	response := &GetWithdrawalFeeResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return decodeEnvelope[WithdrawalFee](get)
 }
 
-type GetDepositAddressResp struct {
-	Data struct {
-		WalletAddress string `json:"walletAddress"`
-		Memo          string `json:"memo"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+type DepositAddress struct {
+	WalletAddress string `json:"walletAddress"`
+	Memo          string `json:"memo"`
 }
 
+type GetDepositAddressResp = Envelope[DepositAddress]
+
 // GetDepositAddress returns the deposit address of a coin
 // coinSymbol: required
 // network: required, network symbol in capital letters
 // walletId: required
-func (c *Client) GetDepositAddress(coinSymbol string, network string, walletId string) (*GetDepositAddressResp, error) {
+func (c *Client) GetDepositAddress(coinSymbol string, network string, walletId WalletID) (*GetDepositAddressResp, error) {
 	get, err := c.get("wallet/deposit/address", map[string]string{
 		"coinSymbol": coinSymbol,
 		"network":    network,
-		"walletId":   walletId,
+		"walletId":   walletId.String(),
 	})
 	if err != nil {
 		return nil, err
 	}
-	response := &GetDepositAddressResp{}
-	err = json.Unmarshal(get, response)
+	return decodeEnvelope[DepositAddress](get)
+}
+
+type DepositRecord struct {
+	OrderViewID         string            `json:"orderViewId"`
+	TxID                interface{}       `json:"txId"` // String or null
+	TransferType        TransferType      `json:"transferType"`
+	Direction           TransferDirection `json:"direction"` // See constants.go/TransferDirectionInt*
+	FromAddress         string            `json:"fromAddress"`
+	ToAddress           string            `json:"toAddress"`
+	Network             interface{}       `json:"network"` // String or null
+	CoinSymbol          string            `json:"coinSymbol"`
+	Amount              string            `json:"amount"`
+	FeeSymbol           interface{}       `json:"feeSymbol"`
+	FeeAmount           string            `json:"feeAmount"`
+	Status              int               `json:"status"`
+	ConfirmedBlockCount int               `json:"confirmedBlockCount"`
+	UnlockConfirm       int               `json:"unlockConfirm"`
+	MaxConfirmBlock     interface{}       `json:"maxConfirmBlock"`
+	Memo                interface{}       `json:"memo"` // String or null
+	TxTime              int64             `json:"txTime"`
+	WalletID            int64             `json:"walletId"`
+}
+
+type GetDepositHistoryResp = Envelope[Page[DepositRecord]]
+
+// DepositHistoryQuery filters QueryDepositHistory
+type DepositHistoryQuery struct {
+	WalletID   WalletID  // required
+	CoinSymbol string    // optional, all coins if empty
+	Network    string    // optional, all networks if empty
+	StartTime  time.Time // required
+	EndTime    time.Time // optional, default now
+	PageLimit  int       // optional, default 25, max 25
+	PageNo     int       // optional, default 1
+}
+
+func (q *DepositHistoryQuery) Validate() error {
+	if q.WalletID == "" {
+		return errors.New("walletId is required")
+	}
+	return validateHistory(q.StartTime, q.EndTime, q.PageLimit, q.PageNo)
+}
+
+// QueryDepositHistory returns the deposit history of a wallet
+func (c *Client) QueryDepositHistory(query *DepositHistoryQuery) (*GetDepositHistoryResp, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	params := c.historyParams(query.StartTime, query.EndTime, query.PageLimit, query.PageNo)
+	params["walletId"] = query.WalletID.String()
+	if query.CoinSymbol != "" {
+		params["coinSymbol"] = query.CoinSymbol
+	}
+	if query.Network != "" {
+		params["network"] = query.Network
+	}
+	get, err := c.get("wallet/deposit/history", params)
 	if err != nil {
 		return nil, err
 	}
-	return response, nil
-}
-
-type GetDepositHistoryResp struct {
-	Data struct {
-		Data []struct {
-			OrderViewID         string            `json:"orderViewId"`
-			TxID                interface{}       `json:"txId"` // String or null
-			TransferType        TransferType      `json:"transferType"`
-			Direction           TransferDirection `json:"direction"` // See constants.go/TransferDirectionInt*
-			FromAddress         string            `json:"fromAddress"`
-			ToAddress           string            `json:"toAddress"`
-			Network             interface{}       `json:"network"` // String or null
-			CoinSymbol          string            `json:"coinSymbol"`
-			Amount              string            `json:"amount"`
-			FeeSymbol           interface{}       `json:"feeSymbol"`
-			FeeAmount           string            `json:"feeAmount"`
-			Status              int               `json:"status"`
-			ConfirmedBlockCount int               `json:"confirmedBlockCount"`
-			UnlockConfirm       int               `json:"unlockConfirm"`
-			MaxConfirmBlock     interface{}       `json:"maxConfirmBlock"`
-			Memo                interface{}       `json:"memo"` // String or null
-			TxTime              int64             `json:"txTime"`
-			WalletID            int64             `json:"walletId"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	return decodeEnvelope[Page[DepositRecord]](get)
 }
 
-// GetDepositHistory returns the deposit history of a coin
+// GetDepositHistory returns the deposit history of a coin, see QueryDepositHistory
 // walletId: required
 // coinSymbol: optional, if not provided, all coins will be returned
 // network: optional, if not provided, all networks will be returned
@@ -308,68 +312,42 @@ type GetDepositHistoryResp struct {
 // endTime: optional, default to current time, unix timestamp in milliseconds
 // pageLimit: optional, default 25, max 25
 // pageNo: optional, default 1
-func (c *Client) GetDepositHistory(walletId string, coinSymbol string, network string, startTime int64, endTime int64, pageLimit int, pageNo int) (*GetDepositHistoryResp, error) {
-	if pageLimit > 25 || pageLimit == 0 {
-		pageLimit = 25
-	}
-	if pageNo == 0 {
-		pageNo = 1
-	}
-	params := map[string]string{
-		"pageLimit": strconv.Itoa(pageLimit),
-		"pageNo":    strconv.Itoa(pageNo),
-		"walletId":  walletId,
-		"startTime": strconv.FormatInt(startTime, 10),
-	}
-	if coinSymbol != "" {
-		params["coinSymbol"] = coinSymbol
-	}
-	if network != "" {
-		params["network"] = network
-	}
-	if endTime != 0 {
-		params["endTime"] = strconv.FormatInt(endTime, 10)
-	} else {
-		params["endTime"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
-	}
-	get, err := c.get("wallet/deposit/history", params)
-	if err != nil {
-		return nil, err
-	}
-	response := &GetDepositHistoryResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
-}
-
-type GetDepositDetailResp struct {
-	Data []struct {
-		OrderViewId         string      `json:"orderViewId"`
-		TxId                interface{} `json:"txId"` // String or null
-		TransferType        int         `json:"transferType"`
-		Direction           int         `json:"direction"`
-		FromAddress         string      `json:"fromAddress"`
-		ToAddress           string      `json:"toAddress"`
-		Network             interface{} `json:"network"` // String or null
-		CoinSymbol          string      `json:"coinSymbol"`
-		Amount              string      `json:"amount"`
-		FeeSymbol           interface{} `json:"feeSymbol"` // String or null
-		FeeAmount           string      `json:"feeAmount"`
-		Status              int         `json:"status"`
-		ConfirmedBlockCount interface{} `json:"confirmedBlockCount"` // int or null
-		UnlockConfirm       interface{} `json:"unlockConfirm"`       // int or null
-		MaxConfirmBlock     interface{} `json:"maxConfirmBlock"`     // int or null
-		Memo                interface{} `json:"memo"`
-		TxTime              int64       `json:"txTime"`
-		WalletId            int64       `json:"walletId"`
-		RequestId           interface{} `json:"requestId"` // String or null
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+func (c *Client) GetDepositHistory(walletId WalletID, coinSymbol string, network string, startTime int64, endTime int64, pageLimit int, pageNo int) (*GetDepositHistoryResp, error) {
+	return c.QueryDepositHistory(&DepositHistoryQuery{
+		WalletID:   walletId,
+		CoinSymbol: coinSymbol,
+		Network:    network,
+		StartTime:  millisTime(startTime),
+		EndTime:    millisTime(endTime),
+		PageLimit:  pageLimit,
+		PageNo:     pageNo,
+	})
+}
+
+type DepositDetail struct {
+	OrderViewId         string      `json:"orderViewId"`
+	TxId                interface{} `json:"txId"` // String or null
+	TransferType        int         `json:"transferType"`
+	Direction           int         `json:"direction"`
+	FromAddress         string      `json:"fromAddress"`
+	ToAddress           string      `json:"toAddress"`
+	Network             interface{} `json:"network"` // String or null
+	CoinSymbol          string      `json:"coinSymbol"`
+	Amount              string      `json:"amount"`
+	FeeSymbol           interface{} `json:"feeSymbol"` // String or null
+	FeeAmount           string      `json:"feeAmount"`
+	Status              int         `json:"status"`
+	ConfirmedBlockCount interface{} `json:"confirmedBlockCount"` // int or null
+	UnlockConfirm       interface{} `json:"unlockConfirm"`       // int or null
+	MaxConfirmBlock     interface{} `json:"maxConfirmBlock"`     // int or null
+	Memo                interface{} `json:"memo"`
+	TxTime              int64       `json:"txTime"`
+	WalletId            int64       `json:"walletId"`
+	RequestId           interface{} `json:"requestId"` // String or null
 }
 
+type GetDepositDetailResp = Envelope[[]DepositDetail]
+
 // GetDepositDetail queries the deposit detail of a transaction
 // txId: required, transaction id for corresponding deposit
 func (c *Client) GetDepositDetail(txId string) (*GetDepositDetailResp, error) {
@@ -379,41 +357,78 @@ func (c *Client) GetDepositDetail(txId string) (*GetDepositDetailResp, error) {
 	if err != nil {
 		return nil, err
 	}
-	response := &GetDepositDetailResp{}
-	err = json.Unmarshal(get, response)
+	return decodeEnvelope[[]DepositDetail](get)
+}
+
+type WithdrawalRecord struct {
+	Direction           int          `json:"direction"`
+	Network             string       `json:"network"`
+	Memo                interface{}  `json:"memo"` // String or null
+	CoinSymbol          string       `json:"coinSymbol"`
+	Amount              string       `json:"amount"`
+	FeeSymbol           string       `json:"feeSymbol"`
+	FeeAmount           string       `json:"feeAmount"`
+	WalletID            int64        `json:"walletId"`
+	FromAddress         string       `json:"fromAddress"`
+	ToAddress           string       `json:"toAddress"`
+	OrderViewID         string       `json:"orderViewId"`
+	TransferType        TransferType `json:"transferType"`
+	Status              int          `json:"status"`
+	TxID                string       `json:"txId"`
+	TxTime              int64        `json:"txTime"`
+	ConfirmedBlockCount int          `json:"confirmedBlockCount"`
+	MaxConfirmedBlock   interface{}  `json:"maxConfirmedBlock"` // int or null
+	UnlockConfirm       interface{}  `json:"unlockConfirm"`     // int or null
+}
+
+type GetWithdrawalHistoryResp = Envelope[Page[WithdrawalRecord]]
+
+// WithdrawalHistoryQuery filters QueryWithdrawalHistory
+type WithdrawalHistoryQuery struct {
+	WalletID   WalletID       // required
+	Network    string         // optional, all networks if empty
+	CoinSymbol string         // optional, all coins if empty
+	Status     WithdrawStatus // optional, WithdrawStatusAll by default
+	StartTime  time.Time      // required
+	EndTime    time.Time      // optional, default now
+	PageLimit  int            // optional, default 25, max 25
+	PageNo     int            // optional, default 1
+}
+
+func (q *WithdrawalHistoryQuery) Validate() error {
+	if q.WalletID == "" {
+		return errors.New("walletId is required")
+	}
+	if err := validateWithdrawStatus(q.Status); err != nil {
+		return err
+	}
+	return validateHistory(q.StartTime, q.EndTime, q.PageLimit, q.PageNo)
+}
+
+// QueryWithdrawalHistory returns the withdrawal history of a wallet
+func (c *Client) QueryWithdrawalHistory(query *WithdrawalHistoryQuery) (*GetWithdrawalHistoryResp, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	params := c.historyParams(query.StartTime, query.EndTime, query.PageLimit, query.PageNo)
+	params["walletId"] = query.WalletID.String()
+	if query.Network != "" {
+		params["network"] = query.Network
+	}
+	if query.CoinSymbol != "" {
+		params["coinSymbol"] = query.CoinSymbol
+	}
+	if query.Status != WithdrawStatusAll {
+		params["status"] = strconv.Itoa(int(query.Status))
+	}
+	get, err := c.get("wallet/withdrawal/history", params)
 	if err != nil {
 		return nil, err
 	}
-	return response, nil
-}
-
-type GetWithdrawalHistoryResp struct {
-	Data []struct {
-		Direction           int          `json:"direction"`
-		Network             string       `json:"network"`
-		Memo                int          `json:"memo"`
-		CoinSymbol          string       `json:"coinSymbol"`
-		Amount              float64      `json:"amount"`
-		FeeSymbol           string       `json:"feeSymbol"`
-		FeeAmount           float64      `json:"feeAmount"`
-		WalletID            int64        `json:"walletId"`
-		FromAddress         string       `json:"fromAddress"`
-		ToAddress           string       `json:"toAddress"`
-		OrderViewID         int64        `json:"orderViewId"`
-		TransferType        TransferType `json:"transferType"`
-		Status              int          `json:"status"`
-		TxID                string       `json:"txId"`
-		TxTime              int64        `json:"txTime"`
-		ConfirmedBlockCount int          `json:"confirmedBlockCount"`
-		MaxConfirmedBlock   string       `json:"maxConfirmedBlock"`
-		UnlockConfirm       string       `json:"unlockConfirm"`
-	} `json:"data"`
-	PageLimit int `json:"pageLimit"`
-	PageNo    int `json:"pageNo"`
-	TotalPage int `json:"totalPage"`
+	return decodeEnvelope[Page[WithdrawalRecord]](get)
 }
 
-// GetWithdrawalHistory returns the withdrawal history of a coin
+// GetWithdrawalHistory returns the withdrawal history of a coin, see QueryWithdrawalHistory
 // walletId required
 // network optional, if not provided, all networks will be returned
 // coinSymbol optional, if not provided, all coins will be returned
@@ -422,68 +437,40 @@ type GetWithdrawalHistoryResp struct {
 // endTime optional, default to current time, unix timestamp in milliseconds
 // pageLimit optional, default 25, max 25
 // pageNo optional, default 1
-func (c *Client) GetWithdrawalHistory(walletId string, network string, coinSymbol string, status WithdrawStatus, startTime int64, endTime int64, pageLimit int, pageNo int) (*GetWithdrawalHistoryResp, error) {
-	if pageLimit > 25 || pageLimit == 0 {
-		pageLimit = 25
-	}
-	if pageNo == 0 {
-		pageNo = 1
-	}
-	params := map[string]string{
-		"pageLimit": strconv.Itoa(pageLimit),
-		"pageNo":    strconv.Itoa(pageNo),
-		"walletId":  walletId,
-		"startTime": strconv.FormatInt(startTime, 10),
-	}
-	if network != "" {
-		params["network"] = network
-	}
-	if coinSymbol != "" {
-		params["coinSymbol"] = coinSymbol
-	}
-	if status != 0 {
-		params["status"] = strconv.Itoa(int(status))
-	}
-	if endTime != 0 {
-		params["endTime"] = strconv.FormatInt(endTime, 10)
-	} else {
-		params["endTime"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
-	}
-	get, err := c.get("wallet/withdrawal/history", params)
-	if err != nil {
-		return nil, err
-	}
-	response := &GetWithdrawalHistoryResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
-}
-
-type GetWithdrawalDetailResp struct {
-	Data struct {
-		OrderViewID         string `json:"orderViewId"`
-		TxID                string `json:"txId"`
-		TransferType        int    `json:"transferType"`
-		Direction           int    `json:"direction"`
-		FromAddress         string `json:"fromAddress"`
-		ToAddress           string `json:"toAddress"`
-		Network             string `json:"network"`
-		CoinSymbol          string `json:"coinSymbol"`
-		Amount              string `json:"amount"`
-		FeeSymbol           string `json:"feeSymbol"`
-		FeeAmount           string `json:"feeAmount"`
-		Status              int    `json:"status"`
-		ConfirmedBlockCount int    `json:"confirmedBlockCount"`
-		Memo                string `json:"memo"`
-		TxTime              int64  `json:"txTime"`
-		WalletID            int64  `json:"walletId"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+func (c *Client) GetWithdrawalHistory(walletId WalletID, network string, coinSymbol string, status WithdrawStatus, startTime int64, endTime int64, pageLimit int, pageNo int) (*GetWithdrawalHistoryResp, error) {
+	return c.QueryWithdrawalHistory(&WithdrawalHistoryQuery{
+		WalletID:   walletId,
+		Network:    network,
+		CoinSymbol: coinSymbol,
+		Status:     status,
+		StartTime:  millisTime(startTime),
+		EndTime:    millisTime(endTime),
+		PageLimit:  pageLimit,
+		PageNo:     pageNo,
+	})
 }
 
+type WithdrawalDetail struct {
+	OrderViewID         string `json:"orderViewId"`
+	TxID                string `json:"txId"`
+	TransferType        int    `json:"transferType"`
+	Direction           int    `json:"direction"`
+	FromAddress         string `json:"fromAddress"`
+	ToAddress           string `json:"toAddress"`
+	Network             string `json:"network"`
+	CoinSymbol          string `json:"coinSymbol"`
+	Amount              string `json:"amount"`
+	FeeSymbol           string `json:"feeSymbol"`
+	FeeAmount           string `json:"feeAmount"`
+	Status              int    `json:"status"`
+	ConfirmedBlockCount int    `json:"confirmedBlockCount"`
+	Memo                string `json:"memo"`
+	TxTime              int64  `json:"txTime"`
+	WalletID            int64  `json:"walletId"`
+}
+
+type GetWithdrawalDetailResp = Envelope[WithdrawalDetail]
+
 // GetWithdrawalDetail queries the withdrawal detail of a transaction
 // orderViewId: required, order view id for corresponding withdrawal
 func (c *Client) GetWithdrawalDetail(orderViewId string) (*GetWithdrawalDetailResp, error) {
@@ -493,116 +480,131 @@ func (c *Client) GetWithdrawalDetail(orderViewId string) (*GetWithdrawalDetailRe
 	if err != nil {
 		return nil, err
 	}
-	response := &GetWithdrawalDetailResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
-}
-
-type GetTransferHistoryWithExchangeResp struct {
-	Data struct {
-		Data []struct {
-			OrderViewID    string      `json:"orderViewId"`
-			Direction      int         `json:"direction"`
-			WalletID       int64       `json:"walletId"`
-			CreateTime     int64       `json:"createTime"`
-			ExchangeCode   int         `json:"exchangeCode"`
-			ExchangeUserID string      `json:"exchangeUserId"`
-			CoinSymbol     string      `json:"coinSymbol"`
-			Amount         string      `json:"amount"`
-			Status         int         `json:"status"`
-			RequestID      interface{} `json:"requestId"`
-		} `json:"data"`
-		TotalPage int `json:"totalPage"`
-		PageNo    int `json:"pageNo"`
-		PageLimit int `json:"pageLimit"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	return decodeEnvelope[WithdrawalDetail](get)
 }
 
-// GetTransferHistoryWithExchange returns the transfer history of a coin
-// walletId required
-// coinSymbol optional, if not provided, all coins will be returned
-// direction optional, if not provided, all directions will be returned
-// status optional, if not provided, all statuses will be returned
-// startTime required, unix timestamp in milliseconds
-// endTime optional, default to current time, unix timestamp in milliseconds
-// pageLimit optional, default 25, max 25
-// pageNo optional, default 1
-func (c *Client) GetTransferHistoryWithExchange(walletId string, coinSymbol string, direction TransferDirection, status WithdrawStatus, startTime int64, endTime int64, pageLimit int, pageNo int) (*GetTransferHistoryWithExchangeResp, error) {
-	if pageLimit > 25 || pageLimit == 0 {
-		pageLimit = 25
+type ExchangeTransferRecord struct {
+	OrderViewID    string       `json:"orderViewId"`
+	Direction      int          `json:"direction"`
+	WalletID       int64        `json:"walletId"`
+	CreateTime     int64        `json:"createTime"`
+	ExchangeCode   ExchangeCode `json:"exchangeCode"`
+	ExchangeUserID string       `json:"exchangeUserId"`
+	CoinSymbol     string       `json:"coinSymbol"`
+	Amount         string       `json:"amount"`
+	Status         int          `json:"status"`
+	RequestID      json.Number  `json:"requestId"`
+}
+
+type GetTransferHistoryWithExchangeResp = Envelope[Page[ExchangeTransferRecord]]
+
+// ExchangeTransferHistoryQuery filters QueryTransferHistoryWithExchange
+type ExchangeTransferHistoryQuery struct {
+	WalletID   WalletID          // required
+	CoinSymbol string            // optional, all coins if empty
+	Direction  TransferDirection // optional, TransferDirectionAll by default
+	Status     WithdrawStatus    // optional, WithdrawStatusAll by default
+	StartTime  time.Time         // required
+	EndTime    time.Time         // optional, default now
+	PageLimit  int               // optional, default 25, max 25
+	PageNo     int               // optional, default 1
+}
+
+func (q *ExchangeTransferHistoryQuery) Validate() error {
+	if q.WalletID == "" {
+		return errors.New("walletId is required")
 	}
-	if pageNo == 0 {
-		pageNo = 1
+	if q.Direction != TransferDirectionAll && q.Direction != TransferDirectionIntDeposit && q.Direction != TransferDirectionIntWithdraw {
+		return fmt.Errorf("invalid direction %d", q.Direction)
 	}
-	params := map[string]string{
-		"pageLimit": strconv.Itoa(pageLimit),
-		"pageNo":    strconv.Itoa(pageNo),
-		"walletId":  walletId,
-		"startTime": strconv.FormatInt(startTime, 10),
+	if err := validateWithdrawStatus(q.Status); err != nil {
+		return err
 	}
-	if coinSymbol != "" {
-		params["coinSymbol"] = coinSymbol
+	return validateHistory(q.StartTime, q.EndTime, q.PageLimit, q.PageNo)
+}
+
+// QueryTransferHistoryWithExchange returns the exchange transfer history of a wallet
+func (c *Client) QueryTransferHistoryWithExchange(query *ExchangeTransferHistoryQuery) (*GetTransferHistoryWithExchangeResp, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
 	}
-	if direction != 0 {
-		params["direction"] = strconv.Itoa(int(direction))
+	params := c.historyParams(query.StartTime, query.EndTime, query.PageLimit, query.PageNo)
+	params["walletId"] = query.WalletID.String()
+	if query.CoinSymbol != "" {
+		params["coinSymbol"] = query.CoinSymbol
 	}
-	if status != 0 {
-		params["status"] = strconv.Itoa(int(status))
+	if query.Direction != TransferDirectionAll {
+		params["direction"] = strconv.Itoa(int(query.Direction))
 	}
-	if endTime != 0 {
-		params["endTime"] = strconv.FormatInt(endTime, 10)
-	} else {
-		params["endTime"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
+	if query.Status != WithdrawStatusAll {
+		params["status"] = strconv.Itoa(int(query.Status))
 	}
 	get, err := c.get("wallet/transfer/exchange/history", params)
 	if err != nil {
 		return nil, err
 	}
-	response := &GetTransferHistoryWithExchangeResp{}
-	err = json.Unmarshal(get, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
-}
-
-type GetTransferDetailWithExchangeResp struct {
-	Data struct {
-		OrderViewID    string            `json:"orderViewId"`
-		Direction      TransferDirection `json:"direction"`
-		WalletID       int64             `json:"walletId"`
-		CreateTime     int64             `json:"createTime"`
-		ExchangeCode   int               `json:"exchangeCode"`
-		ExchangeUserID string            `json:"exchangeUserId"`
-		CoinSymbol     string            `json:"coinSymbol"`
-		Amount         string            `json:"amount"`
-		Status         int               `json:"status"`
-		RequestID      string            `json:"requestId"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	return decodeEnvelope[Page[ExchangeTransferRecord]](get)
+}
+
+// GetTransferHistoryWithExchange returns the transfer history of a coin, see QueryTransferHistoryWithExchange
+// walletId required
+// coinSymbol optional, if not provided, all coins will be returned
+// direction optional, if not provided, all directions will be returned
+// status optional, if not provided, all statuses will be returned
+// startTime required, unix timestamp in milliseconds
+// endTime optional, default to current time, unix timestamp in milliseconds
+// pageLimit optional, default 25, max 25
+// pageNo optional, default 1
+func (c *Client) GetTransferHistoryWithExchange(walletId WalletID, coinSymbol string, direction TransferDirection, status WithdrawStatus, startTime int64, endTime int64, pageLimit int, pageNo int) (*GetTransferHistoryWithExchangeResp, error) {
+	return c.QueryTransferHistoryWithExchange(&ExchangeTransferHistoryQuery{
+		WalletID:   walletId,
+		CoinSymbol: coinSymbol,
+		Direction:  direction,
+		Status:     status,
+		StartTime:  millisTime(startTime),
+		EndTime:    millisTime(endTime),
+		PageLimit:  pageLimit,
+		PageNo:     pageNo,
+	})
 }
 
+type ExchangeTransferDetail struct {
+	OrderViewID    string            `json:"orderViewId"`
+	Direction      TransferDirection `json:"direction"`
+	WalletID       int64             `json:"walletId"`
+	CreateTime     int64             `json:"createTime"`
+	ExchangeCode   ExchangeCode      `json:"exchangeCode"`
+	ExchangeUserID string            `json:"exchangeUserId"`
+	CoinSymbol     string            `json:"coinSymbol"`
+	Amount         string            `json:"amount"`
+	Status         WithdrawStatus    `json:"status"`
+	RequestID      string            `json:"requestId"`
+}
+
+type GetTransferDetailWithExchangeResp = Envelope[ExchangeTransferDetail]
+
 // GetTransferDetailWithExchange queries the transfer detail of a transaction
 // orderViewId: required, order view id for corresponding transfer
 // walletId: required
-func (c *Client) GetTransferDetailWithExchange(orderViewId string, walletId string) (*GetTransferDetailWithExchangeResp, error) {
+func (c *Client) GetTransferDetailWithExchange(orderViewId string, walletId WalletID) (*GetTransferDetailWithExchangeResp, error) {
 	get, err := c.get("wallet/transfer/exchange/detail", map[string]string{
 		"orderViewId": orderViewId,
-		"walletId":    walletId,
+		"walletId":    walletId.String(),
 	})
 	if err != nil {
 		return nil, err
 	}
-	response := &GetTransferDetailWithExchangeResp{}
-	err = json.Unmarshal(get, response)
+	return decodeEnvelope[ExchangeTransferDetail](get)
+}
+
+// GetWithdrawalDetailByRequestId queries the withdrawal detail by the requestId it was submitted with, v2 api
+// requestId: required, requestId passed to Withdrawal
+func (c *Client) GetWithdrawalDetailByRequestId(requestId int64) (*GetWithdrawalDetailResp, error) {
+	get, err := c.getV2("wallet/withdrawal/detail", map[string]string{
+		"requestId": strconv.FormatInt(requestId, 10),
+	})
 	if err != nil {
 		return nil, err
 	}
-	return response, nil
+	return decodeEnvelope[WithdrawalDetail](get)
 }
@@ -1,19 +1,13 @@
 package ceffu
 
-import (
-	"encoding/json"
-)
-
-type CreateWalletResp struct {
-	Data struct {
-		WalletID   int64  `json:"walletId"`
-		WalletName string `json:"walletName"`
-		WalletType int    `json:"walletType"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+type WalletResult struct {
+	WalletID   int64  `json:"walletId"`
+	WalletName string `json:"walletName"`
+	WalletType int    `json:"walletType"`
 }
 
+type CreateWalletResp = Envelope[WalletResult]
+
 // CreateWallet creates a wallet for certain organization
 // walletName: required
 // walletType: required, Use WalletTypeInt*
@@ -33,29 +27,20 @@ func (c *Client) CreateWallet(walletName string, walletType int, requestId ...in
 	if err != nil {
 		return nil, err
 	}
-	response := &CreateWalletResp{}
-	err = json.Unmarshal(post, response)
-	if err != nil {
-		return nil, err
+	resp, err := decodeEnvelope[WalletResult](post)
+	if err == nil && resp.Code == CodeSuccess {
+		c.directory.put(WalletEntry{WalletID: resp.Data.WalletID, Name: resp.Data.WalletName, Type: resp.Data.WalletType})
 	}
-	return response, nil
+	return resp, err
 }
 
-type UpdateWalletResp struct {
-	Data struct {
-		WalletID   int64  `json:"walletId"`
-		WalletName string `json:"walletName"`
-		WalletType int    `json:"walletType"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
+type UpdateWalletResp = Envelope[WalletResult]
 
 // UpdateWallet updates a wallet for certain organization
 // walletId: required
 // walletName: required
 // requestId: optional, default random
-func (c *Client) UpdateWallet(walletId int64, walletName string, requestId ...int64) (*UpdateWalletResp, error) {
+func (c *Client) UpdateWallet(walletId WalletID, walletName string, requestId ...int64) (*UpdateWalletResp, error) {
 	params := map[string]interface{}{
 		"walletId":   walletId,
 		"walletName": walletName,
@@ -70,24 +55,21 @@ func (c *Client) UpdateWallet(walletId int64, walletName string, requestId ...in
 	if err != nil {
 		return nil, err
 	}
-	response := &UpdateWalletResp{}
-	err = json.Unmarshal(post, response)
-	if err != nil {
-		return nil, err
+	resp, err := decodeEnvelope[WalletResult](post)
+	if err == nil && resp.Code == CodeSuccess {
+		c.directory.put(WalletEntry{WalletID: resp.Data.WalletID, Name: resp.Data.WalletName, Type: resp.Data.WalletType})
 	}
-	return response, nil
+	return resp, err
 }
 
-type WithdrawalResp struct {
-	Data struct {
-		OrderViewID  string         `json:"orderViewId"`
-		Status       WithdrawStatus `json:"status"` // See WithdrawStatusInt*
-		TransferType TransferType   `json:"transferType"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+type WithdrawalResult struct {
+	OrderViewID  string         `json:"orderViewId"`
+	Status       WithdrawStatus `json:"status"` // See WithdrawStatusInt*
+	TransferType TransferType   `json:"transferType"`
 }
 
+type WithdrawalResp = Envelope[WithdrawalResult]
+
 // Withdrawal withdraws from ceffu
 // amount: withdrawal amount, decimal string
 // coinSymbol: coin symbol, e.g. BTC
@@ -96,7 +78,12 @@ type WithdrawalResp struct {
 // requestId: optional, default random
 // walletId: required
 // withdrawalAddress: required
-func (c *Client) Withdrawal(amount string, coinSymbol string, memo string, network string, walletId int64, withdrawalAddress string, requestId ...int64) (*WithdrawalResp, error) {
+func (c *Client) Withdrawal(amount string, coinSymbol string, memo string, network string, walletId WalletID, withdrawalAddress string, requestId ...int64) (*WithdrawalResp, error) {
+	if c.withdrawalPolicy != nil {
+		if err := c.withdrawalPolicy.check(amount, coinSymbol, withdrawalAddress); err != nil {
+			return nil, err
+		}
+	}
 	params := map[string]interface{}{
 		"amount":            amount,
 		"coinSymbol":        coinSymbol,
@@ -117,33 +104,33 @@ func (c *Client) Withdrawal(amount string, coinSymbol string, memo string, netwo
 	if err != nil {
 		return nil, err
 	}
-	response := &WithdrawalResp{}
-	err = json.Unmarshal(post, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return decodeEnvelope[WithdrawalResult](post)
 }
 
-type TransferWithExchangeResp struct {
-	Data struct {
-		OrderViewID string            `json:"orderViewId"`
-		Status      WithdrawStatus    `json:"status"`
-		Direction   TransferDirection `json:"direction"`
-	} `json:"data"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+type ExchangeTransferResult struct {
+	OrderViewID string            `json:"orderViewId"`
+	Status      WithdrawStatus    `json:"status"`
+	Direction   TransferDirection `json:"direction"`
 }
 
+type TransferWithExchangeResp = Envelope[ExchangeTransferResult]
+
 // TransferWithExchange transfers from ceffu to binance exchange(currently only 1 direction is supported)
 // amount: transfer amount, decimal string
 // coinSymbol: coin symbol, e.g. BTC
 // direction: transfer direction, use TransferDirectionInt*
-// exchangeCode: only 10(Binance) supported.
+// exchangeCode: only ExchangeCodeBinance supported.
 // exchangeUserId: string, binance UID
 // parentWalletId: if using parent shared wallet, required.
-// requestId: optional, default random
-func (c *Client) TransferWithExchange(amount string, coinSymbol string, direction int, exchangeCode int, exchangeUserId string, parentWalletId ...int64) (*TransferWithExchangeResp, error) {
+// A random requestId is generated, use TransferWithExchangeWithRequestId to supply one.
+func (c *Client) TransferWithExchange(amount string, coinSymbol string, direction TransferDirection, exchangeCode ExchangeCode, exchangeUserId string, parentWalletId ...WalletID) (*TransferWithExchangeResp, error) {
+	return c.TransferWithExchangeWithRequestId(GetReqId(), amount, coinSymbol, direction, exchangeCode, exchangeUserId, parentWalletId...)
+}
+
+// TransferWithExchangeWithRequestId is TransferWithExchange with a caller supplied requestId,
+// so a retried transfer is rejected as duplicate instead of being executed twice.
+// requestId: required
+func (c *Client) TransferWithExchangeWithRequestId(requestId int64, amount string, coinSymbol string, direction TransferDirection, exchangeCode ExchangeCode, exchangeUserId string, parentWalletId ...WalletID) (*TransferWithExchangeResp, error) {
 	params := map[string]interface{}{
 		"amount":         amount,
 		"coinSymbol":     coinSymbol,
@@ -154,16 +141,10 @@ func (c *Client) TransferWithExchange(amount string, coinSymbol string, directio
 	if len(parentWalletId) > 0 {
 		params["parentWalletId"] = parentWalletId[0]
 	}
-	// Generate Random Request ID
-	params["requestId"] = GetReqId()
+	params["requestId"] = requestId
 	post, err := c.post("wallet/transferWithExchange", params)
 	if err != nil {
 		return nil, err
 	}
-	response := &TransferWithExchangeResp{}
-	err = json.Unmarshal(post, response)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return decodeEnvelope[ExchangeTransferResult](post)
 }
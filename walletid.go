@@ -0,0 +1,66 @@
+package ceffu
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// WalletID identifies a wallet or sub wallet. It holds a numeric id, or an alias or wallet name
+// which is resolved through the WalletDirectory of the client before a request is sent.
+// Numeric ids are sent as numbers in request bodies and decoded from numbers or strings.
+type WalletID string
+
+// NewWalletID returns the WalletID of a numeric wallet id
+func NewWalletID(id int64) WalletID {
+	return WalletID(strconv.FormatInt(id, 10))
+}
+
+// ParseWalletID parses a numeric wallet id
+func ParseWalletID(s string) (WalletID, error) {
+	if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+		return "", fmt.Errorf("invalid wallet id %q", s)
+	}
+	return WalletID(s), nil
+}
+
+func (id WalletID) String() string {
+	return string(id)
+}
+
+// Int64 returns the numeric id, an error for aliases and names
+func (id WalletID) Int64() (int64, error) {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("wallet id %q is not numeric", string(id))
+	}
+	return n, nil
+}
+
+// IsNumeric reports whether id is a numeric wallet id rather than an alias or name
+func (id WalletID) IsNumeric() bool {
+	_, err := strconv.ParseInt(string(id), 10, 64)
+	return err == nil
+}
+
+func (id WalletID) MarshalJSON() ([]byte, error) {
+	if n, err := strconv.ParseInt(string(id), 10, 64); err == nil {
+		return strconv.AppendInt(nil, n, 10), nil
+	}
+	return json.Marshal(string(id))
+}
+
+func (id *WalletID) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		*id = WalletID(s)
+		return nil
+	}
+	var n json.Number
+	err := json.Unmarshal(data, &n)
+	if err != nil {
+		return err
+	}
+	*id = WalletID(n.String())
+	return nil
+}
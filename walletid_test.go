@@ -0,0 +1,57 @@
+package ceffu
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestWalletIDJSON(t *testing.T) {
+	var decoded struct {
+		Number WalletID `json:"number"`
+		String WalletID `json:"string"`
+		Name   WalletID `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(`{"number":42,"string":"43","name":"treasury"}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Number != "42" || decoded.String != "43" || decoded.Name != "treasury" || decoded.Name.IsNumeric() {
+		t.Fatalf("unexpected decoding %+v", decoded)
+	}
+	encoded, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != `{"number":42,"string":43,"name":"treasury"}` {
+		t.Fatalf("unexpected encoding %s", encoded)
+	}
+	if _, err = ParseWalletID("0x1"); err == nil {
+		t.Fatal("expected invalid wallet id")
+	}
+	if n, err := NewWalletID(7).Int64(); err != nil || n != 7 {
+		t.Fatalf("unexpected id %d %v", n, err)
+	}
+}
+
+func TestWalletIDRequests(t *testing.T) {
+	var query string
+	var body map[string]interface{}
+	cl := newMockClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body = nil
+			_ = json.NewDecoder(r.Body).Decode(&body)
+		} else {
+			query = r.URL.Query().Get("walletId")
+		}
+		_, _ = w.Write([]byte(`{"code":"000000","data":{}}`))
+	})
+	if _, err := cl.GetAssetDetails("", "", NewWalletID(5), 0, 0); err != nil || query != "5" {
+		t.Fatalf("unexpected query wallet id %q %v", query, err)
+	}
+	if _, err := cl.Withdrawal("1", "USDT", "", "ETH", NewWalletID(5), "0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if body["walletId"] != float64(5) {
+		t.Fatalf("expected numeric wallet id, got %#v", body["walletId"])
+	}
+}